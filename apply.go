@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	notionAPIURL     = "https://api.notion.com"
+	notionAPIVersion = "2022-06-28" // same as go-notion
+)
+
+type PlanApplier struct {
+	DebugMode bool
+	PlanPath  string
+
+	HTTPClient *http.Client
+	Token      string
+	Report     *RunReport
+}
+
+func init() {
+	RegisterCmd(CmdSpec{
+		Name:        "apply",
+		Description: "Execute the Notion mutations recorded in a --dry-run plan file",
+		Standalone:  true,
+		New: func(env CmdEnv, cfg Config) (Cmd, error) {
+			return &PlanApplier{
+				DebugMode:  env.DebugMode,
+				PlanPath:   env.PlanPath,
+				HTTPClient: &http.Client{Transport: newNotionTransport()},
+				Report:     env.Report,
+			}, nil
+		},
+	})
+}
+
+func (a *PlanApplier) Validate() error {
+	if a.PlanPath == "" {
+		return errors.Join(ErrConfigRequired, fmt.Errorf("set --plan"))
+	}
+
+	a.Token = notionToken()
+	if a.Token == "" && isReplaying() {
+		a.Token = redacted
+	}
+	if a.Token == "" {
+		return fmt.Errorf("missing token in env.NOTION_TOKEN")
+	}
+	return nil
+}
+
+func (a *PlanApplier) Run(ctx context.Context) error {
+	plan, err := loadPlan(a.PlanPath)
+	if err != nil {
+		return err
+	}
+	log.Printf("Apply plan of cmd %v created at %v\n%v", plan.Cmd, plan.CreatedAt, plan.Summary())
+	a.Report.AddScanned(len(plan.Steps))
+
+	// placeholder IDs of created objects -> real IDs
+	created := map[string]string{}
+	for i, step := range plan.Steps {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("interrupted, applied %d/%d: %w", i, len(plan.Steps), err)
+		}
+
+		id, err := a.ApplyStep(ctx, step, created)
+		if err != nil {
+			a.Report.AddFailed(step.TargetID, err)
+			return fmt.Errorf("step %d %v -> %v failed, applied %d/%d: %w", i+1, step.Operation, step.TargetID, i, len(plan.Steps), err)
+		}
+		a.Report.AddWritten(1)
+
+		if step.ResultID != "" {
+			created[step.ResultID] = id
+		}
+		log.Printf("Applied step %d: %v -> %v", i+1, step.Operation, step.TargetID)
+	}
+
+	log.Printf("Applied steps: %v", len(plan.Steps))
+	return nil
+}
+
+// ApplyStep sends the recorded request to Notion, and returns the ID of the response object
+func (a *PlanApplier) ApplyStep(ctx context.Context, step PlanStep, created map[string]string) (string, error) {
+	// longer placeholders first, dry-run-1 is a prefix of dry-run-12
+	placeholders := make([]string, 0, len(created))
+	for placeholder := range created {
+		placeholders = append(placeholders, placeholder)
+	}
+	sort.Slice(placeholders, func(i, j int) bool { return len(placeholders[i]) > len(placeholders[j]) })
+
+	path := step.Path
+	payload := string(step.Payload)
+	for _, placeholder := range placeholders {
+		path = strings.ReplaceAll(path, placeholder, created[placeholder])
+		payload = strings.ReplaceAll(payload, placeholder, created[placeholder])
+	}
+
+	var body io.Reader
+	if payload != "" {
+		body = strings.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, step.Method, notionAPIURL+path, body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.Token)
+	req.Header.Set("Notion-Version", notionAPIVersion)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := a.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("statusCode: %v, body: %s", resp.StatusCode, bytes.TrimSpace(respBody))
+	}
+
+	result := struct {
+		ID      string `json:"id"`
+		Results []struct {
+			ID string `json:"id"`
+		} `json:"results"`
+	}{}
+	json.Unmarshal(respBody, &result)
+	if result.ID == "" && len(result.Results) > 0 { // the last block appended
+		result.ID = result.Results[len(result.Results)-1].ID
+	}
+
+	if a.DebugMode {
+		log.Printf("Step response: %s", respBody)
+	}
+	return result.ID, nil
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/zhuochun/notion-toolset/transformer"
+)
+
+// PageCache keeps pages with their block trees on disk, a file per page. A page not
+// edited since cached, by its last_edited_time, is read from the cache instead of
+// querying its blocks again.
+type PageCache struct {
+	Dir string
+
+	mu   sync.Mutex
+	open map[string]*CachedPage // by page ID, pages being read
+}
+
+// cachedPageFile is the file of a page in the cache
+type cachedPageFile struct {
+	PageID         string                       `json:"pageID"`
+	LastEditedTime time.Time                    `json:"lastEditedTime"`
+	CachedAt       time.Time                    `json:"cachedAt"`
+	Page           notion.Page                  `json:"page"`
+	Children       map[string][]json.RawMessage `json:"children"` // blocks by the parent block ID
+}
+
+// OpenPageCache uses the directory as the cache, it is created if missing
+func OpenPageCache(dir string) (*PageCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create cache dir: %w", err)
+	}
+	return &PageCache{Dir: dir, open: map[string]*CachedPage{}}, nil
+}
+
+// pageCache is shared by all cmds in the process, nil when --cache is empty
+var pageCache *PageCache
+
+func setupCache(dir string) error {
+	if dir == "" {
+		return nil
+	}
+
+	cache, err := OpenPageCache(dir)
+	if err != nil {
+		return err
+	}
+	pageCache = cache
+	return nil
+}
+
+func (c *PageCache) path(pageID string) string {
+	return filepath.Join(c.Dir, transformer.SimpleID(pageID)+".json")
+}
+
+// Open the block tree of the page, the report counts a hit when the cached page is
+// unchanged, or a miss. Close it after the page is read.
+func (c *PageCache) Open(page notion.Page, report *RunReport) *CachedPage {
+	if c == nil {
+		return nil
+	}
+
+	p := &CachedPage{cache: c, children: map[string][]notion.Block{}}
+	p.file = cachedPageFile{PageID: page.ID, LastEditedTime: page.LastEditedTime, Page: page}
+
+	if f, err := c.read(page.ID); err == nil && f.fresh(page) {
+		for blockID, raws := range f.Children {
+			blocks, err := decodeCachedBlocks(raws)
+			if err != nil {
+				p.children = map[string][]notion.Block{}
+				break
+			}
+			p.children[blockID] = blocks
+		}
+		if len(p.children) == len(f.Children) {
+			p.file = f
+		}
+	}
+
+	if p.file.CachedAt.IsZero() {
+		report.AddCacheMiss()
+	} else {
+		report.AddCacheHit()
+		now := time.Now()
+		os.Chtimes(c.path(page.ID), now, now) // pruned by the last use
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.open[transformer.SimpleID(page.ID)] = p
+	return p
+}
+
+// Lookup returns the page open by Open, or nil, so block futures of its transformer are
+// served from the same cache
+func (c *PageCache) Lookup(pageID string) *CachedPage {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.open[transformer.SimpleID(pageID)]
+}
+
+func (c *PageCache) read(pageID string) (cachedPageFile, error) {
+	var f cachedPageFile
+
+	data, err := os.ReadFile(c.path(pageID))
+	if err != nil {
+		return f, err
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return f, fmt.Errorf("unmarshal cache of %v: %w", pageID, err)
+	}
+	return f, nil
+}
+
+// fresh is true when the page is not edited since cached. Notion rounds last_edited_time
+// to the minute, a page cached in the minute it was edited can miss later edits.
+func (f cachedPageFile) fresh(page notion.Page) bool {
+	return f.LastEditedTime.Equal(page.LastEditedTime) && f.CachedAt.After(page.LastEditedTime.Add(time.Minute))
+}
+
+// CachedPage is the block tree of a page, children not cached are queried and added
+type CachedPage struct {
+	cache *PageCache
+
+	mu       sync.Mutex
+	file     cachedPageFile
+	children map[string][]notion.Block
+	changed  bool
+	failed   bool // a query failed, the tree is incomplete
+}
+
+// Children of the block, from the cache, or queried by query and added to the cache.
+// A nil CachedPage always queries.
+func (p *CachedPage) Children(ctx context.Context, blockID string, query func(context.Context, string) ([]notion.Block, error)) ([]notion.Block, error) {
+	if p == nil {
+		return query(ctx, blockID)
+	}
+
+	key := transformer.SimpleID(blockID)
+	p.mu.Lock()
+	blocks, found := p.children[key]
+	p.mu.Unlock()
+	if found {
+		return blocks, nil
+	}
+
+	blocks, err := query(ctx, blockID)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		p.failed = true
+		return blocks, err
+	}
+	p.children[key] = blocks
+	p.changed = true
+	return blocks, nil
+}
+
+// Close writes the page when children are added, unless a query failed, so the next
+// run queries the page again
+func (p *CachedPage) Close() error {
+	if p == nil {
+		return nil
+	}
+
+	p.cache.mu.Lock()
+	delete(p.cache.open, transformer.SimpleID(p.file.PageID))
+	p.cache.mu.Unlock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.changed || p.failed {
+		return nil
+	}
+
+	p.file.Children = map[string][]json.RawMessage{}
+	for blockID, blocks := range p.children {
+		raws, err := encodeCachedBlocks(blocks)
+		if err != nil {
+			return fmt.Errorf("encode cache of %v: %w", p.file.PageID, err)
+		}
+		p.file.Children[blockID] = raws
+	}
+	if p.file.CachedAt.IsZero() {
+		p.file.CachedAt = time.Now()
+	}
+
+	data, err := json.Marshal(p.file)
+	if err != nil {
+		return fmt.Errorf("marshal cache of %v: %w", p.file.PageID, err)
+	}
+	return writeFileAtomicBytes(p.cache.path(p.file.PageID), data)
+}
+
+// encodeCachedBlocks encodes blocks as the API returns them, a block marshals only its
+// content, the fields of all blocks are added here
+func encodeCachedBlocks(blocks []notion.Block) ([]json.RawMessage, error) {
+	raws := make([]json.RawMessage, 0, len(blocks))
+	for _, block := range blocks {
+		data, err := json.Marshal(block)
+		if err != nil {
+			return nil, err
+		}
+
+		content := map[string]json.RawMessage{}
+		if err := json.Unmarshal(data, &content); err != nil || len(content) != 1 {
+			return nil, fmt.Errorf("invalid block %v: %s", block.ID(), data)
+		}
+
+		raw := map[string]interface{}{
+			"object":           "block",
+			"id":               block.ID(),
+			"parent":           block.Parent(),
+			"created_time":     block.CreatedTime(),
+			"created_by":       block.CreatedBy(),
+			"last_edited_time": block.LastEditedTime(),
+			"last_edited_by":   block.LastEditedBy(),
+			"has_children":     block.HasChildren(),
+			"archived":         block.Archived(),
+		}
+		for typ, body := range content {
+			raw["type"] = typ
+			raw[typ] = body
+		}
+
+		data, err = json.Marshal(raw)
+		if err != nil {
+			return nil, err
+		}
+		raws = append(raws, data)
+	}
+	return raws, nil
+}
+
+func decodeCachedBlocks(raws []json.RawMessage) ([]notion.Block, error) {
+	data, err := json.Marshal(map[string]interface{}{"object": "list", "results": raws})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp notion.BlockChildrenResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Results, nil
+}
+
+// CacheInspector shows and prunes the page cache
+type CacheInspector struct {
+	Cache *PageCache
+	Args  []string // `stats` or `prune [days]`
+	Out   io.Writer
+}
+
+func init() {
+	RegisterCmd(CmdSpec{
+		Name:        "cache",
+		Description: "Show or prune the page cache: cache stats, cache prune [days], 0 days prunes all",
+		Standalone:  true,
+		New: func(env CmdEnv, cfg Config) (Cmd, error) {
+			return &CacheInspector{
+				Cache: env.Cache,
+				Args:  env.Args,
+				Out:   os.Stdout,
+			}, nil
+		},
+	})
+}
+
+func (c *CacheInspector) Validate() error {
+	if c.Cache == nil {
+		return errors.Join(ErrConfigRequired, fmt.Errorf("set --cache"))
+	}
+
+	if len(c.Args) == 0 {
+		c.Args = []string{"stats"}
+	}
+	switch c.Args[0] {
+	case "stats":
+	case "prune":
+		if len(c.Args) > 1 {
+			if days, err := strconv.Atoi(c.Args[1]); err != nil || days < 0 {
+				return fmt.Errorf("invalid days to prune: `%v`", c.Args[1])
+			}
+		}
+	default:
+		return fmt.Errorf("unknown cache action: `%v`, use stats or prune", c.Args[0])
+	}
+	return nil
+}
+
+func (c *CacheInspector) Run(ctx context.Context) error {
+	if c.Args[0] == "prune" {
+		days := 30
+		if len(c.Args) > 1 {
+			days, _ = strconv.Atoi(c.Args[1])
+		}
+		return c.Prune(time.Now().AddDate(0, 0, -days))
+	}
+	return c.Stats()
+}
+
+// files are the page files in the cache
+func (c *CacheInspector) files() ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(c.Cache.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("read cache dir: %w", err)
+	}
+
+	files := []os.FileInfo{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			files = append(files, info)
+		}
+	}
+	return files, nil
+}
+
+// Stats prints the number of pages and the size of the cache
+func (c *CacheInspector) Stats() error {
+	files, err := c.files()
+	if err != nil {
+		return err
+	}
+
+	size, oldest := int64(0), time.Now()
+	for _, f := range files {
+		size += f.Size()
+		if f.ModTime().Before(oldest) {
+			oldest = f.ModTime()
+		}
+	}
+
+	tw := tabwriter.NewWriter(c.Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DIR\tPAGES\tSIZE\tLEAST RECENTLY USED")
+	fmt.Fprintf(tw, "%v\t%v\t%.1f MB\t%v\n", c.Cache.Dir, len(files), float64(size)/(1<<20), oldest.Format(time.RFC3339))
+	return tw.Flush()
+}
+
+// Prune removes pages not used since the time
+func (c *CacheInspector) Prune(before time.Time) error {
+	files, err := c.files()
+	if err != nil {
+		return err
+	}
+
+	pruned := 0
+	for _, f := range files {
+		if f.ModTime().After(before) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(c.Cache.Dir, f.Name())); err != nil {
+			return fmt.Errorf("prune cache: %w", err)
+		}
+		pruned++
+	}
+
+	fmt.Fprintf(c.Out, "Pruned %d of %d pages in %v\n", pruned, len(files), c.Cache.Dir)
+	return nil
+}
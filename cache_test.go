@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/zhuochun/notion-toolset/notiontest"
+	"github.com/zhuochun/notion-toolset/transformer"
+)
+
+// countCalls counts the calls of the method since the index
+func countCalls(calls []string, from int, method string) int {
+	n := 0
+	for _, call := range calls[from:] {
+		if strings.HasPrefix(call, method+" ") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestExporterCache(t *testing.T) {
+	fake := notiontest.New()
+	fake.Now = func() time.Time { return time.Now().Add(-time.Hour) } // edited before cached
+	db := fake.AddDatabase("Notes", notion.DatabaseProperties{
+		"Created At": {Type: notion.DBPropTypeCreatedTime},
+		"Edited At":  {Type: notion.DBPropTypeLastEditedTime},
+	})
+
+	page := fake.AddPage(notiontest.DatabasePage(db.ID, "Cached"),
+		notiontest.Paragraph("Hello cache"),
+		&notion.ToggleBlock{RichText: notiontest.RichText("More"), Children: []notion.Block{notiontest.Paragraph("Nested line")}},
+	)
+
+	cache, err := OpenPageCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := readTestConfig(t, "export.yaml")
+	cfg.Exporter.DatabaseID = db.ID
+	cfg.Exporter.Directory = t.TempDir()
+	filename := filepath.Join(cfg.Exporter.Directory, transformer.SimpleID(page.ID)+".md")
+
+	_, report := runTestCmdEnv(t, "export", CmdEnv{Client: fake, Cache: cache}, cfg)
+	if report.CacheHits != 0 || report.CacheMisses != 1 {
+		t.Errorf("expect a miss in the first run, got %v", report)
+	}
+	first, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from := len(fake.Calls())
+	_, report = runTestCmdEnv(t, "export", CmdEnv{Client: fake, Cache: cache}, cfg)
+	if report.CacheHits != 1 || report.CacheMisses != 0 {
+		t.Errorf("expect a hit in the second run, got %v", report)
+	}
+	if n := countCalls(fake.Calls(), from, "FindBlockChildrenByID"); n != 0 {
+		t.Errorf("expect blocks read from the cache, got %v queries", n)
+	}
+
+	second, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, second) || !strings.Contains(string(second), "Nested line") {
+		t.Errorf("expect the same export from the cache, got:\n%s\nwant:\n%s", second, first)
+	}
+
+	// an edited page is queried again
+	edited := page
+	edited.LastEditedTime = page.LastEditedTime.Add(time.Minute)
+	cached := cache.Open(edited, nil)
+	from = len(fake.Calls())
+	if _, err := cached.Children(t.Context(), page.ID, (&Exporter{Client: fake}).QueryBlocks); err != nil {
+		t.Fatal(err)
+	}
+	cached.Close()
+	if n := countCalls(fake.Calls(), from, "FindBlockChildrenByID"); n != 1 {
+		t.Errorf("expect an edited page queried, got %v queries", n)
+	}
+}
+
+func TestCachedPageFresh(t *testing.T) {
+	edited := time.Now().Add(-time.Hour)
+	page := notion.Page{ID: "page-1", LastEditedTime: edited}
+
+	for _, tc := range []struct {
+		name     string
+		file     cachedPageFile
+		expected bool
+	}{
+		{"unchanged", cachedPageFile{LastEditedTime: edited, CachedAt: edited.Add(2 * time.Minute)}, true},
+		{"edited since", cachedPageFile{LastEditedTime: edited.Add(-time.Minute), CachedAt: edited.Add(2 * time.Minute)}, false},
+		{"cached in the edit minute", cachedPageFile{LastEditedTime: edited, CachedAt: edited.Add(30 * time.Second)}, false},
+	} {
+		if got := tc.file.fresh(page); got != tc.expected {
+			t.Errorf("%v: expect fresh %v, got %v", tc.name, tc.expected, got)
+		}
+	}
+}
+
+func TestCacheInspector(t *testing.T) {
+	cache, err := OpenPageCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, id := range []string{"old-page", "new-page"} {
+		filename := cache.path(id)
+		if err := os.WriteFile(filename, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		used := time.Now().AddDate(0, 0, -40+i*35) // 40 and 5 days ago
+		if err := os.Chtimes(filename, used, used); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run := func(args ...string) string {
+		t.Helper()
+
+		out := &bytes.Buffer{}
+		c := &CacheInspector{Cache: cache, Args: args, Out: out}
+		if err := c.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Run(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+
+	if out := run(); !strings.Contains(out, "PAGES") || !strings.Contains(out, " 2 ") {
+		t.Errorf("expect 2 pages in stats, got %q", out)
+	}
+
+	if out := run("prune"); !strings.Contains(out, "Pruned 1 of 2") {
+		t.Errorf("expect the old page pruned, got %q", out)
+	}
+	if _, err := os.Stat(cache.path("new-page")); err != nil {
+		t.Errorf("expect the new page kept: %v", err)
+	}
+
+	if out := run("prune", "0"); !strings.Contains(out, "Pruned 1 of 1") {
+		t.Errorf("expect all pages pruned, got %q", out)
+	}
+
+	if err := (&CacheInspector{Cache: cache, Args: []string{"prune", "x"}}).Validate(); err == nil {
+		t.Errorf("expect invalid days")
+	}
+	if err := (&CacheInspector{Args: []string{"stats"}}).Validate(); err == nil {
+		t.Errorf("expect --cache required")
+	}
+}
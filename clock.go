@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Clock tells the time in the timezone of a config, and formats journal titles.
+// The zero Clock is the local timezone with titles in layoutDate.
+type Clock struct {
+	Location    *time.Location
+	TitleFormat string
+}
+
+func (c Clock) loc() *time.Location {
+	if c.Location == nil {
+		return time.Local
+	}
+	return c.Location
+}
+
+// Now is the current time in the timezone
+func (c Clock) Now() time.Time {
+	return time.Now().In(c.loc())
+}
+
+// Today is the start of the current day in the timezone
+func (c Clock) Today() time.Time {
+	y, m, d := c.Now().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, c.loc())
+}
+
+// Date formats the day of t in the timezone with layoutDate, used in queries and blocks
+func (c Clock) Date(t time.Time) string {
+	return t.In(c.loc()).Format(layoutDate)
+}
+
+// Title formats the day of t in the timezone as a journal title
+func (c Clock) Title(t time.Time) string {
+	if c.TitleFormat == "" {
+		return c.Date(t)
+	}
+	return t.In(c.loc()).Format(c.TitleFormat)
+}
+
+// Clock of the config, the timezone and title format not set are inherited from parent,
+// e.g. pipeline steps inherit from the pipeline
+func (cfg Config) Clock(parent Clock) (Clock, error) {
+	clock := parent
+
+	if cfg.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return clock, fmt.Errorf("invalid timezone: %w", err)
+		}
+		clock.Location = loc
+	}
+	if cfg.TitleFormat != "" {
+		clock.TitleFormat = cfg.TitleFormat
+	}
+
+	return clock, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Singapore")
+	clock := Clock{Location: loc, TitleFormat: "2006/01/02 Mon"}
+
+	ts := time.Date(2024, 3, 10, 20, 0, 0, 0, time.UTC) // 04:00 next day in Singapore
+	if got := clock.Date(ts); got != "2024-03-11" {
+		t.Errorf("Date = %v, want 2024-03-11", got)
+	}
+	if got := clock.Title(ts); got != "2024/03/11 Mon" {
+		t.Errorf("Title = %v, want 2024/03/11 Mon", got)
+	}
+	if got := (Clock{Location: loc}).Title(ts); got != "2024-03-11" {
+		t.Errorf("Title without format = %v, want 2024-03-11", got)
+	}
+
+	today := clock.Today()
+	if today.Location() != loc || today.Hour() != 0 || today.Format(layoutDate) != clock.Date(time.Now()) {
+		t.Errorf("Today = %v", today)
+	}
+}
+
+func TestConfigClock(t *testing.T) {
+	parent, err := Config{Timezone: "Asia/Tokyo", TitleFormat: "Jan 2"}.Clock(Clock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock, err := Config{Timezone: "UTC"}.Clock(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clock.Location.String() != "UTC" || clock.TitleFormat != "Jan 2" {
+		t.Errorf("expect timezone overridden and title format inherited, got %+v", clock)
+	}
+
+	if _, err := (Config{Timezone: "Mars/Olympus"}).Clock(parent); err == nil || !strings.Contains(err.Error(), "invalid timezone") {
+		t.Errorf("expect invalid timezone error, got %v", err)
+	}
+}
@@ -7,44 +7,77 @@ import (
 	"log"
 
 	"github.com/dstotijn/go-notion"
+	"github.com/zhuochun/notion-toolset/retry"
 )
 
 type CollectorConfig struct {
-	DatabaseID           string   `yaml:"databaseID"`
-	DatabaseQuery        string   `yaml:"databaseQuery"`
-	CollectionIDs        []string `yaml:"collectionIDs"`
-	CollectDumpID        string   `yaml:"collectDumpID"`
-	CollectDumpTextBlock string   `yaml:"collectDumpTextBlock"` // Format https://pkg.go.dev/github.com/dstotijn/go-notion#ParagraphBlock
+	DatabaseID           string       `yaml:"databaseID"`
+	DatabaseQuery        string       `yaml:"databaseQuery"`
+	Filter               string       `yaml:"filter"` // or a filter instead, e.g. `Meta is not empty`
+	Sort                 string       `yaml:"sort"`   // optional, sorts of the filter
+	Search               *SearchSpec  `yaml:"search"` // or search the workspace instead of the database
+	Source               SourceConfig `yaml:"source"` // or any source, e.g. databaseIDs, rootPageID, file, overrides the above
+	CollectionIDs        []string     `yaml:"collectionIDs"`
+	CollectDumpID        string       `yaml:"collectDumpID"`
+	CollectDumpTextBlock string       `yaml:"collectDumpTextBlock"` // Format https://pkg.go.dev/github.com/dstotijn/go-notion#ParagraphBlock
+	CollectDumpAnchor    WriteAnchor  `yaml:"collectDumpAnchor"`    // optional, where to write in the dump page, e.g. top: true
 	// CollectDumpBlock string   `yaml:"collectDumpBlock"` // DEPRECATED (2023-12) use collectDumpTextBlock
 }
 
 type Collector struct {
 	DebugMode bool
 
-	Client *notion.Client
+	Client NotionAPI
+	Report *RunReport
+	Clock  Clock
 	CollectorConfig
+
+	outputPages []notion.Page
+}
+
+func init() {
+	RegisterCmd(CmdSpec{
+		Name:        "collector",
+		Description: "Find new pages from a database and dump them in a page",
+		Section:     "collector",
+		Config:      CollectorConfig{},
+		New: func(env CmdEnv, cfg Config) (Cmd, error) {
+			return &Collector{
+				DebugMode:       env.DebugMode,
+				Client:          env.Client,
+				Report:          env.Report,
+				Clock:           env.Clock,
+				CollectorConfig: cfg.Collector,
+			}, nil
+		},
+	})
 }
 
 func (c *Collector) Validate() error {
 	if len(c.CollectDumpTextBlock) == 0 {
 		return errors.Join(ErrConfigRequired, fmt.Errorf("set collectDumpTextBlock"))
 	}
-	return nil
+	return c.CollectDumpAnchor.Validate()
 }
 
-func (c *Collector) Run() error {
-	collected := c.GetCollected()
+func (c *Collector) Run(ctx context.Context) error {
+	collected := c.GetCollected(ctx)
+	if err := ctx.Err(); err != nil { // collected pages are incomplete
+		return err
+	}
 	log.Printf("Found collected pages: %d", len(collected))
 
-	pagesChan, errChan := c.ScanPages()
+	pagesChan, errChan := c.ScanPages(ctx)
 	pageNum := 0
-	newPages := []string{}
+	newPages := []notion.Page{}
 	for pages := range pagesChan {
 		for _, page := range pages {
 			pageNum += 1
 
 			if !collected[page.ID] {
-				newPages = append(newPages, page.ID)
+				newPages = append(newPages, page)
+			} else {
+				c.Report.AddSkipped(1)
 			}
 
 			if c.DebugMode && pageNum%500 == 0 {
@@ -53,6 +86,7 @@ func (c *Collector) Run() error {
 		}
 	}
 	log.Printf("Scanned pages: %v, new pages: %v", pageNum, len(newPages))
+	c.Report.AddScanned(pageNum)
 
 	select {
 	case err := <-errChan:
@@ -61,11 +95,20 @@ func (c *Collector) Run() error {
 	}
 
 	errNum := 0
-	for _, newPageID := range newPages {
-		if _, err := c.WriteBlock(newPageID); err != nil {
+	for _, newPage := range newPages {
+		if err := ctx.Err(); err != nil {
+			log.Printf("Interrupted. Succeed: %d, failed: %d", len(c.outputPages), errNum)
+			return err
+		}
+
+		if _, err := c.WriteBlock(ctx, newPage.ID); err != nil {
 			errNum += 1
 
-			log.Printf("Failed to write block with PageID: %v, err: %v", newPageID, err)
+			log.Printf("Failed to write block with PageID: %v, err: %v", newPage.ID, err)
+			c.Report.AddFailed(newPage.ID, err)
+		} else {
+			c.outputPages = append(c.outputPages, newPage)
+			c.Report.AddWritten(1)
 		}
 	}
 	log.Printf("Updated new pages. Succeed: %d, failed: %d", len(newPages)-errNum, errNum)
@@ -73,7 +116,11 @@ func (c *Collector) Run() error {
 	return nil
 }
 
-func (c *Collector) GetCollected() map[string]bool {
+func (c *Collector) OutputPages() []notion.Page {
+	return c.outputPages
+}
+
+func (c *Collector) GetCollected(ctx context.Context) map[string]bool {
 	collected := map[string]bool{}
 
 	scanIDs := c.CollectionIDs
@@ -84,7 +131,11 @@ func (c *Collector) GetCollected() map[string]bool {
 		}
 
 		for _, blockID := range scanIDs {
-			blocks, err := c.GetCollectionBlocks(blockID)
+			if ctx.Err() != nil {
+				return collected
+			}
+
+			blocks, err := c.GetCollectionBlocks(ctx, blockID)
 			if err != nil {
 				log.Printf("GetCollectionBlocks Failed. ID: %v, Err: %v", blockID, err)
 			}
@@ -122,13 +173,18 @@ func (c *Collector) GetCollected() map[string]bool {
 	return collected
 }
 
-func (c *Collector) GetCollectionBlocks(blockID string) ([]notion.Block, error) {
+func (c *Collector) GetCollectionBlocks(ctx context.Context, blockID string) ([]notion.Block, error) {
 	pages := []notion.Block{}
 
 	cursor := ""
 	for {
 		query := &notion.PaginationQuery{StartCursor: cursor}
-		resp, err := c.Client.FindBlockChildrenByID(context.TODO(), blockID, query)
+		var resp notion.BlockChildrenResponse
+		err := retry.Do(ctx, func(ctx context.Context) error {
+			var innerErr error
+			resp, innerErr = c.Client.FindBlockChildrenByID(ctx, blockID, query)
+			return innerErr
+		})
 		if err != nil {
 			return pages, err
 		}
@@ -145,23 +201,24 @@ func (c *Collector) GetCollectionBlocks(blockID string) ([]notion.Block, error)
 	return pages, nil
 }
 
-func (c *Collector) ScanPages() (chan []notion.Page, chan error) {
-	q := NewDatabaseQuery(c.Client, c.DatabaseID)
+func (c *Collector) ScanPages(ctx context.Context) (chan []notion.Page, chan error) {
+	source := c.Source.Or(SourceConfig{DatabaseID: c.DatabaseID, DatabaseQuery: c.DatabaseQuery, Filter: c.Filter, Sort: c.Sort, Search: c.Search})
 
-	if err := q.SetQuery(c.DatabaseQuery, QueryBuilder{}); err != nil {
-		log.Panicf("Invalid query: %v, err: %v", c.DatabaseQuery, err)
+	src, err := NewPageSource(ctx, c.Client, c.Clock, source, QueryBuilder{})
+	if err != nil {
+		return errPages(err)
 	}
 
 	if c.DebugMode {
-		log.Printf("DatabaseQuery Filter: %+v", q.Query.Filter)
-		log.Printf("DatabaseQuery Sorter: %+v", q.Query.Sorts)
+		logSource(src)
 	}
-
-	return q.Go(context.TODO(), 3)
+	return GoPages(ctx, src, 3)
 }
 
-func (c *Collector) WriteBlock(pageID string) (notion.BlockChildrenResponse, error) {
+func (c *Collector) WriteBlock(ctx context.Context, pageID string) (notion.BlockChildrenResponse, error) {
 	w := NewAppendBlock(c.Client, c.CollectDumpID)
+	w.Clock = c.Clock
+	w.Anchor = c.CollectDumpAnchor
 
 	if err := w.AddParagraph("Collector", c.CollectDumpTextBlock, BlockBuilder{
 		PageID: pageID,
@@ -169,5 +226,5 @@ func (c *Collector) WriteBlock(pageID string) (notion.BlockChildrenResponse, err
 		return notion.BlockChildrenResponse{}, err
 	}
 
-	return w.Do(context.TODO())
+	return w.Do(ctx)
 }
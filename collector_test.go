@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/zhuochun/notion-toolset/notiontest"
+)
+
+func mentionBlock(pageID string) *notion.ParagraphBlock {
+	return &notion.ParagraphBlock{RichText: []notion.RichText{{
+		Type:    notion.RichTextTypeMention,
+		Mention: &notion.Mention{Type: notion.MentionTypePage, Page: &notion.ID{ID: pageID}},
+	}}}
+}
+
+func mentionedPages(blocks []notion.Block) []string {
+	ids := []string{}
+	for _, block := range blocks {
+		if p, ok := block.(*notion.ParagraphBlock); ok {
+			for _, rt := range p.RichText {
+				if rt.Mention != nil && rt.Mention.Page != nil {
+					ids = append(ids, rt.Mention.Page.ID)
+				}
+			}
+		}
+	}
+	return ids
+}
+
+func TestCollector(t *testing.T) {
+	fake := notiontest.New()
+	db := fake.AddDatabase("Notes", notion.DatabaseProperties{"Meta": {Type: notion.DBPropTypeMultiSelect}})
+
+	newPage := func(title string, meta ...string) notion.Page {
+		page := notiontest.DatabasePage(db.ID, title)
+		opts := []notion.SelectOptions{}
+		for _, m := range meta {
+			opts = append(opts, notion.SelectOptions{Name: m})
+		}
+		page.Properties.(notion.DatabasePageProperties)["Meta"] = notion.DatabasePageProperty{Type: notion.DBPropTypeMultiSelect, MultiSelect: opts}
+		return fake.AddPage(page)
+	}
+
+	collected := newPage("collected", "idea")
+	fresh := newPage("fresh", "idea")
+	newPage("no meta")
+
+	inbox := fake.AddPage(notiontest.DatabasePage(db.ID, "inbox"), mentionBlock(collected.ID))
+	dump := fake.AddPage(notiontest.DatabasePage(db.ID, "dump"))
+
+	cfg := readTestConfig(t, "collector.yaml")
+	cfg.Collector.DatabaseID = db.ID
+	cfg.Collector.CollectionIDs = []string{inbox.ID}
+	cfg.Collector.CollectDumpID = dump.ID
+
+	cmd, report := runTestCmd(t, "collector", fake, cfg)
+
+	if report.Scanned != 2 || report.Skipped != 1 || report.Written != 1 {
+		t.Errorf("unexpected report: %v", report)
+	}
+
+	if ids := mentionedPages(fake.Children(dump.ID)); len(ids) != 1 || ids[0] != fresh.ID {
+		t.Errorf("expect only %v dumped, got %v", fresh.ID, ids)
+	}
+
+	if out := cmd.(PageProducer).OutputPages(); len(out) != 1 || out[0].ID != fresh.ID {
+		t.Errorf("expect output %v, got %+v", fresh.ID, out)
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/go-yaml/yaml"
+)
+
+// Config files support on top of plain yaml:
+//   - `${ENV_VAR}` or `${ENV_VAR:-default}` in string values, `$${` for a literal `${`
+//   - `include: path` (or a list of paths) in any mapping, merged under the mapping,
+//     paths are relative to the file that includes them
+//   - `defaults:` and `configs:` in multi config, defaults are merged into each config
+const (
+	includeKey  = "include"
+	defaultsKey = "defaults"
+	configsKey  = "configs"
+)
+
+var envVarRegex = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// envValue is a value of only `${VAR}` that reads as an int, float or bool in yaml. It is
+// written back as plain yaml, so the field decides the type, e.g. `on` is true for a bool
+// field, and "on" for a string field, `0123` stays "0123" for a string field.
+type envValue string
+
+// readConfigTree reads a config file into generic yaml values, with includes resolved
+// and env variables interpolated
+func readConfigTree(path string, including map[string]bool) (interface{}, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if including[absPath] {
+		return nil, fmt.Errorf("include cycle at %v", path)
+	}
+	including[absPath] = true
+	defer delete(including, absPath)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tree interface{}
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+
+	if tree, err = interpolateEnv(tree); err != nil {
+		return nil, err
+	}
+
+	return resolveIncludes(tree, filepath.Dir(path), including)
+}
+
+func resolveIncludes(node interface{}, dir string, including map[string]bool) (interface{}, error) {
+	switch n := node.(type) {
+	case map[interface{}]interface{}:
+		var merged interface{} = map[interface{}]interface{}{}
+
+		if include, found := n[includeKey]; found {
+			paths := []string{}
+			switch v := include.(type) {
+			case string:
+				paths = append(paths, v)
+			case []interface{}:
+				for _, p := range v {
+					s, ok := p.(string)
+					if !ok {
+						return nil, fmt.Errorf("invalid include: %v", p)
+					}
+					paths = append(paths, s)
+				}
+			default:
+				return nil, fmt.Errorf("invalid include: %v", include)
+			}
+
+			for _, p := range paths {
+				if !filepath.IsAbs(p) {
+					p = filepath.Join(dir, p)
+				}
+
+				included, err := readConfigTree(p, including)
+				if err != nil {
+					return nil, fmt.Errorf("include %v: %w", p, err)
+				}
+				merged = mergeConfigTree(merged, included)
+			}
+		}
+
+		own := map[interface{}]interface{}{}
+		for k, v := range n {
+			if k == includeKey {
+				continue
+			}
+
+			resolved, err := resolveIncludes(v, dir, including)
+			if err != nil {
+				return nil, err
+			}
+			own[k] = resolved
+		}
+
+		return mergeConfigTree(merged, own), nil
+	case []interface{}:
+		list := make([]interface{}, len(n))
+		for i, v := range n {
+			resolved, err := resolveIncludes(v, dir, including)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = resolved
+		}
+		return list, nil
+	default:
+		return node, nil
+	}
+}
+
+// mergeConfigTree merges mappings recursively, values in over take precedence,
+// lists and scalars are replaced
+func mergeConfigTree(base, over interface{}) interface{} {
+	baseMap, ok1 := base.(map[interface{}]interface{})
+	overMap, ok2 := over.(map[interface{}]interface{})
+	if !ok1 || !ok2 {
+		return over
+	}
+
+	merged := make(map[interface{}]interface{}, len(baseMap)+len(overMap))
+	for k, v := range baseMap {
+		merged[k] = v
+	}
+	for k, v := range overMap {
+		if bv, found := merged[k]; found {
+			merged[k] = mergeConfigTree(bv, v)
+		} else {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+func interpolateEnv(node interface{}) (interface{}, error) {
+	switch n := node.(type) {
+	case string:
+		return interpolateEnvString(n)
+	case map[interface{}]interface{}:
+		for k, v := range n {
+			resolved, err := interpolateEnv(v)
+			if err != nil {
+				return nil, err
+			}
+			n[k] = resolved
+		}
+		return n, nil
+	case []interface{}:
+		for i, v := range n {
+			resolved, err := interpolateEnv(v)
+			if err != nil {
+				return nil, err
+			}
+			n[i] = resolved
+		}
+		return n, nil
+	default:
+		return node, nil
+	}
+}
+
+func interpolateEnvString(s string) (interface{}, error) {
+	var missing []string
+
+	out := envVarRegex.ReplaceAllStringFunc(s, func(m string) string {
+		if m == "$${" {
+			return "${"
+		}
+
+		sub := envVarRegex.FindStringSubmatch(m)
+		if v, found := os.LookupEnv(sub[1]); found {
+			return v
+		}
+		if sub[2] != "" {
+			return sub[3]
+		}
+
+		missing = append(missing, sub[1])
+		return ""
+	})
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("env variables not set: %v", missing)
+	}
+
+	// a value of only `${VAR}` takes the type of the field, e.g. `limit: ${LIMIT}`
+	if loc := envVarRegex.FindStringIndex(s); loc != nil && loc[0] == 0 && loc[1] == len(s) && s != "$${" &&
+		!strings.ContainsAny(out, " \t\r\n#:") {
+		var typed interface{}
+		if err := yaml.Unmarshal([]byte(out), &typed); err == nil {
+			switch typed.(type) {
+			case int, float64, bool:
+				return envValue(out), nil
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// marshalConfigTree marshals generic yaml values, env values are written as plain scalars
+func marshalConfigTree(tree interface{}) ([]byte, error) {
+	values := []string{}
+	data, err := yaml.Marshal(placeEnvValues(tree, &values))
+	if err != nil {
+		return nil, err
+	}
+
+	for i, v := range values {
+		data = bytes.Replace(data, []byte(envPlaceholder(i)), []byte(v), 1)
+	}
+	return data, nil
+}
+
+// placeEnvValues returns a copy of the tree with env values replaced by placeholders
+func placeEnvValues(node interface{}, values *[]string) interface{} {
+	switch n := node.(type) {
+	case envValue:
+		*values = append(*values, string(n))
+		return envPlaceholder(len(*values) - 1)
+	case map[interface{}]interface{}:
+		m := make(map[interface{}]interface{}, len(n))
+		for k, v := range n {
+			m[k] = placeEnvValues(v, values)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(n))
+		for i, v := range n {
+			list[i] = placeEnvValues(v, values)
+		}
+		return list
+	default:
+		return node
+	}
+}
+
+func envPlaceholder(i int) string {
+	return fmt.Sprintf("notion-toolset-env-%d-value", i)
+}
+
+// splitMultiConfigTree returns the entries of a multi config, either a list of configs,
+// or `configs:` with optional `defaults:` merged into each of them
+func splitMultiConfigTree(tree interface{}) ([]interface{}, error) {
+	switch n := tree.(type) {
+	case []interface{}:
+		return n, nil
+	case map[interface{}]interface{}:
+		entries, ok := n[configsKey].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("multi config expects a list, or `%v:` with a list", configsKey)
+		}
+
+		for k := range n {
+			if k != configsKey && k != defaultsKey {
+				return nil, fmt.Errorf("unknown key in multi config: %v, expects `%v:` and `%v:`", k, configsKey, defaultsKey)
+			}
+		}
+
+		defaults, found := n[defaultsKey]
+		if !found {
+			return entries, nil
+		}
+
+		merged := make([]interface{}, len(entries))
+		for i, entry := range entries {
+			merged[i] = mergeConfigTree(defaults, entry)
+		}
+		return merged, nil
+	case nil:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("multi config expects a list")
+	}
+}
+
+// decodeConfigTree decodes generic yaml values into out, using the yaml tags
+func decodeConfigTree(tree interface{}, out interface{}, strict bool) error {
+	if m, ok := tree.(map[interface{}]interface{}); ok { // defaults in single config
+		if defaults, found := m[defaultsKey]; found {
+			delete(m, defaultsKey)
+			tree = mergeConfigTree(defaults, m)
+		}
+	}
+
+	data, err := marshalConfigTree(tree)
+	if err != nil {
+		return err
+	}
+
+	if strict {
+		return yaml.UnmarshalStrict(data, out)
+	}
+	return yaml.Unmarshal(data, out)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadMultiConfigIncludeDefaultsEnv(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	write("shared.yaml", `
+flashback:
+  flashbackTextBlock: "{{.PageID}}"
+  flashbackNum: 1
+`)
+	path := write("multi.yaml", `
+defaults:
+  include: shared.yaml
+  flashback:
+    databaseID: ${TEST_TOOLSET_DB}
+    flashbackNum: ${TEST_TOOLSET_NUM:-3}
+configs:
+  - flashback:
+      flashbackPageID: a
+  - flashback:
+      flashbackPageID: b
+      flashbackNum: 5
+`)
+	t.Setenv("TEST_TOOLSET_DB", "db1")
+
+	configs, err := readMultiConfig(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(configs) != 2 {
+		t.Fatalf("expected 2 configs, got %v", len(configs))
+	}
+
+	first, second := configs[0].Flashback, configs[1].Flashback
+	if first.DatabaseID != "db1" || first.FlashbackTextBlock != "{{.PageID}}" || first.FlashbackPageID != "a" {
+		t.Fatalf("unexpected first config: %+v", first)
+	}
+	if first.FlashbackNum != 3 || second.FlashbackNum != 5 {
+		t.Fatalf("unexpected flashbackNum: %v, %v", first.FlashbackNum, second.FlashbackNum)
+	}
+}
+
+func TestReadConfigEnvTypes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "env.yaml")
+	os.WriteFile(path, []byte(`
+flashback:
+  databaseID: ${TEST_TOOLSET_DB}
+  flashbackPageID: ${TEST_TOOLSET_PAGE}
+  flashbackNum: ${TEST_TOOLSET_NUM}
+`), 0644)
+	t.Setenv("TEST_TOOLSET_DB", "0123")
+	t.Setenv("TEST_TOOLSET_PAGE", "on")
+	t.Setenv("TEST_TOOLSET_NUM", "7")
+
+	cfg, err := readConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Flashback.DatabaseID != "0123" || cfg.Flashback.FlashbackPageID != "on" {
+		t.Errorf("expect env values kept as is in string fields, got %+v", cfg.Flashback)
+	}
+	if cfg.Flashback.FlashbackNum != 7 {
+		t.Errorf("expect env value decoded in an int field, got %v", cfg.Flashback.FlashbackNum)
+	}
+}
+
+func TestReadConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	missing := filepath.Join(dir, "missing.yaml")
+	os.WriteFile(missing, []byte("flashback:\n  databaseID: ${TEST_TOOLSET_UNSET}\n"), 0644)
+	if _, err := readConfig(missing); err == nil {
+		t.Errorf("expected error for unset env variable")
+	}
+
+	cycle := filepath.Join(dir, "cycle.yaml")
+	os.WriteFile(cycle, []byte("include: cycle.yaml\n"), 0644)
+	if _, err := readConfig(cycle); err == nil {
+		t.Errorf("expected error for include cycle")
+	}
+
+	escaped := filepath.Join(dir, "escaped.yaml")
+	os.WriteFile(escaped, []byte("flashback:\n  databaseID: $${NOT_ENV}\n"), 0644)
+	if cfg, err := readConfig(escaped); err != nil || cfg.Flashback.DatabaseID != "${NOT_ENV}" {
+		t.Errorf("expected escaped value, got %+v, err: %v", cfg.Flashback.DatabaseID, err)
+	}
+}
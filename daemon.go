@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/zhuochun/notion-toolset/schedule"
+)
+
+type DaemonJob struct {
+	Name       string        `yaml:"name"`
+	Cmd        string        `yaml:"cmd"`
+	ConfigPath string        `yaml:"configPath"` // path to config file of the job relative to the daemon config, read on every run, or
+	Config     *Config       `yaml:"config"`     // inline config of the job
+	Cron       string        `yaml:"cron"`       // 5 fields cron expression, or @daily, @hourly etc
+	Timezone   string        `yaml:"timezone"`   // optional, default to daemon timezone
+	Jitter     time.Duration `yaml:"jitter"`     // optional, random delay up to this duration, e.g. 5m
+}
+
+type DaemonConfig struct {
+	Timezone string      `yaml:"timezone"` // optional, default to the config timezone
+	Jobs     []DaemonJob `yaml:"jobs"`
+}
+
+type Daemon struct {
+	DebugMode bool
+
+	Env CmdEnv
+	DaemonConfig
+
+	schedules []*schedule.Cron
+	locations []*time.Location
+}
+
+func init() {
+	RegisterCmd(CmdSpec{
+		Name:        "daemon",
+		Description: "Keep running and run jobs of commands by their cron expressions",
+		Section:     "daemon",
+		Config:      DaemonConfig{},
+		New: func(env CmdEnv, cfg Config) (Cmd, error) {
+			return &Daemon{
+				DebugMode:    env.DebugMode,
+				Env:          env,
+				DaemonConfig: cfg.Daemon,
+			}, nil
+		},
+	})
+}
+
+func (d *Daemon) Validate() error {
+	if len(d.Jobs) == 0 {
+		return errors.Join(ErrConfigRequired, fmt.Errorf("set jobs"))
+	}
+
+	defaultLoc := d.Env.Clock.loc() // timezone of the config
+	if d.Timezone != "" {
+		loc, err := time.LoadLocation(d.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone: %w", err)
+		}
+		defaultLoc = loc
+	}
+
+	names := map[string]bool{}
+	for i, job := range d.Jobs {
+		if job.Name == "" {
+			return errors.Join(ErrConfigRequired, fmt.Errorf("set name of job %d", i))
+		}
+		if names[job.Name] {
+			return fmt.Errorf("duplicated job name: %v", job.Name)
+		}
+		names[job.Name] = true
+
+		if _, found := LookupCmd(job.Cmd); !found {
+			return fmt.Errorf("job %v has unknown cmd: `%v`", job.Name, job.Cmd)
+		}
+
+		cron, err := schedule.Parse(job.Cron)
+		if err != nil {
+			return fmt.Errorf("job %v: %w", job.Name, err)
+		}
+		d.schedules = append(d.schedules, cron)
+
+		loc := defaultLoc
+		if job.Timezone != "" {
+			if loc, err = time.LoadLocation(job.Timezone); err != nil {
+				return fmt.Errorf("job %v invalid timezone: %w", job.Name, err)
+			}
+		}
+		d.locations = append(d.locations, loc)
+	}
+
+	return nil
+}
+
+// Run keeps running until ctx is done, running jobs are finished before it returns
+func (d *Daemon) Run(ctx context.Context) error {
+	wg := new(sync.WaitGroup)
+
+	for i := range d.Jobs {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			d.loopJob(ctx, d.Jobs[i], d.schedules[i], d.locations[i])
+		}(i)
+	}
+
+	wg.Wait()
+	log.Printf("Daemon stopped")
+	return nil
+}
+
+// loopJob runs the job one after another, so runs of the same job never overlap.
+// A run that is missed while the previous run is still going is skipped.
+func (d *Daemon) loopJob(ctx context.Context, job DaemonJob, cron *schedule.Cron, loc *time.Location) {
+	for runNum := 1; ; runNum++ {
+		next := cron.Next(time.Now().In(loc))
+		if next.IsZero() {
+			log.Printf("Job %v has no next run, stopped", job.Name)
+			return
+		}
+
+		if job.Jitter > 0 {
+			next = next.Add(time.Duration(rand.Int63n(int64(job.Jitter))))
+		}
+		log.Printf("Job %v next run at %v", job.Name, next)
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		report := NewRunReport(job.Cmd, job.Name)
+		report.Finish(d.RunJob(ctx, job, report))
+		if report.HasError() {
+			log.Printf("Job %v run #%d failed, %v", job.Name, runNum, report)
+		} else {
+			log.Printf("Job %v run #%d succeeded, %v", job.Name, runNum, report)
+		}
+	}
+}
+
+// RunJob creates the cmd with the latest config and runs it once, counts are added to report
+func (d *Daemon) RunJob(ctx context.Context, job DaemonJob, report *RunReport) (err error) {
+	defer func() { // keep the daemon running when a cmd panics
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	configPath := resolveConfigPath(d.Env.ConfigPath, job.ConfigPath)
+	cfg, err := loadCmdConfig(configPath, job.Config)
+	if err != nil {
+		return err
+	}
+
+	env := d.Env
+	env.Report = report
+	env.Job = job.Name
+	if configPath != "" { // paths in the job config are relative to its file
+		env.ConfigPath = configPath
+	}
+	defer func() {
+		if flushErr := env.FlushState(); flushErr != nil {
+			err = errors.Join(err, flushErr)
+		}
+	}()
+
+	cmd, err := NewCmd(job.Cmd, env, cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Validate(); err != nil {
+		return fmt.Errorf("validate: %w", err)
+	}
+
+	ctx, cancel := cmdContext(ctx, cfg)
+	defer cancel()
+
+	return cmd.Run(ctx)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+type testStateCmd struct {
+	state *CmdState
+}
+
+func (c *testStateCmd) Validate() error { return nil }
+func (c *testStateCmd) Run(ctx context.Context) error {
+	return c.state.Put("page-1", "hash-1")
+}
+
+func TestDaemonRunJobSavesState(t *testing.T) {
+	RegisterCmd(CmdSpec{Name: "test-state", New: func(env CmdEnv, cfg Config) (Cmd, error) {
+		return &testStateCmd{state: env.CmdState("test-state", cfg)}, nil
+	}})
+	defer delete(cmdRegistry, "test-state")
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	store, err := OpenFileStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &Daemon{Env: CmdEnv{State: store}}
+	job := DaemonJob{Name: "hourly", Cmd: "test-state"}
+	if err := d.RunJob(t.Context(), job, NewRunReport(job.Cmd, job.Name)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the daemon keeps running, the state is on disk after the job
+	saved, err := OpenFileStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, found := saved.Get("test-state/hourly", "page-1"); !found || entry.Hash != "hash-1" {
+		t.Errorf("expect the state of the job saved, got %+v, found: %v", entry, found)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const dryRunIDPrefix = "dry-run-"
+
+// PlanStep is a Notion mutation intercepted in dry-run mode
+type PlanStep struct {
+	Operation string          `json:"operation"`
+	TargetID  string          `json:"targetID"`
+	Method    string          `json:"method"`
+	Path      string          `json:"path"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	ResultID  string          `json:"resultID,omitempty"` // placeholder ID returned for created objects
+}
+
+// Plan is the list of mutations to be executed by the apply cmd
+type Plan struct {
+	Cmd       string     `json:"cmd"`
+	CreatedAt time.Time  `json:"createdAt"`
+	Steps     []PlanStep `json:"steps"`
+}
+
+// DryRunTransport passes reads to Notion, and records writes into a plan
+type DryRunTransport struct {
+	Base http.RoundTripper
+
+	mu   sync.Mutex
+	plan Plan
+}
+
+func NewDryRunTransport(base http.RoundTripper, cmd string) *DryRunTransport {
+	return &DryRunTransport{
+		Base: base,
+		plan: Plan{Cmd: cmd, CreatedAt: time.Now()},
+	}
+}
+
+var (
+	planPagesRegex         = regexp.MustCompile(`^/v1/pages/?$`)
+	planPageRegex          = regexp.MustCompile(`^/v1/pages/([^/]+)$`)
+	planBlockChildrenRegex = regexp.MustCompile(`^/v1/blocks/([^/]+)/children$`)
+	planBlockRegex         = regexp.MustCompile(`^/v1/blocks/([^/]+)$`)
+	planDatabasesRegex     = regexp.MustCompile(`^/v1/databases/?$`)
+	planDatabaseRegex      = regexp.MustCompile(`^/v1/databases/([^/]+)$`)
+	planQueryRegex         = regexp.MustCompile(`^/v1/(databases/[^/]+/query|search)$`)
+)
+
+// isNotionRead reports requests that do not mutate the workspace
+func isNotionRead(req *http.Request) bool {
+	return req.Method == http.MethodGet || (req.Method == http.MethodPost && planQueryRegex.MatchString(req.URL.Path))
+}
+
+func (t *DryRunTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if isNotionRead(req) {
+		return t.Base.RoundTrip(req)
+	}
+
+	var payload []byte
+	if req.Body != nil {
+		var err error
+		if payload, err = io.ReadAll(req.Body); err != nil {
+			return nil, fmt.Errorf("dry-run read body: %w", err)
+		}
+		req.Body.Close()
+	}
+
+	step := PlanStep{
+		Method:  req.Method,
+		Path:    req.URL.RequestURI(),
+		Payload: json.RawMessage(bytes.TrimSpace(payload)),
+	}
+	if len(step.Payload) == 0 {
+		step.Payload = nil
+	}
+	step.Operation, step.TargetID = planOperation(req.Method, req.URL.Path, payload)
+
+	t.mu.Lock()
+	if step.Operation == "create_page" || step.Operation == "create_database" {
+		step.ResultID = fmt.Sprintf("%v%d", dryRunIDPrefix, len(t.plan.Steps)+1)
+	} else if step.Operation == "append_block_children" && planChildrenCount(step.Payload) > 0 {
+		// the last block appended, to write in or after it, e.g. an anchor heading
+		step.ResultID = fmt.Sprintf("%v%d", dryRunIDPrefix, len(t.plan.Steps)+1)
+	}
+	t.plan.Steps = append(t.plan.Steps, step)
+	t.mu.Unlock()
+
+	return dryRunResponse(req, step), nil
+}
+
+func planOperation(method, path string, payload []byte) (string, string) {
+	switch {
+	case method == http.MethodPost && planPagesRegex.MatchString(path):
+		parent := struct {
+			Parent map[string]interface{} `json:"parent"`
+		}{}
+		json.Unmarshal(payload, &parent)
+		for _, key := range []string{"database_id", "page_id"} {
+			if id, ok := parent.Parent[key].(string); ok {
+				return "create_page", id
+			}
+		}
+		return "create_page", ""
+	case method == http.MethodPatch && planPageRegex.MatchString(path):
+		return "update_page", planPageRegex.FindStringSubmatch(path)[1]
+	case method == http.MethodPatch && planBlockChildrenRegex.MatchString(path):
+		return "append_block_children", planBlockChildrenRegex.FindStringSubmatch(path)[1]
+	case method == http.MethodPatch && planBlockRegex.MatchString(path):
+		return "update_block", planBlockRegex.FindStringSubmatch(path)[1]
+	case method == http.MethodDelete && planBlockRegex.MatchString(path):
+		return "delete_block", planBlockRegex.FindStringSubmatch(path)[1]
+	case method == http.MethodPost && planDatabasesRegex.MatchString(path):
+		return "create_database", ""
+	case method == http.MethodPatch && planDatabaseRegex.MatchString(path):
+		return "update_database", planDatabaseRegex.FindStringSubmatch(path)[1]
+	default:
+		return strings.ToLower(method), ""
+	}
+}
+
+// dryRunResponse fakes a successful Notion response, good enough for go-notion to decode
+func dryRunResponse(req *http.Request, step PlanStep) *http.Response {
+	var body string
+	switch step.Operation {
+	case "create_page", "update_page":
+		id := step.ResultID
+		if id == "" {
+			id = step.TargetID
+		}
+		body = fmt.Sprintf(`{"object":"page","id":%q,"parent":{"type":"workspace","workspace":true},"properties":{}}`, id)
+	case "append_block_children":
+		body = `{"object":"list","results":[],"has_more":false}`
+		if step.ResultID != "" {
+			body = fmt.Sprintf(`{"object":"list","results":[{"object":"block","id":%q,"type":"unsupported","unsupported":{}}],"has_more":false}`, step.ResultID)
+		}
+	case "update_block", "delete_block":
+		body = fmt.Sprintf(`{"object":"block","id":%q,"type":"unsupported","unsupported":{}}`, step.TargetID)
+	case "create_database", "update_database":
+		id := step.ResultID
+		if id == "" {
+			id = step.TargetID
+		}
+		body = fmt.Sprintf(`{"object":"database","id":%q,"properties":{}}`, id)
+	default:
+		body = `{}`
+	}
+
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Status:        "200 OK",
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// Plan returns a copy of the recorded plan
+func (t *DryRunTransport) Plan() Plan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	plan := t.plan
+	plan.Steps = append([]PlanStep{}, t.plan.Steps...)
+	return plan
+}
+
+// Save writes the plan as JSON to path and logs a summary of it
+func (t *DryRunTransport) Save(path string) error {
+	plan := t.Plan()
+
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal plan: %w", err)
+	}
+
+	if err := writeFileAtomicBytes(path, data); err != nil {
+		return fmt.Errorf("write plan: %v, err: %w", path, err)
+	}
+
+	log.Printf("Dry-run plan written to %v\n%v", path, plan.Summary())
+	return nil
+}
+
+// Summary describes the plan in a human readable way
+func (p Plan) Summary() string {
+	var b strings.Builder
+
+	counts := map[string]int{}
+	for _, step := range p.Steps {
+		counts[step.Operation] += 1
+	}
+
+	ops := make([]string, 0, len(counts))
+	for op := range counts {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+
+	fmt.Fprintf(&b, "Planned mutations: %d", len(p.Steps))
+	for _, op := range ops {
+		fmt.Fprintf(&b, ", %v: %d", op, counts[op])
+	}
+	b.WriteString("\n")
+
+	for i, step := range p.Steps {
+		fmt.Fprintf(&b, "  %d. %v -> %v", i+1, step.Operation, step.TargetID)
+		if n := planChildrenCount(step.Payload); n > 0 {
+			fmt.Fprintf(&b, " (%d blocks)", n)
+		}
+		if step.ResultID != "" {
+			fmt.Fprintf(&b, " as %v", step.ResultID)
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+func planChildrenCount(payload json.RawMessage) int {
+	body := struct {
+		Children []json.RawMessage `json:"children"`
+	}{}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return 0
+	}
+	return len(body.Children)
+}
+
+func loadPlan(path string) (Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Plan{}, fmt.Errorf("read plan: %w", err)
+	}
+
+	plan := Plan{}
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return Plan{}, fmt.Errorf("unmarshal plan: %w", err)
+	}
+	return plan, nil
+}
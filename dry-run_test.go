@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func jsonResponse(req *http.Request, body string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}
+}
+
+func TestDryRunTransportRecordsWrites(t *testing.T) {
+	reads := 0
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		reads += 1
+		return jsonResponse(req, `{"object":"list","results":[],"has_more":false}`), nil
+	})
+
+	dryRun := NewDryRunTransport(base, "test")
+	client := notion.NewClient("token", notion.WithHTTPClient(&http.Client{Transport: dryRun}))
+	ctx := context.Background()
+
+	if _, err := client.QueryDatabase(ctx, "db1", nil); err != nil {
+		t.Fatalf("query: %v", err)
+	}
+
+	page, err := client.CreatePage(ctx, notion.CreatePageParams{
+		ParentType:             notion.ParentTypeDatabase,
+		ParentID:               "db1",
+		DatabasePageProperties: &notion.DatabasePageProperties{},
+	})
+	if err != nil {
+		t.Fatalf("create page: %v", err)
+	}
+
+	if _, err := client.AppendBlockChildren(ctx, page.ID, []notion.Block{&notion.DividerBlock{}}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+
+	if reads != 1 {
+		t.Fatalf("expected 1 read passed through, got %v", reads)
+	}
+
+	plan := dryRun.Plan()
+	if len(plan.Steps) != 2 {
+		t.Fatalf("expected 2 steps, got %+v", plan.Steps)
+	}
+	if plan.Steps[0].Operation != "create_page" || plan.Steps[0].TargetID != "db1" || plan.Steps[0].ResultID == "" {
+		t.Fatalf("unexpected create step: %+v", plan.Steps[0])
+	}
+	if plan.Steps[1].Operation != "append_block_children" || plan.Steps[1].TargetID != plan.Steps[0].ResultID || plan.Steps[1].ResultID == "" {
+		t.Fatalf("unexpected append step: %+v", plan.Steps[1])
+	}
+}
+
+func TestPlanApplierReplacesCreatedIDs(t *testing.T) {
+	paths := []string{}
+	a := &PlanApplier{
+		Token: "token",
+		HTTPClient: &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			paths = append(paths, req.Method+" "+req.URL.Path)
+			return jsonResponse(req, `{"object":"page","id":"real-page"}`), nil
+		})},
+	}
+
+	created := map[string]string{}
+	steps := []PlanStep{
+		{Operation: "create_page", Method: http.MethodPost, Path: "/v1/pages", Payload: json.RawMessage(`{}`), ResultID: "dry-run-1"},
+		{Operation: "append_block_children", Method: http.MethodPatch, Path: "/v1/blocks/dry-run-1/children", Payload: json.RawMessage(`{"children":[]}`)},
+	}
+	for _, step := range steps {
+		id, err := a.ApplyStep(context.Background(), step, created)
+		if err != nil {
+			t.Fatalf("apply: %v", err)
+		}
+		if step.ResultID != "" {
+			created[step.ResultID] = id
+		}
+	}
+
+	if paths[1] != "PATCH /v1/blocks/real-page/children" {
+		t.Fatalf("expected placeholder replaced, got %v", paths)
+	}
+}
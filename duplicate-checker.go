@@ -13,55 +13,90 @@ import (
 )
 
 type DuplicateCheckerConfig struct {
-	DatabaseID    string `yaml:"databaseID"`
-	DatabaseQuery string `yaml:"databaseQuery"`
+	DatabaseID    string       `yaml:"databaseID"`
+	DatabaseQuery string       `yaml:"databaseQuery"`
+	Filter        string       `yaml:"filter"` // or a filter instead, e.g. `Status != Archived`
+	Sort          string       `yaml:"sort"`   // optional, sorts of the filter
+	Search        *SearchSpec  `yaml:"search"` // or search the workspace instead, to check across databases
+	Source        SourceConfig `yaml:"source"` // or any source, e.g. databaseIDs, rootPageID, file, overrides the above
 	// CheckProperties specifies property names used to detect duplicates.
 	// A page is considered a duplicate when any of the listed property
 	// values matches another page's value (OR semantics). If the slice is
 	// empty, page titles are used. Empty or nil property values are ignored.
-	CheckProperties        []string `yaml:"checkProperties"`
-	BrokenURLProperty      string   `yaml:"brokenURLproperty"`
-	DuplicateDumpID        string   `yaml:"duplicateDumpID"`
-	DuplicateDumpTextBlock string   `yaml:"duplicateDumpTextBlock"` // Format https://pkg.go.dev/github.com/dstotijn/go-notion#ParagraphBlock
+	CheckProperties        []string    `yaml:"checkProperties"`
+	BrokenURLProperty      string      `yaml:"brokenURLproperty"`
+	DuplicateDumpID        string      `yaml:"duplicateDumpID"`
+	DuplicateDumpTextBlock string      `yaml:"duplicateDumpTextBlock"` // Format https://pkg.go.dev/github.com/dstotijn/go-notion#ParagraphBlock
+	DuplicateDumpAnchor    WriteAnchor `yaml:"duplicateDumpAnchor"`    // optional, where to write in the dump page, e.g. under: "Duplicates"
 	// DuplicateDumpBlock string   `yaml:"duplicateDumpBlock"` // DEPRECATED (2023-12) use duplicateDumpTextBlock
 }
 
 type DuplicateChecker struct {
 	DebugMode bool
 
-	Client *notion.Client
+	Client NotionAPI
+	Report *RunReport
+	Clock  Clock
+	State  *CmdState
 	DuplicateCheckerConfig
+
+	outputPages []notion.Page
+}
+
+func init() {
+	RegisterCmd(CmdSpec{
+		Name:        "duplicate",
+		Description: "Find duplicated pages (same title) in a database",
+		Section:     "duplicateChecker",
+		Config:      DuplicateCheckerConfig{},
+		New: func(env CmdEnv, cfg Config) (Cmd, error) {
+			return &DuplicateChecker{
+				DebugMode:              env.DebugMode,
+				Client:                 env.Client,
+				Report:                 env.Report,
+				Clock:                  env.Clock,
+				State:                  env.CmdState("duplicate", cfg),
+				DuplicateCheckerConfig: cfg.DuplicateChecker,
+			}, nil
+		},
+	})
 }
 
 func (d *DuplicateChecker) Validate() error {
 	if len(d.DuplicateDumpTextBlock) == 0 {
 		return errors.Join(ErrConfigRequired, fmt.Errorf("set duplicateDumpTextBlock"))
 	}
-	return nil
+	return d.DuplicateDumpAnchor.Validate()
 }
 
-func (d *DuplicateChecker) Run() error {
-	pagesChan, errChan := d.ScanPages()
+func (d *DuplicateChecker) Run(ctx context.Context) error {
+	pagesChan, errChan := d.ScanPages(ctx)
 	pageNum := 0
-	set := map[string]string{}
+	set := map[string]notion.Page{}
 	for pages := range pagesChan {
+		if ctx.Err() != nil { // drain the scanned pages when interrupted
+			continue
+		}
+
 		for _, page := range pages {
 			pageNum += 1
 
 			keys := d.pageKeys(page)
 			if len(keys) != 0 {
 				for _, key := range keys {
-					if id, ok := set[key]; ok {
-						d.WriteBlock(page.ID)
-						d.WriteBlock(id)
+					if dup, ok := set[key]; ok {
+						d.DumpPage(ctx, page.ID, key)
+						d.DumpPage(ctx, dup.ID, key)
+						d.outputPages = append(d.outputPages, page, dup)
 					} else {
-						set[key] = page.ID
+						set[key] = page
 					}
 				}
 			}
 
 			if d.brokenURLCheck(page) {
-				d.WriteBlock(page.ID)
+				d.DumpPage(ctx, page.ID, "brokenURL")
+				d.outputPages = append(d.outputPages, page)
 			}
 
 			if d.DebugMode && pageNum%500 == 0 {
@@ -70,41 +105,70 @@ func (d *DuplicateChecker) Run() error {
 		}
 	}
 	log.Printf("Scanned pages: %v, unique keys: %v", pageNum, len(set))
+	d.Report.AddScanned(pageNum)
 
 	select {
 	case err := <-errChan:
 		return err
 	default:
-		return nil
+		return ctx.Err()
 	}
 }
 
-func (d *DuplicateChecker) ScanPages() (chan []notion.Page, chan error) {
-	q := NewDatabaseQuery(d.Client, d.DatabaseID)
+// OutputPages are the duplicated pages and pages with broken URL
+func (d *DuplicateChecker) OutputPages() []notion.Page {
+	return d.outputPages
+}
+
+func (d *DuplicateChecker) ScanPages(ctx context.Context) (chan []notion.Page, chan error) {
+	source := d.Source.Or(SourceConfig{DatabaseID: d.DatabaseID, DatabaseQuery: d.DatabaseQuery, Filter: d.Filter, Sort: d.Sort, Search: d.Search})
 
-	if err := q.SetQuery(d.DatabaseQuery, QueryBuilder{}); err != nil {
-		log.Panicf("Invalid query: %v, err: %v", d.DatabaseQuery, err)
+	src, err := NewPageSource(ctx, d.Client, d.Clock, source, QueryBuilder{})
+	if err != nil {
+		return errPages(err)
 	}
 
 	if d.DebugMode {
-		log.Printf("DatabaseQuery Filter: %+v", q.Query.Filter)
-		log.Printf("DatabaseQuery Sorter: %+v", q.Query.Sorts)
+		logSource(src)
+	}
+	return GoPages(ctx, src, 3)
+}
+
+// DumpPage writes the page to the dump block, and records the result in report.
+// A page dumped for the same reason in an earlier run is skipped.
+func (d *DuplicateChecker) DumpPage(ctx context.Context, pageID, reason string) {
+	hash := contentHash(reason)
+	if entry, found := d.State.Get(pageID); found && entry.Hash == hash {
+		log.Printf("Skip page dumped at %v, id: %v", entry.ProcessedAt.Format(time.RFC3339), pageID)
+		d.Report.AddSkipped(1)
+		return
 	}
 
-	return q.Go(context.TODO(), 3)
+	if _, err := d.WriteBlock(ctx, pageID); err != nil {
+		log.Printf("Failed to write block with PageID: %v, err: %v", pageID, err)
+		d.Report.AddFailed(pageID, err)
+		return
+	}
+	d.Report.AddWritten(1)
+
+	if err := d.State.Put(pageID, hash); err != nil {
+		log.Printf("Failed to save state, id: %v, err: %v", pageID, err)
+	}
 }
 
-func (d *DuplicateChecker) WriteBlock(pageID string) (notion.BlockChildrenResponse, error) {
+func (d *DuplicateChecker) WriteBlock(ctx context.Context, pageID string) (notion.BlockChildrenResponse, error) {
 	w := NewAppendBlock(d.Client, d.DuplicateDumpID)
+	w.Clock = d.Clock
+	w.Anchor = d.DuplicateDumpAnchor
 
 	if err := w.AddParagraph("Duplicate", d.DuplicateDumpTextBlock, BlockBuilder{
-		Date:   time.Now().Format(layoutDate),
+		Date:   d.Clock.Date(time.Now()),
 		PageID: pageID,
 	}); err != nil {
 		return notion.BlockChildrenResponse{}, err
 	}
 
-	return w.Do(context.TODO())
+	return w.Do(ctx)
 }
 
 // pageKeys returns the set of keys for duplicate detection. When no
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/zhuochun/notion-toolset/notiontest"
+)
+
+func TestDuplicateChecker(t *testing.T) {
+	fake := notiontest.New()
+	db := fake.AddDatabase("Notes", nil)
+
+	first := fake.AddPage(notiontest.DatabasePage(db.ID, "same"))
+	fake.AddPage(notiontest.DatabasePage(db.ID, "unique"))
+	second := fake.AddPage(notiontest.DatabasePage(db.ID, "same"))
+	dump := fake.AddPage(notiontest.DatabasePage(db.ID, "dump"))
+
+	cfg := readTestConfig(t, "duplicate.yaml")
+	cfg.DuplicateChecker.DatabaseID = db.ID
+	cfg.DuplicateChecker.DuplicateDumpID = dump.ID
+
+	_, report := runTestCmd(t, "duplicate", fake, cfg)
+
+	if report.Scanned != 4 || report.Written != 2 || report.Failed != 0 {
+		t.Errorf("unexpected report: %v", report)
+	}
+
+	ids := mentionedPages(fake.Children(dump.ID))
+	if len(ids) != 2 || ids[0] != second.ID || ids[1] != first.ID {
+		t.Errorf("expect %v and %v dumped, got %v", second.ID, first.ID, ids)
+	}
+}
+
+func TestDuplicateCheckerPartialFailure(t *testing.T) {
+	fake := notiontest.New()
+	db := fake.AddDatabase("Notes", nil)
+
+	fake.AddPage(notiontest.DatabasePage(db.ID, "same"))
+	fake.AddPage(notiontest.DatabasePage(db.ID, "same"))
+
+	fake.Fail = func(method, id string) error {
+		if method == "AppendBlockChildren" {
+			return &notion.APIError{Status: 400, Code: "validation_error", Message: "body.children should be defined"}
+		}
+		return nil
+	}
+
+	cfg := readTestConfig(t, "duplicate.yaml")
+	cfg.DuplicateChecker.DatabaseID = db.ID
+
+	_, report := runTestCmd(t, "duplicate", fake, cfg)
+
+	if report.Failed != 2 || report.ExitCode() != ExitPartial {
+		t.Errorf("expect 2 failed pages, got report: %v", report)
+	}
+	for _, failure := range report.Failures {
+		if !strings.Contains(failure.Error, "body.children") {
+			t.Errorf("expect validation error recorded, got %+v", failure)
+		}
+	}
+}
+
+func TestDuplicateCheckerState(t *testing.T) {
+	fake := notiontest.New()
+	db := fake.AddDatabase("Notes", nil)
+
+	fake.AddPage(notiontest.DatabasePage(db.ID, "same"))
+	fake.AddPage(notiontest.DatabasePage(db.ID, "same"))
+	dump := fake.AddPage(notiontest.DatabasePage(db.ID, "dump"))
+
+	store, err := OpenFileStateStore(t.TempDir() + "/state.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := CmdEnv{Client: fake, State: store}
+
+	cfg := readTestConfig(t, "duplicate.yaml")
+	cfg.DuplicateChecker.DatabaseID = db.ID
+	cfg.DuplicateChecker.DuplicateDumpID = dump.ID
+
+	runTestCmdEnv(t, "duplicate", env, cfg)
+	_, report := runTestCmdEnv(t, "duplicate", env, cfg)
+
+	if report.Written != 0 || report.Skipped != 2 {
+		t.Errorf("expect dumped pages skipped, got report: %v", report)
+	}
+	if ids := mentionedPages(fake.Children(dump.ID)); len(ids) != 2 {
+		t.Errorf("expect 2 pages dumped once, got %v", ids)
+	}
+}
@@ -5,4 +5,5 @@ import "errors"
 var (
 	ErrConfigDeprecated = errors.New("Config Deprecated")
 	ErrConfigRequired   = errors.New("Config Missing")
+	ErrCmdInvalid       = errors.New("Cmd Invalid")
 )
@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -18,12 +17,15 @@ import (
 	"github.com/dstotijn/go-notion"
 	"github.com/zhuochun/notion-toolset/retry"
 	"github.com/zhuochun/notion-toolset/transformer"
-	"golang.org/x/time/rate"
 )
 
 type ExporterConfig struct {
-	DatabaseID    string `yaml:"databaseID"`
-	DatabaseQuery string `yaml:"databaseQuery"`
+	DatabaseID    string       `yaml:"databaseID"`
+	DatabaseQuery string       `yaml:"databaseQuery"`
+	Filter        string       `yaml:"filter"` // or a filter instead, e.g. `"Edited At" after {{.Date}}`
+	Sort          string       `yaml:"sort"`   // optional, sorts of the filter
+	Search        *SearchSpec  `yaml:"search"` // or search the workspace instead, e.g. editedAfter: "{{.Date}}"
+	Source        SourceConfig `yaml:"source"` // or any source, e.g. databaseIDs, rootPageID, file, overrides the above
 	// export related
 	LookbackDays       int      `yaml:"lookbackDays"`   // leave this empty for full backup
 	Directory          string   `yaml:"directory"`      // output directory
@@ -32,27 +34,50 @@ type ExporterConfig struct {
 	ReplaceTitle       []string `yaml:"replaceTitle"`
 	// transformer
 	Markdown transformer.MarkdownConfig `yaml:"markdown"`
-	// tuning https://developers.notion.com/reference/request-limits
+	// tuning, number of workers, requests to Notion are limited by --notion-rate
 	ExportSpeed float64 `yaml:"exportSpeed"`
 	// debug
-	DebugLimit int  `yaml:"debugLimit"`
-	DebugCache bool `yaml:"debugCache"`
+	DebugLimit int `yaml:"debugLimit"`
 }
 
 type Exporter struct {
 	DebugMode bool
 	ExecOne   string
 
-	Client *notion.Client
+	Client NotionAPI
+	Report *RunReport
+	Clock  Clock
+	Cache  *PageCache
 	ExporterConfig
 
-	queryLimiter *rate.Limiter
+	inputPages  []notion.Page
+	outputPages []notion.Page
 
 	exportPool   chan notion.Page
 	queryPool    chan *transformer.BlockFuture
 	downloadPool chan *transformer.AssetFuture
 }
 
+func init() {
+	RegisterCmd(CmdSpec{
+		Name:        "export",
+		Description: "Export pages from a database into local folders in markdown",
+		Section:     "exporter",
+		Config:      ExporterConfig{},
+		New: func(env CmdEnv, cfg Config) (Cmd, error) {
+			return &Exporter{
+				DebugMode:      env.DebugMode,
+				ExecOne:        env.ExecOne,
+				Client:         env.Client,
+				Report:         env.Report,
+				Clock:          env.Clock,
+				Cache:          env.Cache,
+				ExporterConfig: cfg.Exporter,
+			}, nil
+		},
+	})
+}
+
 func (e *Exporter) Validate() error {
 	// handle execOne special case
 	if e.ExecOne != "" {
@@ -105,26 +130,29 @@ func (e *Exporter) precheckDir(dir string) error {
 	return nil
 }
 
-func (e *Exporter) Run() error {
-	e.queryLimiter = rate.NewLimiter(rate.Limit(e.ExportSpeed), int(e.ExportSpeed))
-
+func (e *Exporter) Run(ctx context.Context) error {
 	// workers to write markdowns
 	exportWg := new(sync.WaitGroup)
-	e.exportPool = e.StartExporter(exportWg, int(e.ExportSpeed))
+	e.exportPool = e.StartExporter(ctx, exportWg, int(e.ExportSpeed))
 	// workers to query content of notion blocks
 	queryWg := new(sync.WaitGroup)
-	e.queryPool = e.StartQuerier(queryWg, int(e.ExportSpeed))
+	e.queryPool = e.StartQuerier(ctx, queryWg, int(e.ExportSpeed))
 	// workers to download assets
 	downloadWg := new(sync.WaitGroup)
-	e.downloadPool = e.StartDownloader(downloadWg, int(e.ExportSpeed)*2)
+	e.downloadPool = e.StartDownloader(ctx, downloadWg, int(e.ExportSpeed)*2)
 
 	// query database pages, queue each pages for export
-	pagesChan, errChan := e.ScanPages()
+	pagesChan, errChan := e.ScanPages(ctx)
 	pageNum := 0
 	for pages := range pagesChan {
 		for _, page := range pages {
+			if ctx.Err() != nil { // stop queueing when interrupted, drain the scanned pages
+				break
+			}
+
 			pageNum += 1
 			e.exportPool <- page
+			e.outputPages = append(e.outputPages, page)
 
 			if e.DebugMode && pageNum%500 == 0 {
 				log.Printf("Scanned pages: %v so far", pageNum)
@@ -132,6 +160,7 @@ func (e *Exporter) Run() error {
 		}
 	}
 	log.Printf("Scanned pages: %v", pageNum)
+	e.Report.AddScanned(pageNum)
 
 	close(e.exportPool)
 	exportWg.Wait()
@@ -146,53 +175,53 @@ func (e *Exporter) Run() error {
 	case err := <-errChan:
 		return err
 	default:
-		return nil
+		return ctx.Err()
 	}
 }
 
-func (e *Exporter) ScanPages() (chan []notion.Page, chan error) {
-	if e.ExecOne != "" {
-		pagesChan := make(chan []notion.Page, 1)
-		errChan := make(chan error, 1)
+func (e *Exporter) SetInputPages(pages []notion.Page) {
+	e.inputPages = pages
+}
 
-		if page, err := e.findPageByIDWithRetry(context.Background(), e.ExecOne); err == nil {
-			pagesChan <- []notion.Page{page}
-		} else {
-			errChan <- err
-		}
+func (e *Exporter) OutputPages() []notion.Page {
+	return e.outputPages
+}
 
+func (e *Exporter) ScanPages(ctx context.Context) (chan []notion.Page, chan error) {
+	if e.inputPages != nil { // pages from an earlier pipeline step
+		pagesChan := make(chan []notion.Page, 1)
+		pagesChan <- e.inputPages
 		close(pagesChan)
-		return pagesChan, errChan
+		return pagesChan, make(chan error, 1)
 	}
 
-	return e.scanDatabasePages()
-}
-
-func (e *Exporter) scanDatabasePages() (chan []notion.Page, chan error) {
-	q := NewDatabaseQuery(e.Client, e.DatabaseID)
+	source := e.Source.Or(SourceConfig{DatabaseID: e.DatabaseID, DatabaseQuery: e.DatabaseQuery, Filter: e.Filter, Sort: e.Sort, Search: e.Search})
+	if e.ExecOne != "" {
+		source = SourceConfig{PageIDs: []string{e.ExecOne}}
+	}
+	if e.DebugLimit > 0 {
+		source.MaxResults = e.DebugLimit
+	}
 
 	date := "" // default
 	if e.LookbackDays > 0 {
-		date = time.Now().AddDate(0, 0, -e.LookbackDays).Format(layoutDate)
+		date = e.Clock.Date(time.Now().AddDate(0, 0, -e.LookbackDays))
 	}
 
-	if err := q.SetQuery(e.DatabaseQuery, QueryBuilder{Date: date}); err != nil {
-		log.Panicf("Invalid query: %v, err: %v", e.DatabaseQuery, err)
-	}
-
-	if e.DebugLimit > 0 {
-		q.Query.PageSize = e.DebugLimit
+	src, err := NewPageSource(ctx, e.Client, e.Clock, source, QueryBuilder{Date: date})
+	if err != nil {
+		return errPages(err)
 	}
 
 	if e.DebugMode {
-		log.Printf("DatabaseQuery Filter: %+v", q.Query.Filter)
-		log.Printf("DatabaseQuery Sorter: %+v", q.Query.Sorts)
+		logSource(src)
 	}
-
-	return q.Go(context.Background(), 1, e.queryLimiter)
+	return GoPages(ctx, src, 1)
 }
 
-func (e *Exporter) StartQuerier(wg *sync.WaitGroup, size int) chan *transformer.BlockFuture {
+// StartQuerier starts workers to query blocks, a task gets an error when ctx is done,
+// so the transformer waiting for it is never blocked
+func (e *Exporter) StartQuerier(ctx context.Context, wg *sync.WaitGroup, size int) chan *transformer.BlockFuture {
 	taskPool := make(chan *transformer.BlockFuture, size)
 
 	for i := 0; i < size; i++ {
@@ -200,7 +229,7 @@ func (e *Exporter) StartQuerier(wg *sync.WaitGroup, size int) chan *transformer.
 
 		go func() {
 			for task := range taskPool {
-				blocks, err := e.QueryBlocks(task.BlockID) // TODO add retry?
+				blocks, err := e.Cache.Lookup(task.PageID).Children(ctx, task.BlockID, e.QueryBlocks)
 				task.Write(blocks, err)
 			}
 			wg.Done()
@@ -210,14 +239,12 @@ func (e *Exporter) StartQuerier(wg *sync.WaitGroup, size int) chan *transformer.
 	return taskPool
 }
 
-func (e *Exporter) QueryBlocks(blockID string) ([]notion.Block, error) {
-	e.queryLimiter.Wait(context.Background())
-
+func (e *Exporter) QueryBlocks(ctx context.Context, blockID string) ([]notion.Block, error) {
 	blocks := []notion.Block{}
 	cursor := ""
 	for {
 		query := &notion.PaginationQuery{StartCursor: cursor}
-		resp, err := e.findBlockChildrenByIDWithRetry(context.TODO(), blockID, query)
+		resp, err := e.findBlockChildrenByIDWithRetry(ctx, blockID, query)
 		if err != nil {
 			return blocks, err
 		}
@@ -231,31 +258,11 @@ func (e *Exporter) QueryBlocks(blockID string) ([]notion.Block, error) {
 		}
 	}
 
-	if e.DebugCache {
-		e.writeDebugCache(blockID, blocks)
-	}
 	return blocks, nil
 }
 
-func (e *Exporter) writeDebugCache(id string, v interface{}) {
-	filename := "temp/" + id + ".json"
-	file, err := os.Create(filename)
-	if err != nil {
-		log.Printf("Failed to create debug cache, name: %v, err: %v", filename, err)
-		return
-	}
-
-	c, err := json.MarshalIndent(v, "", "  ")
-	if err != nil {
-		log.Printf("Failed to marshal debug cache, name: %v, err: %v", filename, err)
-		return
-	}
-
-	file.Write(c)
-	file.Close()
-}
-
-func (e *Exporter) StartExporter(wg *sync.WaitGroup, size int) chan notion.Page {
+// StartExporter starts workers to export pages, queued pages are skipped when ctx is done
+func (e *Exporter) StartExporter(ctx context.Context, wg *sync.WaitGroup, size int) chan notion.Page {
 	taskPool := make(chan notion.Page, size)
 
 	for i := 0; i < size; i++ {
@@ -263,8 +270,13 @@ func (e *Exporter) StartExporter(wg *sync.WaitGroup, size int) chan notion.Page
 
 		go func() {
 			for page := range taskPool {
-				if err := e.exportPage(page); err != nil {
+				if ctx.Err() != nil {
+					continue
+				}
+
+				if err := e.exportPage(ctx, page); err != nil {
 					log.Printf("Failed to export: %v", err)
+					e.Report.AddFailed(page.ID, err)
 				}
 			}
 
@@ -275,44 +287,49 @@ func (e *Exporter) StartExporter(wg *sync.WaitGroup, size int) chan notion.Page
 	return taskPool
 }
 
-func (e *Exporter) exportPage(page notion.Page) error {
-	if e.DebugCache {
-		e.writeDebugCache("page-"+page.ID, page)
-	}
+func (e *Exporter) exportPage(ctx context.Context, page notion.Page) error {
+	cached := e.Cache.Open(page, e.Report)
+	defer func() {
+		if err := cached.Close(); err != nil {
+			log.Printf("Failed to cache page: %v", err)
+		}
+	}()
 
-	blocks, err := e.QueryBlocks(page.ID)
+	blocks, err := cached.Children(ctx, page.ID, e.QueryBlocks)
 	if err != nil {
 		return fmt.Errorf("query block id: %v, err: %v", page.ID, err)
 	}
 
 	filename := e.getExportFilename(page)
-	file, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("create file: %v, err: %v", filename, err)
-	}
-	defer file.Close()
-
 	if e.DebugMode {
 		log.Printf("Exported to file: [%v] -> %v", page.ID, filename)
 	}
 
-	t := transformer.New(e.Markdown, &page, blocks, e.queryPool, e.downloadPool)
-	t.TransformOut(file)
+	if err := writeFileAtomic(filename, func(file *os.File) error {
+		t := transformer.New(e.Markdown, &page, blocks, e.queryPool, e.downloadPool)
+		t.TransformOut(file)
+		return ctx.Err() // sub-blocks are missing when interrupted, keep the existing file
+	}); err != nil {
+		return fmt.Errorf("write file: %v, err: %v", filename, err)
+	}
+	e.Report.AddWritten(1)
 
 	// export sub-pages inside this page
 	for _, block := range blocks {
 		switch b := block.(type) {
 		case *notion.ChildPageBlock:
-			if child, err := e.findPageByIDWithRetry(context.Background(), b.ID()); err == nil {
-				if err := e.exportPage(child); err != nil {
+			if child, err := e.findPageByIDWithRetry(ctx, b.ID()); err == nil {
+				if err := e.exportPage(ctx, child); err != nil {
 					log.Printf("Failed to export sub-page: %v", err)
+					e.Report.AddFailed(child.ID, err)
 				}
 			}
 		case *notion.LinkToPageBlock:
 			if b.PageID != "" {
-				if child, err := e.findPageByIDWithRetry(context.Background(), b.PageID); err == nil {
-					if err := e.exportPage(child); err != nil {
+				if child, err := e.findPageByIDWithRetry(ctx, b.PageID); err == nil {
+					if err := e.exportPage(ctx, child); err != nil {
 						log.Printf("Failed to export sub-page: %v", err)
+						e.Report.AddFailed(child.ID, err)
 					}
 				}
 			}
@@ -338,7 +355,7 @@ func (e *Exporter) getExportFilename(page notion.Page) string {
 	return filename
 }
 
-func (e *Exporter) StartDownloader(wg *sync.WaitGroup, size int) chan *transformer.AssetFuture {
+func (e *Exporter) StartDownloader(ctx context.Context, wg *sync.WaitGroup, size int) chan *transformer.AssetFuture {
 	taskPool := make(chan *transformer.AssetFuture, size)
 
 	for i := 0; i < size; i++ {
@@ -346,7 +363,7 @@ func (e *Exporter) StartDownloader(wg *sync.WaitGroup, size int) chan *transform
 
 		go func() {
 			for asset := range taskPool {
-				filename, err := e.downloadAsset(asset)
+				filename, err := e.downloadAsset(ctx, asset)
 				asset.Write(filename, err)
 
 				if err != nil {
@@ -363,7 +380,7 @@ func (e *Exporter) StartDownloader(wg *sync.WaitGroup, size int) chan *transform
 
 var imgExtension = regexp.MustCompile(`(?i)\.(png|jpe?g|gif|webp)$`)
 
-func (e *Exporter) downloadAsset(asset *transformer.AssetFuture) (string, error) {
+func (e *Exporter) downloadAsset(ctx context.Context, asset *transformer.AssetFuture) (string, error) {
 	if e.AssetDirectory == "" {
 		return "", fmt.Errorf("config assetDirectory is empty")
 	}
@@ -378,13 +395,13 @@ func (e *Exporter) downloadAsset(asset *transformer.AssetFuture) (string, error)
 		return filename, nil
 	}
 
-	file, err := os.Create(filename)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, asset.URL, nil)
 	if err != nil {
-		return filename, fmt.Errorf("create file, name: %v, err: %v", filename, err)
+		return "", err
 	}
-	defer file.Close()
 
-	resp, err := http.Get(asset.URL)
+	assetClient := &http.Client{Transport: newHTTPTransport()}
+	resp, err := assetClient.Do(req)
 	if err != nil {
 		return "", err
 	}
@@ -394,7 +411,10 @@ func (e *Exporter) downloadAsset(asset *transformer.AssetFuture) (string, error)
 		return "", fmt.Errorf("statusCode: %v, URL: %v", resp.StatusCode, asset.URL)
 	}
 
-	if _, err := io.Copy(file, resp.Body); err != nil {
+	if err := writeFileAtomic(filename, func(file *os.File) error {
+		_, err := io.Copy(file, resp.Body)
+		return err
+	}); err != nil {
 		return filename, fmt.Errorf("write file, URL: %v, err: %v", asset.URL, err)
 	}
 
@@ -407,7 +427,7 @@ func (e *Exporter) getAssetFilename(asset *transformer.AssetFuture) string {
 
 func (e *Exporter) findPageByIDWithRetry(ctx context.Context, pageID string) (notion.Page, error) {
 	var page notion.Page
-	err := retry.Do(func() error {
+	err := retry.Do(ctx, func(ctx context.Context) error {
 		var innerErr error
 		page, innerErr = e.Client.FindPageByID(ctx, pageID)
 		return innerErr
@@ -417,7 +437,7 @@ func (e *Exporter) findPageByIDWithRetry(ctx context.Context, pageID string) (no
 
 func (e *Exporter) findBlockChildrenByIDWithRetry(ctx context.Context, blockID string, query *notion.PaginationQuery) (notion.BlockChildrenResponse, error) {
 	var resp notion.BlockChildrenResponse
-	err := retry.Do(func() error {
+	err := retry.Do(ctx, func(ctx context.Context) error {
 		var innerErr error
 		resp, innerErr = e.Client.FindBlockChildrenByID(ctx, blockID, query)
 		return innerErr
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/dstotijn/go-notion"
+	"github.com/zhuochun/notion-toolset/notiontest"
 	"github.com/zhuochun/notion-toolset/transformer"
 )
 
@@ -16,7 +21,7 @@ func TestDownloadAssetUnsupportedExtension(t *testing.T) {
 
 	asset := transformer.NewAssetFuture("1", "http://example.com/file.txt")
 
-	filename, err := e.downloadAsset(asset)
+	filename, err := e.downloadAsset(t.Context(), asset)
 	if err == nil || !strings.Contains(err.Error(), "unsupported extension") {
 		t.Fatalf("expected unsupported extension error, got %v", err)
 	}
@@ -36,7 +41,7 @@ func TestDownloadAssetSupportedExtension(t *testing.T) {
 	e := &Exporter{ExporterConfig: ExporterConfig{AssetDirectory: tmpDir}}
 	asset := transformer.NewAssetFuture("1", server.URL+"/img.png")
 
-	filename, err := e.downloadAsset(asset)
+	filename, err := e.downloadAsset(t.Context(), asset)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -47,3 +52,79 @@ func TestDownloadAssetSupportedExtension(t *testing.T) {
 		t.Fatalf("expected file to exist: %v", err)
 	}
 }
+
+func TestExporter(t *testing.T) {
+	fake := notiontest.New()
+	db := fake.AddDatabase("Notes", notion.DatabaseProperties{
+		"Created At": {Type: notion.DBPropTypeCreatedTime},
+		"Edited At":  {Type: notion.DBPropTypeLastEditedTime},
+	})
+
+	page := fake.AddPage(notiontest.DatabasePage(db.ID, "Exported"),
+		notiontest.Paragraph("Hello export"),
+		&notion.ToggleBlock{RichText: notiontest.RichText("More"), Children: []notion.Block{notiontest.Paragraph("Nested line")}},
+	)
+
+	cfg := readTestConfig(t, "export.yaml")
+	cfg.Exporter.DatabaseID = db.ID
+	cfg.Exporter.Directory = t.TempDir()
+
+	_, report := runTestCmd(t, "export", fake, cfg)
+
+	if report.Scanned != 1 || report.Written != 1 || report.Failed != 0 {
+		t.Errorf("unexpected report: %v", report)
+	}
+
+	content, err := os.ReadFile(filepath.Join(cfg.Exporter.Directory, transformer.SimpleID(page.ID)+".md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"# Exported", "Hello export", "Nested line"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("expect %q in export, got:\n%s", want, content)
+		}
+	}
+}
+
+func TestExporterInterrupted(t *testing.T) {
+	fake := notiontest.New()
+	db := fake.AddDatabase("Notes", nil)
+	page := fake.AddPage(notiontest.DatabasePage(db.ID, "Exported"),
+		&notion.ToggleBlock{RichText: notiontest.RichText("More"), Children: []notion.Block{notiontest.Paragraph("Nested line")}},
+	)
+	toggleID := fake.Children(page.ID)[0].ID()
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, transformer.SimpleID(page.ID)+".md")
+	os.WriteFile(filename, []byte("previous export"), 0644)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	fake.Fail = func(method, id string) error {
+		if method == "FindBlockChildrenByID" && id == toggleID { // interrupted while loading sub-blocks
+			cancel()
+			return ctx.Err()
+		}
+		return nil
+	}
+
+	cmd, err := NewCmd("export", CmdEnv{Client: fake}, Config{Exporter: ExporterConfig{DatabaseID: db.ID, Directory: dir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cmd.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expect canceled, got %v", err)
+	}
+
+	if content, _ := os.ReadFile(filename); string(content) != "previous export" {
+		t.Errorf("expect previous export kept, got:\n%s", content)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Errorf("expect no temp files left, got %v", files)
+	}
+}
@@ -0,0 +1,437 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+)
+
+// Compile parses the filter expression and compiles it by the property types of the
+// database schema. Relative dates like -7d are resolved from now.
+func Compile(s string, schema notion.DatabaseProperties, now time.Time) (*notion.DatabaseQueryFilter, error) {
+	expr, err := Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	c := compiler{expr: s, schema: schema, now: now}
+	return c.compile(expr)
+}
+
+// CompileSorts parses the sort expression and resolves its properties in the schema,
+// `created_time` and `last_edited_time` sort by the page timestamps
+func CompileSorts(s string, schema notion.DatabaseProperties) ([]notion.DatabaseQuerySort, error) {
+	sorts, err := ParseSorts(s)
+	if err != nil {
+		return nil, err
+	}
+
+	c := compiler{expr: s, schema: schema}
+	result := []notion.DatabaseQuerySort{}
+	for _, item := range sorts {
+		sort := notion.DatabaseQuerySort{Direction: notion.SortDirAsc}
+		if item.Descending {
+			sort.Direction = notion.SortDirDesc
+		}
+
+		if name, _, found := c.property(item.Property); found {
+			sort.Property = name
+		} else if isTimestamp(item.Property) {
+			sort.Timestamp = notion.SortTimestamp(item.Property)
+		} else {
+			return nil, c.unknownProperty(item.Property, item.Pos)
+		}
+		result = append(result, sort)
+	}
+	return result, nil
+}
+
+type compiler struct {
+	expr   string
+	schema notion.DatabaseProperties
+	now    time.Time
+}
+
+func (c compiler) errorf(pos int, format string, args ...interface{}) error {
+	return &Error{Expr: c.expr, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (c compiler) compile(expr Expr) (*notion.DatabaseQueryFilter, error) {
+	if expr.Op == "" {
+		return c.compileCond(expr.Cond)
+	}
+
+	filters := []notion.DatabaseQueryFilter{}
+	for _, arg := range expr.Args {
+		f, err := c.compile(arg)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, *f)
+	}
+
+	if expr.Op == "and" {
+		return &notion.DatabaseQueryFilter{And: filters}, nil
+	}
+	return &notion.DatabaseQueryFilter{Or: filters}, nil
+}
+
+// property finds a property in the schema by name, case insensitive if not exact
+func (c compiler) property(name string) (string, notion.DatabaseProperty, bool) {
+	if prop, found := c.schema[name]; found {
+		return name, prop, true
+	}
+	for n, prop := range c.schema {
+		if strings.EqualFold(n, name) {
+			return n, prop, true
+		}
+	}
+	return "", notion.DatabaseProperty{}, false
+}
+
+func (c compiler) unknownProperty(name string, pos int) error {
+	names := make([]string, 0, len(c.schema))
+	for n := range c.schema {
+		names = append(names, fmt.Sprintf("%q", n))
+	}
+	sort.Strings(names)
+	return c.errorf(pos, "unknown property %q, the database has %v", name, strings.Join(names, ", "))
+}
+
+func isTimestamp(name string) bool {
+	return name == notion.TimestampCreatedTime || name == notion.TimestampLastEditedTime
+}
+
+func (c compiler) compileCond(cond Cond) (*notion.DatabaseQueryFilter, error) {
+	name, prop, found := c.property(cond.Property)
+	if !found {
+		if !isTimestamp(cond.Property) {
+			return nil, c.unknownProperty(cond.Property, cond.Pos)
+		}
+
+		date, err := c.dateFilter(cond)
+		if err != nil {
+			return nil, err
+		}
+		f := &notion.DatabaseQueryFilter{Timestamp: notion.Timestamp(cond.Property)}
+		if cond.Property == notion.TimestampCreatedTime {
+			f.CreatedTime = date
+		} else {
+			f.LastEditedTime = date
+		}
+		return f, nil
+	}
+
+	f := &notion.DatabaseQueryFilter{Property: name}
+	var err error
+	switch prop.Type {
+	case notion.DBPropTypeTitle:
+		f.Title, err = c.textFilter(cond)
+	case notion.DBPropTypeRichText:
+		f.RichText, err = c.textFilter(cond)
+	case notion.DBPropTypeURL:
+		f.URL, err = c.textFilter(cond)
+	case notion.DBPropTypeEmail:
+		f.Email, err = c.textFilter(cond)
+	case notion.DBPropTypePhoneNumber:
+		f.PhoneNumber, err = c.textFilter(cond)
+	case notion.DBPropTypeDate:
+		f.Date, err = c.dateFilter(cond)
+	case notion.DBPropTypeCreatedTime:
+		f.CreatedTime, err = c.dateFilter(cond)
+	case notion.DBPropTypeLastEditedTime:
+		f.LastEditedTime, err = c.dateFilter(cond)
+	case notion.DBPropTypeNumber:
+		f.Number, err = c.numberFilter(cond)
+	case notion.DBPropTypeCheckbox:
+		f.Checkbox, err = c.checkboxFilter(cond)
+	case notion.DBPropTypeSelect:
+		var o option
+		if o, err = c.optionFilter(cond); err == nil {
+			f.Select = &notion.SelectDatabaseQueryFilter{Equals: o.equals, DoesNotEqual: o.notEquals, IsEmpty: o.isEmpty, IsNotEmpty: o.isNotEmpty}
+		}
+	case notion.DBPropTypeStatus:
+		var o option
+		if o, err = c.optionFilter(cond); err == nil {
+			f.Status = &notion.StatusDatabaseQueryFilter{Equals: o.equals, DoesNotEqual: o.notEquals, IsEmpty: o.isEmpty, IsNotEmpty: o.isNotEmpty}
+		}
+	case notion.DBPropTypeMultiSelect, notion.DBPropTypeRelation, notion.DBPropTypePeople,
+		notion.DBPropTypeCreatedBy, notion.DBPropTypeLastEditedBy:
+		var o option
+		if o, err = c.containsFilter(cond); err != nil {
+			break
+		}
+		switch prop.Type {
+		case notion.DBPropTypeMultiSelect:
+			f.MultiSelect = &notion.MultiSelectDatabaseQueryFilter{Contains: o.equals, DoesNotContain: o.notEquals, IsEmpty: o.isEmpty, IsNotEmpty: o.isNotEmpty}
+		case notion.DBPropTypeRelation:
+			f.Relation = &notion.RelationDatabaseQueryFilter{Contains: o.equals, DoesNotContain: o.notEquals, IsEmpty: o.isEmpty, IsNotEmpty: o.isNotEmpty}
+		default:
+			people := &notion.PeopleDatabaseQueryFilter{Contains: o.equals, DoesNotContain: o.notEquals, IsEmpty: o.isEmpty, IsNotEmpty: o.isNotEmpty}
+			switch prop.Type {
+			case notion.DBPropTypePeople:
+				f.People = people
+			case notion.DBPropTypeCreatedBy:
+				f.CreatedBy = people
+			default:
+				f.LastEditedBy = people
+			}
+		}
+	case notion.DBPropTypeFiles:
+		var o option
+		if o, err = c.emptyFilter(cond); err == nil {
+			f.Files = &notion.FilesDatabaseQueryFilter{IsEmpty: o.isEmpty, IsNotEmpty: o.isNotEmpty}
+		}
+	default:
+		err = c.errorf(cond.Pos, "%v property %q is not supported in filter, use databaseQuery", prop.Type, name)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (c compiler) unsupported(cond Cond, kind string) error {
+	return c.errorf(cond.Pos, "operator %v is not supported by %v property %q", cond.Operator, kind, cond.Property)
+}
+
+// required checks the value is not empty, Notion ignores empty values
+func (c compiler) required(cond Cond) error {
+	if cond.Value == "" {
+		return c.errorf(cond.Pos, "empty value of %q, use is empty instead", cond.Property)
+	}
+	return nil
+}
+
+func (c compiler) textFilter(cond Cond) (*notion.TextPropertyFilter, error) {
+	f := &notion.TextPropertyFilter{}
+	switch cond.Operator {
+	case "is empty":
+		f.IsEmpty = true
+		return f, nil
+	case "is not empty":
+		f.IsNotEmpty = true
+		return f, nil
+	}
+
+	if err := c.required(cond); err != nil {
+		return nil, err
+	}
+	switch cond.Operator {
+	case "=":
+		f.Equals = cond.Value
+	case "!=":
+		f.DoesNotEqual = cond.Value
+	case "contains":
+		f.Contains = cond.Value
+	case "not contains":
+		f.DoesNotContain = cond.Value
+	case "starts_with":
+		f.StartsWith = cond.Value
+	case "ends_with":
+		f.EndsWith = cond.Value
+	default:
+		return nil, c.unsupported(cond, "text")
+	}
+	return f, nil
+}
+
+func (c compiler) numberFilter(cond Cond) (*notion.NumberDatabaseQueryFilter, error) {
+	f := &notion.NumberDatabaseQueryFilter{}
+	switch cond.Operator {
+	case "is empty":
+		f.IsEmpty = true
+		return f, nil
+	case "is not empty":
+		f.IsNotEmpty = true
+		return f, nil
+	}
+
+	n, err := strconv.Atoi(cond.Value)
+	if err != nil {
+		return nil, c.errorf(cond.Pos, "invalid integer %q of number property %q", cond.Value, cond.Property)
+	}
+	switch cond.Operator {
+	case "=":
+		f.Equals = &n
+	case "!=":
+		f.DoesNotEqual = &n
+	case ">":
+		f.GreaterThan = &n
+	case ">=":
+		f.GreaterThanOrEqualTo = &n
+	case "<":
+		f.LessThan = &n
+	case "<=":
+		f.LessThanOrEqualTo = &n
+	default:
+		return nil, c.unsupported(cond, "number")
+	}
+	return f, nil
+}
+
+func (c compiler) checkboxFilter(cond Cond) (*notion.CheckboxDatabaseQueryFilter, error) {
+	v, err := strconv.ParseBool(cond.Value)
+	if err != nil {
+		return nil, c.errorf(cond.Pos, "invalid value %q of checkbox property %q, use true or false", cond.Value, cond.Property)
+	}
+
+	switch cond.Operator {
+	case "=":
+		return &notion.CheckboxDatabaseQueryFilter{Equals: &v}, nil
+	case "!=":
+		return &notion.CheckboxDatabaseQueryFilter{DoesNotEqual: &v}, nil
+	}
+	return nil, c.unsupported(cond, "checkbox")
+}
+
+// option is the common conditions of select, status, multi_select, relation and people
+type option struct {
+	equals, notEquals   string // or contains, does not contain
+	isEmpty, isNotEmpty bool
+}
+
+func (c compiler) emptyFilter(cond Cond) (option, error) {
+	switch cond.Operator {
+	case "is empty":
+		return option{isEmpty: true}, nil
+	case "is not empty":
+		return option{isNotEmpty: true}, nil
+	}
+	return option{}, c.unsupported(cond, "files")
+}
+
+func (c compiler) optionFilter(cond Cond) (option, error) {
+	if o, err := c.emptyFilter(cond); err == nil {
+		return o, nil
+	}
+
+	if err := c.required(cond); err != nil {
+		return option{}, err
+	}
+	switch cond.Operator {
+	case "=":
+		return option{equals: cond.Value}, nil
+	case "!=":
+		return option{notEquals: cond.Value}, nil
+	}
+	return option{}, c.unsupported(cond, "select")
+}
+
+func (c compiler) containsFilter(cond Cond) (option, error) {
+	if o, err := c.emptyFilter(cond); err == nil {
+		return o, nil
+	}
+
+	if err := c.required(cond); err != nil {
+		return option{}, err
+	}
+	switch cond.Operator {
+	case "contains":
+		return option{equals: cond.Value}, nil
+	case "not contains":
+		return option{notEquals: cond.Value}, nil
+	}
+	return option{}, c.unsupported(cond, "multi value")
+}
+
+func (c compiler) dateFilter(cond Cond) (*notion.DatePropertyFilter, error) {
+	f := &notion.DatePropertyFilter{}
+	switch cond.Operator {
+	case "is empty":
+		f.IsEmpty = true
+		return f, nil
+	case "is not empty":
+		f.IsNotEmpty = true
+		return f, nil
+	case "is past_week":
+		f.PastWeek = &struct{}{}
+		return f, nil
+	case "is past_month":
+		f.PastMonth = &struct{}{}
+		return f, nil
+	case "is past_year":
+		f.PastYear = &struct{}{}
+		return f, nil
+	case "is next_week":
+		f.NextWeek = &struct{}{}
+		return f, nil
+	case "is next_month":
+		f.NextMonth = &struct{}{}
+		return f, nil
+	case "is next_year":
+		f.NextYear = &struct{}{}
+		return f, nil
+	}
+
+	t, err := ParseDate(cond.Value, c.now)
+	if err != nil {
+		return nil, c.errorf(cond.Pos, "invalid date of %q: %v", cond.Property, err)
+	}
+	switch cond.Operator {
+	case "=":
+		f.Equals = &t
+	case "before", "<":
+		f.Before = &t
+	case "after", ">":
+		f.After = &t
+	case "on_or_before", "<=":
+		f.OnOrBefore = &t
+	case "on_or_after", ">=":
+		f.OnOrAfter = &t
+	default:
+		return nil, c.unsupported(cond, "date")
+	}
+	return f, nil
+}
+
+var relativeDateRegex = regexp.MustCompile(`^([+-]\d+)([hdwmy])$`)
+
+// ParseDate parses a date of a filter: today, yesterday, tomorrow, now, relative to now
+// like -7d, +2w, -1m, -1y, -6h, a date like 2024-01-02, or a RFC3339 time. Dates are
+// the start of the day in the timezone of now, i.e. the timezone of the config.
+func ParseDate(s string, now time.Time) (time.Time, error) {
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+
+	switch strings.ToLower(s) {
+	case "now":
+		return now, nil
+	case "today":
+		return today, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), nil
+	}
+
+	if match := relativeDateRegex.FindStringSubmatch(s); match != nil {
+		n, _ := strconv.Atoi(match[1])
+		switch match[2] {
+		case "h":
+			return now.Add(time.Duration(n) * time.Hour), nil
+		case "d":
+			return today.AddDate(0, 0, n), nil
+		case "w":
+			return today.AddDate(0, 0, 7*n), nil
+		case "m":
+			return today.AddDate(0, n, 0), nil
+		default:
+			return today.AddDate(n, 0, 0), nil
+		}
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", s, now.Location()); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("unknown date %q, use today, -7d, 2024-01-02 or RFC3339", s)
+}
@@ -0,0 +1,141 @@
+package filter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+)
+
+var schema = notion.DatabaseProperties{
+	"Name":      {Type: notion.DBPropTypeTitle},
+	"Tags":      {Type: notion.DBPropTypeMultiSelect},
+	"Status":    {Type: notion.DBPropTypeStatus},
+	"Edited At": {Type: notion.DBPropTypeLastEditedTime},
+	"Due":       {Type: notion.DBPropTypeDate},
+	"Points":    {Type: notion.DBPropTypeNumber},
+	"Done":      {Type: notion.DBPropTypeCheckbox},
+	"Formula":   {Type: notion.DBPropTypeFormula},
+}
+
+var now = time.Date(2024, 3, 10, 15, 4, 5, 0, time.UTC)
+
+func compileJSON(t *testing.T, s string) string {
+	t.Helper()
+
+	f, err := Compile(s, schema, now)
+	if err != nil {
+		t.Fatalf("compile %q: %v", s, err)
+	}
+	data, _ := json.Marshal(f)
+	return string(data)
+}
+
+func TestCompile(t *testing.T) {
+	cases := []struct {
+		expr string
+		want string
+	}{
+		{`Tags contains "Work"`, `{"property":"Tags","multi_select":{"contains":"Work"}}`},
+		{`status != Done`, `{"property":"Status","status":{"does_not_equal":"Done"}}`},
+		{`"Edited At" after -7d`, `{"property":"Edited At","last_edited_time":{"after":"2024-03-03T00:00:00Z"}}`},
+		{`Due <= 2024-01-02`, `{"property":"Due","date":{"on_or_before":"2024-01-02T00:00:00Z"}}`},
+		{`Due is not empty`, `{"property":"Due","date":{"is_not_empty":true}}`},
+		{`Due is past_week`, `{"property":"Due","date":{"past_week":{}}}`},
+		{`Points >= 3`, `{"property":"Points","number":{"greater_than_or_equal_to":3}}`},
+		{`Done = false`, `{"property":"Done","checkbox":{"equals":false}}`},
+		{`Name not contains "\"draft\""`, `{"property":"Name","title":{"does_not_contain":"\"draft\""}}`},
+		{`created_time on_or_after yesterday`, `{"created_time":{"on_or_after":"2024-03-09T00:00:00Z"},"timestamp":"created_time"}`},
+		{
+			`Tags contains Work and (Status = Doing or Status = Review) and Done = false`,
+			`{"and":[{"property":"Tags","multi_select":{"contains":"Work"}},{"or":[{"property":"Status","status":{"equals":"Doing"}},{"property":"Status","status":{"equals":"Review"}}]},{"property":"Done","checkbox":{"equals":false}}]}`,
+		},
+		{
+			`Name = a or Name = b and Done = true`,
+			`{"or":[{"property":"Name","title":{"equals":"a"}},{"and":[{"property":"Name","title":{"equals":"b"}},{"property":"Done","checkbox":{"equals":true}}]}]}`,
+		},
+	}
+
+	for _, c := range cases {
+		if got := compileJSON(t, c.expr); got != c.want {
+			t.Errorf("Compile(%q)\n got: %v\nwant: %v", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	cases := []struct {
+		expr string
+		want string
+	}{
+		{`Tags contains`, `expect a value after contains, got end`},
+		{`Tags "Work"`, `expect an operator after Tags`},
+		{`Unknown = 1`, `unknown property "Unknown", the database has "Done", "Due"`},
+		{`Points > 1.5`, `invalid integer "1.5" of number property "Points", at column 1`},
+		{`Tags = Work`, `operator = is not supported by multi value property "Tags"`},
+		{`Due after someday`, `invalid date of "Due"`},
+		{`Name = "open`, `unterminated string, at column 8`},
+		{`(Done = true`, `expect ) at end`},
+		{`Done = true Name = a`, `expect and, or at Name, at column 13`},
+		{`Formula = 1`, `formula property "Formula" is not supported`},
+		{`Due is not past_week`, `expect empty, not empty, past_week etc after is`},
+	}
+
+	for _, c := range cases {
+		_, err := Compile(c.expr, schema, now)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("Compile(%q) err = %v, want %q", c.expr, err, c.want)
+		}
+	}
+}
+
+func TestCompileSorts(t *testing.T) {
+	sorts, err := CompileSorts(`-"Edited At", name, Points desc, +created_time`, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := json.Marshal(sorts)
+	want := `[{"property":"Edited At","direction":"descending"},{"property":"Name","direction":"ascending"},` +
+		`{"property":"Points","direction":"descending"},{"timestamp":"created_time","direction":"ascending"}]`
+	if string(data) != want {
+		t.Errorf("CompileSorts\n got: %s\nwant: %v", data, want)
+	}
+
+	if _, err := CompileSorts(`Name Points`, schema); err == nil || !strings.Contains(err.Error(), "expect , between sorts") {
+		t.Errorf("expect missing comma error, got %v", err)
+	}
+	if _, err := CompileSorts(`-Unknown`, schema); err == nil || !strings.Contains(err.Error(), `unknown property "Unknown"`) {
+		t.Errorf("expect unknown property error, got %v", err)
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	cases := map[string]string{
+		"today":                "2024-03-10T00:00:00Z",
+		"-1m":                  "2024-02-10T00:00:00Z",
+		"+2w":                  "2024-03-24T00:00:00Z",
+		"-6h":                  "2024-03-10T09:04:05Z",
+		"2024-01-02T10:00:00Z": "2024-01-02T10:00:00Z",
+	}
+
+	for s, want := range cases {
+		got, err := ParseDate(s, now)
+		if err != nil || got.Format(time.RFC3339) != want {
+			t.Errorf("ParseDate(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+
+	sgt := time.FixedZone("SGT", 8*60*60)
+	for s, want := range map[string]string{
+		"-1d":        "2024-03-09T00:00:00+08:00",
+		"2024-01-02": "2024-01-02T00:00:00+08:00",
+	} {
+		got, err := ParseDate(s, now.In(sgt))
+		if err != nil || got.Format(time.RFC3339) != want {
+			t.Errorf("ParseDate(%q) in SGT = %v, %v, want %v", s, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+// Package filter compiles human-friendly filter and sort expressions into Notion
+// database queries, e.g.
+//
+//	Tags contains "Work" and "Edited At" after -7d and Status != Done
+//	-"Created At", Title
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Expr is a parsed filter expression, either a compound of Args or a Cond
+type Expr struct {
+	Op   string // "and", "or", or "" for a condition
+	Args []Expr
+	Cond Cond
+}
+
+// Cond is a condition on a property, e.g. `Status != Done`
+type Cond struct {
+	Property string
+	Operator string // =, !=, >, >=, <, <=, contains, not contains, starts_with, ends_with,
+	// before, after, on_or_before, on_or_after, is empty, is not empty, is past_week etc
+	Value string // empty for `is` operators
+	Pos   int    // offset of the condition in the expression
+}
+
+// Error is an error at a position of an expression
+type Error struct {
+	Expr string
+	Pos  int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	if e.Pos >= len(e.Expr) {
+		return fmt.Sprintf("%v, at the end of %q", e.Msg, e.Expr)
+	}
+
+	near := e.Expr[e.Pos:]
+	if len(near) > 20 {
+		near = near[:20] + "..."
+	}
+	return fmt.Sprintf("%v, at column %d near %q", e.Msg, e.Pos+1, near)
+}
+
+type tokenKind int
+
+const (
+	tokenEOF    tokenKind = iota
+	tokenWord             // bare word, e.g. Done, -7d, 2024-01-02, and
+	tokenString           // quoted string
+	tokenOp               // = != > >= < <=
+	tokenPunct            // ( ) ,
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end"
+	case tokenString:
+		return fmt.Sprintf("%q", t.text)
+	default:
+		return t.text
+	}
+}
+
+// is reports a word matching the keyword, case insensitive
+func (t token) is(keyword string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+func lex(s string) ([]token, error) {
+	tokens := []token{}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, &Error{Expr: s, Pos: i, Msg: "unterminated string"}
+			}
+			tokens = append(tokens, token{tokenString, b.String(), i})
+			i = j + 1
+		case c == '(' || c == ')' || c == ',':
+			tokens = append(tokens, token{tokenPunct, string(c), i})
+			i++
+		case c == '=' || c == '!' || c == '<' || c == '>':
+			op := string(c)
+			if i+1 < len(s) && s[i+1] == '=' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, &Error{Expr: s, Pos: i, Msg: "unexpected !, use != or not contains"}
+			}
+			tokens = append(tokens, token{tokenOp, op, i})
+			i += len(op)
+		default:
+			j := i
+			for ; j < len(s) && !strings.ContainsRune(" \t\n\r\"(),=!<>", rune(s[j])); j++ {
+			}
+			tokens = append(tokens, token{tokenWord, s[i:j], i})
+			i = j
+		}
+	}
+
+	return append(tokens, token{tokenEOF, "", len(s)}), nil
+}
+
+type parser struct {
+	expr   string
+	tokens []token
+	i      int
+}
+
+func (p *parser) peek() token { return p.tokens[p.i] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokenEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return &Error{Expr: p.expr, Pos: t.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Parse a filter expression. Conditions are joined by `and`, `or` and grouped by
+// parentheses, `and` binds tighter than `or`.
+func Parse(s string) (Expr, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return Expr{}, err
+	}
+
+	p := &parser{expr: s, tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return Expr{}, p.errorf(p.peek(), "empty filter")
+	}
+
+	expr, err := p.parseOr()
+	if err != nil {
+		return Expr{}, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return Expr{}, p.errorf(t, "expect and, or at %v", t)
+	}
+	return expr, nil
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	return p.parseJoined("or", p.parseAnd)
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	return p.parseJoined("and", p.parsePrimary)
+}
+
+// parseJoined parses operands joined by the keyword op into a flat compound
+func (p *parser) parseJoined(op string, operand func() (Expr, error)) (Expr, error) {
+	first, err := operand()
+	if err != nil {
+		return Expr{}, err
+	}
+
+	args := []Expr{first}
+	for p.peek().is(op) {
+		p.next()
+
+		arg, err := operand()
+		if err != nil {
+			return Expr{}, err
+		}
+		if arg.Op == op { // (a and b) and c
+			args = append(args, arg.Args...)
+		} else {
+			args = append(args, arg)
+		}
+	}
+
+	if len(args) == 1 {
+		return first, nil
+	}
+	return Expr{Op: op, Args: args}, nil
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	if t := p.peek(); t.kind == tokenPunct && t.text == "(" {
+		p.next()
+
+		expr, err := p.parseOr()
+		if err != nil {
+			return Expr{}, err
+		}
+		if t := p.next(); t.kind != tokenPunct || t.text != ")" {
+			return Expr{}, p.errorf(t, "expect ) at %v", t)
+		}
+		return expr, nil
+	}
+
+	cond, err := p.parseCond()
+	return Expr{Cond: cond}, err
+}
+
+var wordOperators = map[string]bool{
+	"contains": true, "starts_with": true, "ends_with": true,
+	"before": true, "after": true, "on_or_before": true, "on_or_after": true,
+}
+
+var isOperators = map[string]bool{
+	"empty": true, "past_week": true, "past_month": true, "past_year": true,
+	"next_week": true, "next_month": true, "next_year": true,
+}
+
+func (p *parser) parseCond() (Cond, error) {
+	prop := p.next()
+	if prop.kind != tokenWord && prop.kind != tokenString {
+		return Cond{}, p.errorf(prop, "expect a property at %v", prop)
+	}
+	cond := Cond{Property: prop.text, Pos: prop.pos}
+
+	op := p.next()
+	switch {
+	case op.kind == tokenOp:
+		cond.Operator = op.text
+	case op.is("not") && p.peek().is("contains"):
+		p.next()
+		cond.Operator = "not contains"
+	case op.kind == tokenWord && wordOperators[strings.ToLower(op.text)]:
+		cond.Operator = strings.ToLower(op.text)
+	case op.is("is"):
+		not := p.peek().is("not")
+		if not {
+			p.next()
+		}
+
+		t := p.next()
+		if !isOperators[strings.ToLower(t.text)] || t.kind != tokenWord || (not && !t.is("empty")) {
+			return Cond{}, p.errorf(t, "expect empty, not empty, past_week etc after is, got %v", t)
+		}
+		cond.Operator = "is " + strings.ToLower(t.text)
+		if not {
+			cond.Operator = "is not empty"
+		}
+		return cond, nil
+	default:
+		return Cond{}, p.errorf(op, "expect an operator after %v, e.g. =, !=, contains, after, is empty, got %v", prop, op)
+	}
+
+	value := p.next()
+	if value.kind != tokenWord && value.kind != tokenString {
+		return Cond{}, p.errorf(value, "expect a value after %v, got %v", cond.Operator, value)
+	}
+	cond.Value = value.text
+	return cond, nil
+}
+
+// Sort is a parsed sort item, e.g. `-"Created At"`
+type Sort struct {
+	Property   string
+	Descending bool
+	Pos        int
+}
+
+// ParseSorts parses comma separated properties, a `-` prefix or a `desc` suffix sorts
+// the property descending, a `+` prefix or an `asc` suffix ascending (default)
+func ParseSorts(s string) ([]Sort, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{expr: s, tokens: tokens}
+
+	sorts := []Sort{}
+	for {
+		t := p.next()
+		sort := Sort{Pos: t.pos}
+
+		if t.kind == tokenWord && (t.text == "-" || t.text == "+") { // -"Created At"
+			sort.Descending = t.text == "-"
+			t = p.next()
+		} else if t.kind == tokenWord && (strings.HasPrefix(t.text, "-") || strings.HasPrefix(t.text, "+")) { // -Title
+			sort.Descending = t.text[0] == '-'
+			t.text = t.text[1:]
+		}
+
+		if (t.kind != tokenWord && t.kind != tokenString) || t.text == "" {
+			return nil, p.errorf(t, "expect a property to sort at %v", t)
+		}
+		sort.Property = t.text
+
+		if next := p.peek(); next.is("desc") || next.is("asc") {
+			sort.Descending = p.next().is("desc")
+		}
+		sorts = append(sorts, sort)
+
+		switch t := p.next(); {
+		case t.kind == tokenEOF:
+			return sorts, nil
+		case t.kind != tokenPunct || t.text != ",":
+			return nil, p.errorf(t, "expect , between sorts at %v", t)
+		}
+	}
+}
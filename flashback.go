@@ -6,28 +6,60 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
-	"os"
+	"strings"
 	"time"
 
 	"github.com/dstotijn/go-notion"
 )
 
 type FlashbackConfig struct {
-	DatabaseID         string    `yaml:"databaseID"`
-	DatabaseQuery      string    `yaml:"databaseQuery"`
-	OldestTimestamp    time.Time `yaml:"oldestTimestamp"`    // Format time.RFC3339 2006-01-02T15:04:05Z07:00
-	FlashbackNum       int       `yaml:"flashbackNum"`       // Number of flashback entries
-	FlashbackPageID    string    `yaml:"flashbackPageID"`    // Page to write the flashback
-	FlashbackJournalID string    `yaml:"flashbackJournalID"` // Use daily journal database ID, this will overwrite FlashbackPageID
-	FlashbackTextBlock string    `yaml:"flashbackTextBlock"` // Format https://pkg.go.dev/github.com/dstotijn/go-notion#ParagraphBlock
-	FlashbackChainFile string    `yaml:"flashbackChainFile"` // Filename for chain with LLM cmd
+	DatabaseID         string       `yaml:"databaseID"`
+	DatabaseQuery      string       `yaml:"databaseQuery"`
+	Filter             string       `yaml:"filter"`             // or a filter instead, e.g. `"Created At" on_or_before {{.Date}}`
+	Sort               string       `yaml:"sort"`               // optional, sorts of the filter
+	Search             *SearchSpec  `yaml:"search"`             // or search the workspace instead, e.g. query: "Idea"
+	Source             SourceConfig `yaml:"source"`             // or any source, e.g. databaseIDs, rootPageID, file, overrides the above
+	OldestTimestamp    time.Time    `yaml:"oldestTimestamp"`    // Format time.RFC3339 2006-01-02T15:04:05Z07:00
+	FlashbackNum       int          `yaml:"flashbackNum"`       // Number of flashback entries
+	FlashbackPageID    string       `yaml:"flashbackPageID"`    // Page to write the flashback
+	FlashbackJournalID string       `yaml:"flashbackJournalID"` // Use daily journal database ID, this will overwrite FlashbackPageID
+	FlashbackTextBlock string       `yaml:"flashbackTextBlock"` // Format https://pkg.go.dev/github.com/dstotijn/go-notion#ParagraphBlock
+	FlashbackAnchor    WriteAnchor  `yaml:"flashbackAnchor"`    // optional, where to write in the page, e.g. under: "Flashback"
+	FlashbackChainFile string       `yaml:"flashbackChainFile"` // Filename for chain with LLM cmd
+	// Pages resurfaced are recorded in --state, they are not picked again within the days.
+	// Optional, default to 30, set -1 to allow any pages
+	ResurfaceAfterDays int `yaml:"resurfaceAfterDays"`
 }
 
 type Flashback struct {
 	DebugMode bool
 
-	Client *notion.Client
+	Client NotionAPI
+	Report *RunReport
+	Clock  Clock
+	State  *CmdState
 	FlashbackConfig
+
+	outputPages []notion.Page
+}
+
+func init() {
+	RegisterCmd(CmdSpec{
+		Name:        "flashback",
+		Description: "Get random pages from a database and resurface them",
+		Section:     "flashback",
+		Config:      FlashbackConfig{},
+		New: func(env CmdEnv, cfg Config) (Cmd, error) {
+			return &Flashback{
+				DebugMode:       env.DebugMode,
+				Client:          env.Client,
+				Report:          env.Report,
+				Clock:           env.Clock,
+				State:           env.CmdState("flashback", cfg),
+				FlashbackConfig: cfg.Flashback,
+			}, nil
+		},
+	})
 }
 
 func (f *Flashback) Validate() error {
@@ -39,16 +71,20 @@ func (f *Flashback) Validate() error {
 		return errors.Join(ErrConfigRequired, fmt.Errorf("set flashbackTextBlock"))
 	}
 
+	if err := f.FlashbackAnchor.Validate(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
-func (f *Flashback) Run() error {
-	f.SetFlashbackPageID()
+func (f *Flashback) Run(ctx context.Context) error {
+	f.SetFlashbackPageID(ctx)
 
 	maxHours := int(time.Since(f.OldestTimestamp).Hours())
 	// use a random hour to lookback
 	lookbackHour := rand.Intn(maxHours)
-	pages, err := f.GetPages(time.Duration(lookbackHour) * time.Hour)
+	pages, err := f.GetPages(ctx, time.Duration(lookbackHour)*time.Hour)
 	if err != nil {
 		return err
 	}
@@ -56,13 +92,16 @@ func (f *Flashback) Run() error {
 
 	if len(pages) < 1 { // try again with max hours
 		lookbackHour = maxHours
-		pages, err = f.GetPages(time.Duration(lookbackHour) * time.Hour)
+		pages, err = f.GetPages(ctx, time.Duration(lookbackHour)*time.Hour)
 		if err != nil {
 			return err
 		}
 		log.Printf("Lookback (max) %v Hours/%v Day, Queried pages: %+v", lookbackHour, lookbackHour/24, len(pages))
 	}
 
+	f.Report.AddScanned(len(pages))
+	pages = f.FilterShown(pages)
+
 	if len(pages) < 1 { // give up
 		log.Printf("Skipped. no pages fetched")
 		return nil
@@ -88,55 +127,91 @@ func (f *Flashback) Run() error {
 	}
 
 	for n := range picked { // write out block
-		if block, err := f.WriteBlock(pages[n].ID); err == nil {
-			if len(block.Results) > 0 {
-				log.Printf("Append block child %v", block.Results[0].ID())
-			}
+		f.outputPages = append(f.outputPages, pages[n])
+
+		block, err := f.WriteBlock(ctx, pages[n].ID)
+		if err != nil {
+			log.Printf("Failed to write block with PageID: %v, err: %v", pages[n].ID, err)
+			f.Report.AddFailed(pages[n].ID, err)
+			continue
+		}
+		f.Report.AddWritten(1)
+
+		if len(block.Results) > 0 {
+			log.Printf("Append block child %v", block.Results[0].ID())
+		}
+
+		if err := f.State.Put(pages[n].ID, ""); err != nil {
+			log.Printf("Failed to save state, id: %v, err: %v", pages[n].ID, err)
 		}
 	}
 
 	if f.FlashbackChainFile != "" { // write out chain file
-		file, err := os.Create(f.FlashbackChainFile)
-		if err != nil {
-			return fmt.Errorf("create file: %v, err: %v", f.FlashbackChainFile, err)
+		var chain strings.Builder
+		for n := range picked {
+			chain.WriteString(pages[n].ID + "\n")
 		}
-		defer file.Close()
 
-		for n := range picked {
-			if _, err = file.WriteString(pages[n].ID + "\n"); err != nil {
-				log.Printf("Failed writing to file, err: %v", err)
-			}
+		if err := writeFileAtomicBytes(f.FlashbackChainFile, []byte(chain.String())); err != nil {
+			return fmt.Errorf("write file: %v, err: %v", f.FlashbackChainFile, err)
 		}
 	}
 
 	return nil
 }
 
-func (f *Flashback) GetPages(lookback time.Duration) ([]notion.Page, error) {
-	q := NewDatabaseQuery(f.Client, f.DatabaseID)
+func (f *Flashback) OutputPages() []notion.Page {
+	return f.outputPages
+}
 
-	if err := q.SetQuery(f.DatabaseQuery, QueryBuilder{
-		Date:  time.Now().Add(-lookback).Format(layoutDate),
-		Today: time.Now().Format(layoutDate),
-	}); err != nil {
-		log.Panicf("Invalid query: %v, err: %v", f.DatabaseQuery, err)
+// FilterShown removes pages resurfaced within ResurfaceAfterDays
+func (f *Flashback) FilterShown(pages []notion.Page) []notion.Page {
+	days := f.ResurfaceAfterDays
+	if days == 0 {
+		days = 30
+	} else if days < 0 {
+		return pages
 	}
 
-	if f.DebugMode {
-		log.Printf("DatabaseQuery Filter: %+v", q.Query.Filter)
-		log.Printf("DatabaseQuery Sorter: %+v", q.Query.Sorts)
+	since := time.Now().AddDate(0, 0, -days)
+	filtered := make([]notion.Page, 0, len(pages))
+	for _, page := range pages {
+		if entry, found := f.State.Get(page.ID); found && entry.ProcessedAt.After(since) {
+			continue
+		}
+		filtered = append(filtered, page)
+	}
+
+	if skipped := len(pages) - len(filtered); skipped > 0 {
+		log.Printf("Skip pages resurfaced in %v days: %v", days, skipped)
+		f.Report.AddSkipped(skipped)
+	}
+	return filtered
+}
+
+func (f *Flashback) GetPages(ctx context.Context, lookback time.Duration) ([]notion.Page, error) {
+	source := f.Source.Or(SourceConfig{DatabaseID: f.DatabaseID, DatabaseQuery: f.DatabaseQuery, Filter: f.Filter, Sort: f.Sort, Search: f.Search})
+
+	src, err := NewPageSource(ctx, f.Client, f.Clock, source, QueryBuilder{
+		Date:  f.Clock.Date(time.Now().Add(-lookback)),
+		Today: f.Clock.Date(time.Now()),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("source: %w", err)
 	}
 
-	return q.Once(context.TODO())
+	if f.DebugMode {
+		logSource(src)
+	}
+	return OncePages(ctx, src)
 }
 
-func (f *Flashback) SetFlashbackPageID() {
+func (f *Flashback) SetFlashbackPageID(ctx context.Context) {
 	if f.FlashbackJournalID == "" {
 		return
 	}
 
-	now := time.Now()
-	title := now.Format(layoutDate)
+	title := f.Clock.Title(time.Now())
 
 	q := NewDatabaseQuery(f.Client, f.FlashbackJournalID)
 	q.Query = &notion.DatabaseQuery{
@@ -151,7 +226,7 @@ func (f *Flashback) SetFlashbackPageID() {
 		},
 	}
 
-	pages, err := q.Once(context.TODO())
+	pages, err := q.Once(ctx)
 	if err != nil {
 		log.Panicf("No journal found: %v, err: %v", title, err)
 	}
@@ -167,15 +242,17 @@ func (f *Flashback) SetFlashbackPageID() {
 	f.FlashbackPageID = pages[0].ID
 }
 
-func (f *Flashback) WriteBlock(pageID string) (notion.BlockChildrenResponse, error) {
+func (f *Flashback) WriteBlock(ctx context.Context, pageID string) (notion.BlockChildrenResponse, error) {
 	w := NewAppendBlock(f.Client, f.FlashbackPageID)
+	w.Clock = f.Clock
+	w.Anchor = f.FlashbackAnchor
 
 	if err := w.AddParagraph("Flashback", f.FlashbackTextBlock, BlockBuilder{
-		Date:   time.Now().Format(layoutDate),
+		Date:   f.Clock.Date(time.Now()),
 		PageID: pageID,
 	}); err != nil {
 		return notion.BlockChildrenResponse{}, err
 	}
 
-	return w.Do(context.TODO())
+	return w.Do(ctx)
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/zhuochun/notion-toolset/notiontest"
+)
+
+func TestFlashback(t *testing.T) {
+	fake := notiontest.New()
+	db := fake.AddDatabase("Notes", notion.DatabaseProperties{"Created At": {Type: notion.DBPropTypeCreatedTime}})
+
+	oldest := time.Now().AddDate(0, 0, -30)
+	for _, title := range []string{"a", "b", "c"} {
+		page := notiontest.DatabasePage(db.ID, title)
+		page.CreatedTime = oldest.AddDate(0, 0, -1) // always within the lookback
+		fake.AddPage(page)
+	}
+	journal := fake.AddPage(notiontest.DatabasePage(db.ID, "journal"))
+
+	cfg := readTestConfig(t, "flashback.yaml")
+	cfg.Flashback.DatabaseID = db.ID
+	cfg.Flashback.OldestTimestamp = oldest
+	cfg.Flashback.FlashbackNum = 2
+	cfg.Flashback.FlashbackPageID = journal.ID
+	cfg.Flashback.FlashbackJournalID = ""
+
+	cmd, report := runTestCmd(t, "flashback", fake, cfg)
+
+	if report.Scanned != 3 || report.Written != 2 {
+		t.Errorf("unexpected report: %v", report)
+	}
+
+	ids := mentionedPages(fake.Children(journal.ID))
+	out := cmd.(PageProducer).OutputPages()
+	if len(ids) != 2 || len(out) != 2 || ids[0] == ids[1] {
+		t.Fatalf("expect 2 different pages resurfaced, got %v", ids)
+	}
+	for i, page := range out {
+		if page.ID != ids[i] {
+			t.Errorf("expect output pages same as written, got %v and %v", page.ID, ids[i])
+		}
+	}
+}
+
+func TestFlashbackState(t *testing.T) {
+	fake := notiontest.New()
+	db := fake.AddDatabase("Notes", notion.DatabaseProperties{"Created At": {Type: notion.DBPropTypeCreatedTime}})
+
+	oldest := time.Now().AddDate(0, 0, -30)
+	for _, title := range []string{"a", "b"} {
+		page := notiontest.DatabasePage(db.ID, title)
+		page.CreatedTime = oldest.AddDate(0, 0, -1)
+		fake.AddPage(page)
+	}
+	journalDB := fake.AddDatabase("Journal", nil)
+	journal := fake.AddPage(notiontest.DatabasePage(journalDB.ID, "journal"))
+
+	store, err := OpenFileStateStore(t.TempDir() + "/state.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := CmdEnv{Client: fake, State: store}
+
+	cfg := readTestConfig(t, "flashback.yaml")
+	cfg.Flashback.DatabaseID = db.ID
+	cfg.Flashback.OldestTimestamp = oldest
+	cfg.Flashback.FlashbackNum = 1
+	cfg.Flashback.FlashbackPageID = journal.ID
+	cfg.Flashback.FlashbackJournalID = ""
+
+	runTestCmdEnv(t, "flashback", env, cfg)
+	runTestCmdEnv(t, "flashback", env, cfg)
+	_, report := runTestCmdEnv(t, "flashback", env, cfg)
+
+	if report.Written != 0 || report.Skipped != 2 {
+		t.Errorf("expect all pages resurfaced recently, got report: %v", report)
+	}
+
+	ids := mentionedPages(fake.Children(journal.ID))
+	if len(ids) != 2 || ids[0] == ids[1] {
+		t.Errorf("expect 2 different pages resurfaced, got %v", ids)
+	}
+}
+
+func TestFlashbackAnchor(t *testing.T) {
+	fake := notiontest.New()
+	db := fake.AddDatabase("Notes", notion.DatabaseProperties{"Created At": {Type: notion.DBPropTypeCreatedTime}})
+
+	oldest := time.Now().AddDate(0, 0, -30)
+	page := notiontest.DatabasePage(db.ID, "a")
+	page.CreatedTime = oldest.AddDate(0, 0, -1)
+	fake.AddPage(page)
+	journal := fake.AddPage(notiontest.DatabasePage(db.ID, "journal"), notiontest.Paragraph("Plan"))
+
+	cfg := readTestConfig(t, "flashback.yaml")
+	cfg.Flashback.DatabaseID = db.ID
+	cfg.Flashback.OldestTimestamp = oldest
+	cfg.Flashback.FlashbackNum = 1
+	cfg.Flashback.FlashbackPageID = journal.ID
+	cfg.Flashback.FlashbackAnchor = WriteAnchor{Under: "Flashback"}
+
+	runTestCmd(t, "flashback", fake, cfg)
+
+	children := fake.Children(journal.ID)
+	if len(children) != 2 {
+		t.Fatalf("expect a Flashback heading created, got %d blocks", len(children))
+	}
+	if ids := mentionedPages(fake.Children(children[1].ID())); len(ids) != 1 {
+		t.Errorf("expect the page resurfaced under the heading, got %v", ids)
+	}
+}
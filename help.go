@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// printHelp lists all commands, or the config keys of a single command
+func printHelp(w io.Writer, name string) error {
+	if name == "" {
+		fmt.Fprintln(w, "Usage: notion-toolset --cmd=<cmd> --config=<path>")
+		fmt.Fprintln(w, "       notion-toolset help <cmd>")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Commands:")
+
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		for _, spec := range CmdSpecs() {
+			fmt.Fprintf(tw, "  %v\t%v\n", spec.Name, spec.Description)
+		}
+		return tw.Flush()
+	}
+
+	spec, found := LookupCmd(name)
+	if !found {
+		return fmt.Errorf("unknown cmd: `%v`", name)
+	}
+
+	fmt.Fprintf(w, "%v: %v\n", spec.Name, spec.Description)
+	if spec.Section == "" || spec.Config == nil {
+		return nil
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Config:")
+	fmt.Fprintf(w, "%v:\n", spec.Section)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	writeConfigKeys(tw, reflect.TypeOf(spec.Config), "  ")
+	return tw.Flush()
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	configType   = reflect.TypeOf(Config{}) // inline config of a step or job, not expanded
+)
+
+// writeConfigKeys writes the yaml keys of a config struct recursively
+func writeConfigKeys(w io.Writer, t reflect.Type, indent string) {
+	t = derefType(t)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		key, inline := yamlKey(field)
+		if key == "-" {
+			continue
+		}
+
+		fieldType := derefType(field.Type)
+
+		if inline && fieldType.Kind() == reflect.Struct {
+			writeConfigKeys(w, fieldType, indent)
+			continue
+		}
+
+		if isConfigStruct(fieldType) {
+			fmt.Fprintf(w, "%v%v:\t\n", indent, key)
+			writeConfigKeys(w, fieldType, indent+"  ")
+			continue
+		}
+		if fieldType.Kind() == reflect.Slice && isConfigStruct(derefType(fieldType.Elem())) {
+			fmt.Fprintf(w, "%v%v:\t[]\n", indent, key)
+			writeConfigKeys(w, derefType(fieldType.Elem()), indent+"  ")
+			continue
+		}
+
+		fmt.Fprintf(w, "%v%v:\t%v\n", indent, key, typeName(fieldType))
+	}
+}
+
+// isConfigStruct reports a struct of config keys, written with its keys
+func isConfigStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != timeType && t != configType
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+func yamlKey(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("yaml")
+	if tag == "" {
+		return strings.ToLower(field.Name), false
+	}
+
+	parts := strings.Split(tag, ",")
+	inline := false
+	for _, opt := range parts[1:] {
+		if opt == "inline" {
+			inline = true
+		}
+	}
+
+	if parts[0] == "" {
+		return strings.ToLower(field.Name), inline
+	}
+	return parts[0], inline
+}
+
+func typeName(t reflect.Type) string {
+	switch {
+	case t == timeType:
+		return "timestamp"
+	case t == durationType: // a string in YAML, e.g. 30s
+		return "duration"
+	case t == configType:
+		return "config"
+	case t.Kind() == reflect.Slice:
+		return "[]" + typeName(t.Elem())
+	case t.Kind() == reflect.Map:
+		return "map[" + typeName(t.Key()) + "]" + typeName(t.Elem())
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return "number"
+	case t.Kind() == reflect.Int || t.Kind() == reflect.Int64:
+		return "int"
+	case t.Kind() == reflect.Interface:
+		return "any"
+	default:
+		return t.Kind().String()
+	}
+}
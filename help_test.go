@@ -0,0 +1,22 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrintHelpListKeys(t *testing.T) {
+	var out strings.Builder
+	if err := printHelp(&out, "daemon"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"jobs:", "    cron:", "    configPath:", "    jitter:"} {
+		if !strings.Contains(out.String(), key) {
+			t.Errorf("expect key %q of the jobs listed, got\n%v", key, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "flashback:") {
+		t.Errorf("expect the inline config of a job not expanded, got\n%v", out.String())
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zhuochun/notion-toolset/retry"
+)
+
+const redacted = "[REDACTED]"
+
+// httpTransport is the base transport of all requests to Notion and OpenAI,
+// it is replaced by a FixtureTransport with --record or --replay
+var httpTransport http.RoundTripper = http.DefaultTransport
+
+// newHTTPTransport is the http transport shared by all requests to Notion, OpenAI and assets,
+// it passes Retry-After of responses to the retry package
+func newHTTPTransport() http.RoundTripper {
+	return retry.NewTransport(httpTransport)
+}
+
+// isReplaying reports whether requests are served from fixtures, tokens are not required then
+func isReplaying() bool {
+	t, ok := httpTransport.(*FixtureTransport)
+	return ok && t.replay
+}
+
+// Fixture is a recorded request and its response
+type Fixture struct {
+	Method  string          `json:"method"`
+	URL     string          `json:"url"`
+	Request json.RawMessage `json:"request,omitempty"`
+
+	Status       int                 `json:"status"`
+	Header       map[string][]string `json:"header,omitempty"`
+	Response     json.RawMessage     `json:"response,omitempty"`
+	ResponseBody []byte              `json:"responseBody,omitempty"` // response that is not JSON, e.g. assets
+}
+
+// FixtureTransport records every request and response as fixtures into a directory,
+// or replays them from the directory without network access.
+//
+// Replay matches a request by method, URL and body first, then by method and URL only,
+// as bodies can contain dates of the run. Fixtures of the same request are replayed in
+// the recorded order, the last one is repeated after that.
+type FixtureTransport struct {
+	Base http.RoundTripper
+	Dir  string
+
+	replay  bool
+	secrets []string // values redacted from recorded fixtures
+
+	mu       sync.Mutex
+	seq      int
+	exact    map[string][]*Fixture
+	loose    map[string][]*Fixture
+	consumed map[*Fixture]bool
+}
+
+// NewRecordTransport records requests passed to base into dir, secrets are redacted
+func NewRecordTransport(base http.RoundTripper, dir string, secrets ...string) (*FixtureTransport, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("record dir: %w", err)
+	}
+
+	existing, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	t := &FixtureTransport{Base: base, Dir: dir, seq: len(existing)}
+	for _, s := range secrets {
+		if s != "" {
+			t.secrets = append(t.secrets, s)
+		}
+	}
+	return t, nil
+}
+
+// NewReplayTransport serves requests from the fixtures in dir
+func NewReplayTransport(dir string) (*FixtureTransport, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("replay dir: no fixtures in %v", dir)
+	}
+	sort.Strings(files) // in recorded order
+
+	t := &FixtureTransport{
+		Dir:      dir,
+		replay:   true,
+		exact:    map[string][]*Fixture{},
+		loose:    map[string][]*Fixture{},
+		consumed: map[*Fixture]bool{},
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read fixture: %w", err)
+		}
+
+		f := &Fixture{}
+		if err := json.Unmarshal(data, f); err != nil {
+			return nil, fmt.Errorf("unmarshal fixture %v: %w", file, err)
+		}
+
+		t.exact[f.key(true)] = append(t.exact[f.key(true)], f)
+		t.loose[f.key(false)] = append(t.loose[f.key(false)], f)
+	}
+
+	return t, nil
+}
+
+func (f *Fixture) key(withBody bool) string {
+	key := f.Method + " " + f.URL
+	if withBody {
+		key += " " + compactJSON(f.Request)
+	}
+	return key
+}
+
+func (t *FixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, fmt.Errorf("fixture read body: %w", err)
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if t.replay {
+		return t.replayResponse(req, body)
+	}
+	return t.record(req, body)
+}
+
+func (t *FixtureTransport) replayResponse(req *http.Request, body []byte) (*http.Response, error) {
+	f := &Fixture{Method: req.Method, URL: req.URL.String(), Request: jsonBody(body)}
+
+	t.mu.Lock()
+	found := t.next(t.exact[f.key(true)])
+	if found == nil {
+		found = t.next(t.loose[f.key(false)])
+	}
+	t.mu.Unlock()
+
+	if found == nil {
+		return nil, fmt.Errorf("replay: no fixture for %v %v", req.Method, req.URL)
+	}
+	return found.response(req), nil
+}
+
+// next returns the first fixture not replayed yet, or the last one
+func (t *FixtureTransport) next(fixtures []*Fixture) *Fixture {
+	for _, f := range fixtures {
+		if !t.consumed[f] {
+			t.consumed[f] = true
+			return f
+		}
+	}
+
+	if len(fixtures) > 0 {
+		return fixtures[len(fixtures)-1]
+	}
+	return nil
+}
+
+func (f *Fixture) response(req *http.Request) *http.Response {
+	body := []byte(f.Response)
+	if f.Response == nil {
+		body = f.ResponseBody
+	}
+
+	return &http.Response{
+		StatusCode:    f.Status,
+		Status:        fmt.Sprintf("%d %v", f.Status, http.StatusText(f.Status)),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header(f.Header).Clone(),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+func (t *FixtureTransport) record(req *http.Request, body []byte) (*http.Response, error) {
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("fixture read response: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	f := &Fixture{
+		Method:  req.Method,
+		URL:     t.redact(req.URL.String()),
+		Request: jsonBody([]byte(t.redact(string(body)))),
+		Status:  resp.StatusCode,
+		Header:  t.redactHeader(resp.Header),
+	}
+
+	if r := jsonBody([]byte(t.redact(string(respBody)))); r != nil {
+		f.Response = r
+	} else {
+		f.ResponseBody = respBody
+	}
+
+	if err := t.save(req, f); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+var fixtureNameRegex = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+func (t *FixtureTransport) save(req *http.Request, f *Fixture) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal fixture: %w", err)
+	}
+
+	t.mu.Lock()
+	t.seq += 1
+	seq := t.seq
+	t.mu.Unlock()
+
+	name := strings.Trim(fixtureNameRegex.ReplaceAllString(req.URL.Host+req.URL.Path, "-"), "-")
+	if len(name) > 80 {
+		name = name[:80]
+	}
+
+	path := filepath.Join(t.Dir, fmt.Sprintf("%05d-%v-%v.json", seq, strings.ToLower(req.Method), name))
+	if err := writeFileAtomicBytes(path, data); err != nil {
+		return fmt.Errorf("write fixture: %w", err)
+	}
+	return nil
+}
+
+// redactHeader drops cookies and redacts headers that identify the account
+func (t *FixtureTransport) redactHeader(header http.Header) map[string][]string {
+	out := map[string][]string{}
+	for k, values := range header {
+		switch http.CanonicalHeaderKey(k) {
+		case "Set-Cookie", "Content-Length": // length changes with redaction
+			continue
+		case "Openai-Organization", "Openai-Project":
+			out[k] = []string{redacted}
+			continue
+		}
+
+		for _, v := range values {
+			out[k] = append(out[k], t.redact(v))
+		}
+	}
+	return out
+}
+
+func (t *FixtureTransport) redact(s string) string {
+	for _, secret := range t.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return s
+}
+
+// jsonBody returns the body as JSON, or nil if it is empty or not JSON
+func jsonBody(body []byte) json.RawMessage {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || !json.Valid(body) {
+		return nil
+	}
+	return json.RawMessage(body)
+}
+
+func compactJSON(data json.RawMessage) string {
+	var b bytes.Buffer
+	if err := json.Compact(&b, data); err != nil {
+		return string(data)
+	}
+	return b.String()
+}
+
+// setupFixtures replaces the http transport by --record or --replay
+func setupFixtures(recordDir, replayDir string) error {
+	switch {
+	case recordDir != "" && replayDir != "":
+		return errors.New("use either --record or --replay")
+	case recordDir != "":
+		t, err := NewRecordTransport(httpTransport, recordDir, notionToken(), os.Getenv("DOT_OPENAI_KEY"))
+		if err != nil {
+			return err
+		}
+		httpTransport = t
+	case replayDir != "":
+		t, err := NewReplayTransport(replayDir)
+		if err != nil {
+			return err
+		}
+		httpTransport = t
+	}
+	return nil
+}
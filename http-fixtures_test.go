@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+)
+
+func TestFixtureTransportRecordReplay(t *testing.T) {
+	const token = "secret_notion_token"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=abc")
+		switch r.URL.Path {
+		case "/v1/pages/page1":
+			w.Write([]byte(`{"object":"page","id":"page1","parent":{"type":"workspace","workspace":true},"properties":{}}`))
+		case "/v1/databases/db1/query":
+			w.Write([]byte(`{"object":"list","results":[],"has_more":false,"echo":"` + token + `"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"object":"error","status":404,"code":"object_not_found","message":"missing"}`))
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	record, err := NewRecordTransport(http.DefaultTransport, dir, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	client := notion.NewClient(token, notion.WithHTTPClient(&http.Client{Transport: &baseURLTransport{server.URL, record}}))
+
+	if _, err := client.FindPageByID(ctx, "page1"); err != nil {
+		t.Fatalf("find page: %v", err)
+	}
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := client.QueryDatabase(ctx, "db1", &notion.DatabaseQuery{Filter: &notion.DatabaseQueryFilter{
+		Timestamp:                   notion.TimestampCreatedTime,
+		DatabaseQueryPropertyFilter: notion.DatabaseQueryPropertyFilter{CreatedTime: &notion.DatePropertyFilter{After: &since}},
+	}}); err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if _, err := client.FindPageByID(ctx, "missing"); err == nil {
+		t.Fatalf("expect not found")
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 3 {
+		t.Fatalf("expect 3 fixtures, got %v", files)
+	}
+	for _, file := range files {
+		data, _ := os.ReadFile(file)
+		if strings.Contains(string(data), token) || strings.Contains(string(data), "session=abc") {
+			t.Errorf("expect secrets redacted in %v:\n%s", file, data)
+		}
+	}
+
+	server.Close() // replay works offline
+
+	replay, err := NewReplayTransport(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = notion.NewClient("other", notion.WithHTTPClient(&http.Client{Transport: &baseURLTransport{server.URL, replay}}))
+
+	if page, err := client.FindPageByID(ctx, "page1"); err != nil || page.ID != "page1" {
+		t.Errorf("replay find page: %+v, err: %v", page, err)
+	}
+	since = since.AddDate(0, 0, 1) // matched by URL when body differs, e.g. dates of the run
+	if _, err := client.QueryDatabase(ctx, "db1", &notion.DatabaseQuery{Filter: &notion.DatabaseQueryFilter{
+		Timestamp:                   notion.TimestampCreatedTime,
+		DatabaseQueryPropertyFilter: notion.DatabaseQueryPropertyFilter{CreatedTime: &notion.DatePropertyFilter{After: &since}},
+	}}); err != nil {
+		t.Errorf("replay query: %v", err)
+	}
+	if _, err := client.FindPageByID(ctx, "missing"); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("expect replayed not found, got %v", err)
+	}
+	if _, err := client.FindPageByID(ctx, "unknown"); err == nil || !strings.Contains(err.Error(), "no fixture") {
+		t.Errorf("expect no fixture error, got %v", err)
+	}
+}
+
+// baseURLTransport sends requests to the test server instead of api.notion.com
+type baseURLTransport struct {
+	URL  string
+	Base http.RoundTripper
+}
+
+func (t *baseURLTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = "http"
+	req.URL.Host = strings.TrimPrefix(t.URL, "http://")
+	return t.Base.RoundTrip(req)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Job is an entry in the multiple config
+type Job struct {
+	Index  int
+	Config Config
+}
+
+// Label is the job name, or its index when unnamed
+func (j Job) Label() string {
+	if j.Config.Name != "" {
+		return j.Config.Name
+	}
+	return fmt.Sprintf("#%d", j.Index)
+}
+
+// CmdName is the cmd of the job, default to --cmd
+func (j Job) CmdName() string {
+	if j.Config.Cmd != "" {
+		return j.Config.Cmd
+	}
+	return *flagCmd
+}
+
+type JobResult struct {
+	Job
+	Report *RunReport
+}
+
+// selectJobs filters the configs by index, or by names and tags, all jobs if none are set
+func selectJobs(configs []Config, idx int, names, tags string) ([]Job, error) {
+	jobs := []Job{}
+
+	if idx >= 0 {
+		if names != "" || tags != "" {
+			return nil, errors.Join(ErrConfigInvalid, fmt.Errorf("--idx can not be used with --job or --tags"))
+		}
+		if idx >= len(configs) {
+			return nil, fmt.Errorf("index %d out of range, configs: %d", idx, len(configs))
+		}
+		return []Job{{Index: idx, Config: configs[idx]}}, nil
+	}
+
+	nameSet := splitSet(names)
+	tagSet := splitSet(tags)
+
+	for i, cfg := range configs {
+		if len(nameSet) > 0 && !nameSet[cfg.Name] {
+			continue
+		}
+
+		if len(tagSet) > 0 {
+			matched := false
+			for _, tag := range cfg.Tags {
+				matched = matched || tagSet[tag]
+			}
+			if !matched {
+				continue
+			}
+		}
+
+		jobs = append(jobs, Job{Index: i, Config: cfg})
+	}
+
+	for name := range nameSet {
+		found := false
+		for _, job := range jobs {
+			found = found || job.Config.Name == name
+		}
+		if !found {
+			return nil, fmt.Errorf("job not found: %v", name)
+		}
+	}
+
+	for _, job := range jobs {
+		if job.CmdName() == "" {
+			return nil, fmt.Errorf("job %v has no cmd, set cmd in config or --cmd", job.Label())
+		}
+	}
+
+	return jobs, nil
+}
+
+func splitSet(s string) map[string]bool {
+	set := map[string]bool{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			set[v] = true
+		}
+	}
+	return set
+}
+
+// runJobs runs the jobs in order, a failed job does not stop the others, an interrupt does
+func runJobs(ctx context.Context, notionClient NotionAPI, jobs []Job) []JobResult {
+	results := make([]JobResult, 0, len(jobs))
+
+	for _, job := range jobs {
+		if err := ctx.Err(); err != nil { // interrupted, the remaining jobs are not started
+			report := NewRunReport(job.CmdName(), job.Label())
+			report.Finish(err)
+			results = append(results, JobResult{Job: job, Report: report})
+			continue
+		}
+
+		results = append(results, JobResult{
+			Job:    job,
+			Report: runCmd(ctx, notionClient, job.CmdName(), job.Label(), job.Config),
+		})
+	}
+
+	return results
+}
+
+func summarizeJobs(results []JobResult) string {
+	var b strings.Builder
+
+	failed := 0
+	for _, r := range results {
+		if r.Report.ExitCode() != ExitOK {
+			failed += 1
+		}
+	}
+
+	fmt.Fprintf(&b, "Jobs summary: %d passed, %d failed\n", len(results)-failed, failed)
+	for _, r := range results {
+		status := "PASS"
+		switch r.Report.ExitCode() {
+		case ExitOK:
+		case ExitPartial:
+			status = "PART"
+		default:
+			status = "FAIL"
+		}
+
+		fmt.Fprintf(&b, "  %v %v (cmd %v) %v\n", status, r.Label(), r.CmdName(), r.Report)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSelectJobs(t *testing.T) {
+	configs := []Config{
+		{Name: "daily", Cmd: "flashback", Tags: []string{"morning"}},
+		{Name: "backup", Cmd: "export"},
+	}
+
+	if jobs, err := selectJobs(configs, 1, "", ""); err != nil || len(jobs) != 1 || jobs[0].Label() != "backup" {
+		t.Errorf("expect job by index, got %+v, err: %v", jobs, err)
+	}
+	if jobs, err := selectJobs(configs, -1, "", "morning"); err != nil || len(jobs) != 1 || jobs[0].Label() != "daily" {
+		t.Errorf("expect job by tag, got %+v, err: %v", jobs, err)
+	}
+
+	for _, filter := range [][2]string{{"daily", ""}, {"", "morning"}} {
+		if _, err := selectJobs(configs, 1, filter[0], filter[1]); !errors.Is(err, ErrConfigInvalid) {
+			t.Errorf("expect --idx with --job %q --tags %q invalid, got %v", filter[0], filter[1], err)
+		}
+	}
+}
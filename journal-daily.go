@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/dstotijn/go-notion"
+	"github.com/zhuochun/notion-toolset/retry"
 	"github.com/zhuochun/notion-toolset/transformer"
 )
 
@@ -21,19 +22,39 @@ type DailyJournalConfig struct {
 type DailyJournal struct {
 	DebugMode bool
 
-	Client *notion.Client
+	Client NotionAPI
+	Report *RunReport
+	Clock  Clock
 	DailyJournalConfig
 }
 
+func init() {
+	RegisterCmd(CmdSpec{
+		Name:        "daily-journal",
+		Description: "Create daily journal entries with title YYYY-MM-DD, or the titleFormat",
+		Section:     "dailyJournal",
+		Config:      DailyJournalConfig{},
+		New: func(env CmdEnv, cfg Config) (Cmd, error) {
+			return &DailyJournal{
+				DebugMode:          env.DebugMode,
+				Client:             env.Client,
+				Report:             env.Report,
+				Clock:              env.Clock,
+				DailyJournalConfig: cfg.DailyJournal,
+			}, nil
+		},
+	})
+}
+
 func (d *DailyJournal) Validate() error {
 	return nil
 }
 
-func (d *DailyJournal) Run() error {
-	now := time.Now()
+func (d *DailyJournal) Run(ctx context.Context) error {
+	now := d.Clock.Now()
 	tCursor := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
 
-	pages, err := d.GetPages(tCursor)
+	pages, err := d.GetPages(ctx, tCursor)
 	if err != nil {
 		return err
 	}
@@ -41,51 +62,53 @@ func (d *DailyJournal) Run() error {
 	if d.DebugMode {
 		log.Printf("Pages found: %v", pages)
 	}
+	d.Report.AddScanned(len(pages))
 
 	for i := 0; i < d.Limit; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		tCursor = tCursor.AddDate(0, 0, 1)
-		title := tCursor.Format(layoutDate)
+		title := d.Clock.Title(tCursor)
 
 		if pages[title] {
+			d.Report.AddSkipped(1)
 			continue
 		}
 
-		page, err := d.CreatePage(title)
+		page, err := d.CreatePage(ctx, title, tCursor)
 		if err != nil {
 			log.Printf("Create Page `%v` met Error: %v", title, err)
+			d.Report.AddFailed(title, err)
 			continue
 		}
 		log.Printf("Created page `%v` with ID: %v", title, page.ID)
+		d.Report.AddWritten(1)
 	}
 
 	return nil
 }
 
-func (d *DailyJournal) GetPages(tCursor time.Time) (map[string]bool, error) {
-	queryData, err := Tmpl("DatabaseQuery", d.PageQuery, QueryBuilder{
-		Date: tCursor.Format(layoutDate),
-	})
-	if err != nil {
+func (d *DailyJournal) GetPages(ctx context.Context, tCursor time.Time) (map[string]bool, error) {
+	q := NewDatabaseQuery(d.Client, d.DatabaseID)
+	q.Clock = d.Clock
+	if err := q.SetQuery(ctx, QuerySpec{Template: d.PageQuery}, QueryBuilder{Date: d.Clock.Date(tCursor)}); err != nil {
 		return nil, err
 	}
 
-	query := &notion.DatabaseQuery{}
-	if err := json.Unmarshal(queryData, query); err != nil {
-		return nil, fmt.Errorf("unmarshal DatabaseQuery: %w", err)
-	}
-
 	if d.DebugMode {
-		log.Printf("DatabaseQuery Filter: %+v", query.Filter)
-		log.Printf("DatabaseQuery Sorter: %+v", query.Sorts)
+		log.Printf("DatabaseQuery Filter: %+v", q.Query.Filter)
+		log.Printf("DatabaseQuery Sorter: %+v", q.Query.Sorts)
 	}
 
-	resp, err := d.Client.QueryDatabase(context.TODO(), d.DatabaseID, query)
+	results, err := q.Once(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	pages := map[string]bool{}
-	for _, page := range resp.Results {
+	for _, page := range results {
 		title, err := transformer.GetPageTitle(page)
 		if err != nil {
 			return nil, fmt.Errorf("invalid DatabaseQuery response: %w", err)
@@ -95,12 +118,12 @@ func (d *DailyJournal) GetPages(tCursor time.Time) (map[string]bool, error) {
 	return pages, nil
 }
 
-func (d *DailyJournal) CreatePage(title string) (notion.Page, error) {
+func (d *DailyJournal) CreatePage(ctx context.Context, title string, date time.Time) (notion.Page, error) {
 	propData, err := Tmpl("CreatePage Properties", d.PageProperties, PageBuilder{
 		Title:      title,
-		Date:       title,
+		Date:       d.Clock.Date(date),
 		DatabaseID: d.DatabaseID,
-	})
+	}, d.Clock)
 	if err != nil {
 		return notion.Page{}, err
 	}
@@ -114,9 +137,15 @@ func (d *DailyJournal) CreatePage(title string) (notion.Page, error) {
 		log.Printf("Page properties: %+v", props)
 	}
 
-	return d.Client.CreatePage(context.TODO(), notion.CreatePageParams{
-		ParentType:             notion.ParentTypeDatabase,
-		ParentID:               d.DatabaseID,
-		DatabasePageProperties: props,
+	var page notion.Page
+	err = retry.Write.Do(ctx, func(ctx context.Context) error {
+		var innerErr error
+		page, innerErr = d.Client.CreatePage(ctx, notion.CreatePageParams{
+			ParentType:             notion.ParentTypeDatabase,
+			ParentID:               d.DatabaseID,
+			DatabasePageProperties: props,
+		})
+		return innerErr
 	})
+	return page, err
 }
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/zhuochun/notion-toolset/notiontest"
+	"github.com/zhuochun/notion-toolset/transformer"
+)
+
+func TestDailyJournal(t *testing.T) {
+	fake := notiontest.New()
+	db := fake.AddDatabase("Journal", notion.DatabaseProperties{"Date": {Type: notion.DBPropTypeDate}})
+
+	tomorrow := time.Now().AddDate(0, 0, 1).Format(layoutDate)
+	start, _ := notion.ParseDateTime(tomorrow)
+	existing := notiontest.DatabasePage(db.ID, tomorrow)
+	existing.Properties.(notion.DatabasePageProperties)["Date"] = notion.DatabasePageProperty{Date: &notion.Date{Start: start}}
+	fake.AddPage(existing)
+
+	cfg := readTestConfig(t, "journal-daily.yaml")
+	cfg.DailyJournal.DatabaseID = db.ID
+	cfg.DailyJournal.Limit = 3
+
+	_, report := runTestCmd(t, "daily-journal", fake, cfg)
+
+	if report.Scanned != 1 || report.Skipped != 1 || report.Written != 2 || report.Failed != 0 {
+		t.Errorf("unexpected report: %v", report)
+	}
+
+	titles := map[string]bool{}
+	for _, page := range fake.Pages(db.ID) {
+		title, _ := transformer.GetPageTitle(page)
+		titles[title] = true
+	}
+	for i := 1; i <= 3; i++ {
+		if title := time.Now().AddDate(0, 0, i).Format(layoutDate); !titles[title] {
+			t.Errorf("expect journal %v, got %v", title, titles)
+		}
+	}
+	if len(titles) != 3 {
+		t.Errorf("expect 3 journals, got %v", titles)
+	}
+}
+
+func TestDailyJournalTitleFormat(t *testing.T) {
+	fake := notiontest.New()
+	db := fake.AddDatabase("Journal", notion.DatabaseProperties{"Date": {Type: notion.DBPropTypeDate}})
+
+	cfg := readTestConfig(t, "journal-daily.yaml")
+	cfg.Timezone = "Pacific/Kiritimati" // UTC+14, a different day from most places
+	cfg.TitleFormat = "Jan 2, 2006 (Mon)"
+	cfg.DailyJournal.DatabaseID = db.ID
+	cfg.DailyJournal.Limit = 1
+
+	_, report := runTestCmd(t, "daily-journal", fake, cfg)
+	if report.Written != 1 {
+		t.Fatalf("unexpected report: %v", report)
+	}
+
+	loc, _ := time.LoadLocation(cfg.Timezone)
+	tomorrow := time.Now().In(loc).AddDate(0, 0, 1)
+
+	pages := fake.Pages(db.ID)
+	if len(pages) != 1 {
+		t.Fatalf("expect 1 journal, got %v", len(pages))
+	}
+	if title, _ := transformer.GetPageTitle(pages[0]); title != tomorrow.Format(cfg.TitleFormat) {
+		t.Errorf("expect title %v, got %v", tomorrow.Format(cfg.TitleFormat), title)
+	}
+	date := pages[0].Properties.(notion.DatabasePageProperties)["Date"].Date
+	if date == nil || date.Start.Format(layoutDate) != tomorrow.Format(layoutDate) {
+		t.Errorf("expect date %v, got %+v", tomorrow.Format(layoutDate), date)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/dstotijn/go-notion"
+	"github.com/zhuochun/notion-toolset/retry"
 	"github.com/zhuochun/notion-toolset/transformer"
 )
 
@@ -21,19 +22,39 @@ type WeeklyJournalConfig struct {
 type WeeklyJournal struct {
 	DebugMode bool
 
-	Client *notion.Client
+	Client NotionAPI
+	Report *RunReport
+	Clock  Clock
 	WeeklyJournalConfig
 }
 
+func init() {
+	RegisterCmd(CmdSpec{
+		Name:        "weekly-journal",
+		Description: "Create weekly journal entries with title like YYYY-MM-DD/YYYY-MM-DD",
+		Section:     "weeklyJournal",
+		Config:      WeeklyJournalConfig{},
+		New: func(env CmdEnv, cfg Config) (Cmd, error) {
+			return &WeeklyJournal{
+				DebugMode:           env.DebugMode,
+				Client:              env.Client,
+				Report:              env.Report,
+				Clock:               env.Clock,
+				WeeklyJournalConfig: cfg.WeeklyJournal,
+			}, nil
+		},
+	})
+}
+
 func (d *WeeklyJournal) Validate() error {
 	return nil
 }
 
-func (d *WeeklyJournal) Run() error {
-	now := time.Now()
+func (d *WeeklyJournal) Run(ctx context.Context) error {
+	now := d.Clock.Now()
 	tCursor := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
 
-	pages, err := d.GetPages(tCursor)
+	pages, err := d.GetPages(ctx, tCursor)
 	if err != nil {
 		return err
 	}
@@ -41,22 +62,30 @@ func (d *WeeklyJournal) Run() error {
 	if d.DebugMode {
 		log.Printf("Pages found: %v", pages)
 	}
+	d.Report.AddScanned(len(pages))
 
 	for i := 0; i < d.Limit; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		tCursor = d.NextMonday(tCursor)
 		tSunday := tCursor.AddDate(0, 0, 6)
-		title := tCursor.Format(layoutDate) + "/" + tSunday.Format(layoutDate)
+		title := d.Clock.Title(tCursor) + "/" + d.Clock.Title(tSunday)
 
 		if pages[title] {
+			d.Report.AddSkipped(1)
 			continue
 		}
 
-		page, err := d.CreatePage(title, tCursor, tSunday)
+		page, err := d.CreatePage(ctx, title, tCursor, tSunday)
 		if err != nil {
 			log.Printf("Create Page `%v` met Error: %v", title, err)
+			d.Report.AddFailed(title, err)
 			continue
 		}
 		log.Printf("Created page `%v` with ID: %v", title, page.ID)
+		d.Report.AddWritten(1)
 	}
 
 	return nil
@@ -70,31 +99,25 @@ func (d *WeeklyJournal) NextMonday(tCursor time.Time) time.Time {
 	}
 }
 
-func (d *WeeklyJournal) GetPages(tCursor time.Time) (map[string]bool, error) {
-	queryData, err := Tmpl("DatabaseQuery", d.PageQuery, QueryBuilder{
-		Date: tCursor.Format(layoutDate),
-	})
-	if err != nil {
+func (d *WeeklyJournal) GetPages(ctx context.Context, tCursor time.Time) (map[string]bool, error) {
+	q := NewDatabaseQuery(d.Client, d.DatabaseID)
+	q.Clock = d.Clock
+	if err := q.SetQuery(ctx, QuerySpec{Template: d.PageQuery}, QueryBuilder{Date: d.Clock.Date(tCursor)}); err != nil {
 		return nil, err
 	}
 
-	query := &notion.DatabaseQuery{}
-	if err := json.Unmarshal(queryData, query); err != nil {
-		return nil, fmt.Errorf("unmarshal DatabaseQuery: %w", err)
-	}
-
 	if d.DebugMode {
-		log.Printf("DatabaseQuery Filter: %+v", query.Filter)
-		log.Printf("DatabaseQuery Sorter: %+v", query.Sorts)
+		log.Printf("DatabaseQuery Filter: %+v", q.Query.Filter)
+		log.Printf("DatabaseQuery Sorter: %+v", q.Query.Sorts)
 	}
 
-	resp, err := d.Client.QueryDatabase(context.TODO(), d.DatabaseID, query)
+	results, err := q.Once(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	pages := map[string]bool{}
-	for _, page := range resp.Results {
+	for _, page := range results {
 		title, err := transformer.GetPageTitle(page)
 		if err != nil {
 			return nil, fmt.Errorf("invalid DatabaseQuery response: %w", err)
@@ -104,13 +127,13 @@ func (d *WeeklyJournal) GetPages(tCursor time.Time) (map[string]bool, error) {
 	return pages, nil
 }
 
-func (d *WeeklyJournal) CreatePage(title string, date, dateEnd time.Time) (notion.Page, error) {
+func (d *WeeklyJournal) CreatePage(ctx context.Context, title string, date, dateEnd time.Time) (notion.Page, error) {
 	propData, err := Tmpl("CreatePage Properties", d.PageProperties, PageBuilder{
 		Title:      title,
-		Date:       date.Format(layoutDate),
-		DateEnd:    dateEnd.Format(layoutDate),
+		Date:       d.Clock.Date(date),
+		DateEnd:    d.Clock.Date(dateEnd),
 		DatabaseID: d.DatabaseID,
-	})
+	}, d.Clock)
 	if err != nil {
 		return notion.Page{}, err
 	}
@@ -124,9 +147,15 @@ func (d *WeeklyJournal) CreatePage(title string, date, dateEnd time.Time) (notio
 		log.Printf("Page properties: %+v", props)
 	}
 
-	return d.Client.CreatePage(context.TODO(), notion.CreatePageParams{
-		ParentType:             notion.ParentTypeDatabase,
-		ParentID:               d.DatabaseID,
-		DatabasePageProperties: props,
+	var page notion.Page
+	err = retry.Write.Do(ctx, func(ctx context.Context) error {
+		var innerErr error
+		page, innerErr = d.Client.CreatePage(ctx, notion.CreatePageParams{
+			ParentType:             notion.ParentTypeDatabase,
+			ParentID:               d.DatabaseID,
+			DatabasePageProperties: props,
+		})
+		return innerErr
 	})
+	return page, err
 }
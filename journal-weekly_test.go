@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/zhuochun/notion-toolset/notiontest"
+	"github.com/zhuochun/notion-toolset/transformer"
+)
+
+func TestWeeklyJournal(t *testing.T) {
+	fake := notiontest.New()
+	db := fake.AddDatabase("Weekly", notion.DatabaseProperties{"Period": {Type: notion.DBPropTypeDate}})
+
+	cfg := readTestConfig(t, "journal-weekly.yaml")
+	cfg.WeeklyJournal.DatabaseID = db.ID
+	cfg.WeeklyJournal.Limit = 2
+
+	_, report := runTestCmd(t, "weekly-journal", fake, cfg)
+	if report.Written != 2 || report.Failed != 0 {
+		t.Errorf("unexpected report: %v", report)
+	}
+
+	// run again, the existing weeks are skipped
+	_, report = runTestCmd(t, "weekly-journal", fake, cfg)
+	if report.Written != 0 || report.Skipped != 2 {
+		t.Errorf("expect existing weeks skipped, got report: %v", report)
+	}
+
+	pages := fake.Pages(db.ID)
+	if len(pages) != 2 {
+		t.Fatalf("expect 2 weekly pages, got %d", len(pages))
+	}
+	for _, page := range pages {
+		title, _ := transformer.GetPageTitle(page)
+		period := page.Properties.(notion.DatabasePageProperties)["Period"].Date
+		if period == nil || period.End == nil || !strings.HasPrefix(title, period.Start.Format(layoutDate)+"/") {
+			t.Errorf("unexpected week %v, period: %+v", title, period)
+		}
+	}
+}
@@ -5,8 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"html/template"
 	"log"
+	"net/http"
 	"os"
 	"strings"
 	"sync"
@@ -14,14 +14,18 @@ import (
 
 	"github.com/dstotijn/go-notion"
 	"github.com/sashabaranov/go-openai"
+	"github.com/zhuochun/notion-toolset/retry"
 	"github.com/zhuochun/notion-toolset/transformer"
-	"golang.org/x/time/rate"
 )
 
 type LangModelConfig struct {
-	DatabaseID    string `yaml:"databaseID"`
-	DatabaseQuery string `yaml:"databaseQuery"`
-	LookbackDays  int    `yaml:"lookbackDays"` // additional date info
+	DatabaseID    string       `yaml:"databaseID"`
+	DatabaseQuery string       `yaml:"databaseQuery"`
+	Filter        string       `yaml:"filter"`       // or a filter instead, e.g. `Tags contains Review and "Edited At" after -1d`
+	Sort          string       `yaml:"sort"`         // optional, sorts of the filter
+	Search        *SearchSpec  `yaml:"search"`       // or search the workspace instead, e.g. pages edited this week
+	Source        SourceConfig `yaml:"source"`       // or any source, e.g. databaseIDs, rootPageID, file, overrides the above
+	LookbackDays  int          `yaml:"lookbackDays"` // additional date info
 	// Read from a chain file instead of database, overwrite database configs above
 	// chain file is supported in flashback
 	ChainFile string `yaml:"chainFile"`
@@ -36,27 +40,59 @@ type LangModelConfig struct {
 	// LLM response format
 	// - format follow https://pkg.go.dev/github.com/dstotijn/go-notion#ParagraphBlock
 	// - when using JSON mode, always instruct the model to produce JSON via some message in the conversation
-	RespJSON      bool   `yaml:"respJSON"`      // optional, default to false
-	RespTextBlock string `yaml:"respTextBlock"` // mandatory for JSON model, else optional and default convert to paragraphs
-	// Tuning https://developers.notion.com/reference/request-limits
+	RespJSON      bool        `yaml:"respJSON"`      // optional, default to false
+	RespTextBlock string      `yaml:"respTextBlock"` // mandatory for JSON model, else optional and default convert to paragraphs
+	RespAnchor    WriteAnchor `yaml:"respAnchor"`    // optional, where to write in the page, e.g. under: "Summary"
+	// Tuning, number of workers, requests to Notion are limited by --notion-rate
 	TaskSpeed float64 `yaml:"taskSpeed"` // optional
 	// skip processing a pages if chars is <min or >max thresholds
 	PageMinChars int `yaml:"pageMinChars"`
 	PageMaxChars int `yaml:"pageMaxChars"`
+	// pages processed are recorded in --state and skipped in later runs,
+	// set "changed" to rerun pages edited since processed
+	StateRefresh string `yaml:"stateRefresh"` // optional
 }
 
 type LangModel struct {
 	DebugMode bool
 	ExecOne   string
 
-	Client       *notion.Client
+	Client       NotionAPI
+	Report       *RunReport
+	Clock        Clock
+	State        *CmdState
+	Cache        *PageCache
 	OpenaiClient *openai.Client
 
 	LangModelConfig
 
-	queryLimiter *rate.Limiter
-	taskPool     chan notion.Page
-	queryPool    chan *transformer.BlockFuture
+	inputPages  []notion.Page
+	outputPages []notion.Page
+	outputMu    sync.Mutex
+
+	taskPool  chan notion.Page
+	queryPool chan *transformer.BlockFuture
+}
+
+func init() {
+	RegisterCmd(CmdSpec{
+		Name:        "llm",
+		Description: "Run custom prompt on pages from a database",
+		Section:     "llm",
+		Config:      LangModelConfig{},
+		New: func(env CmdEnv, cfg Config) (Cmd, error) {
+			return &LangModel{
+				DebugMode:       env.DebugMode,
+				ExecOne:         env.ExecOne,
+				Client:          env.Client,
+				Report:          env.Report,
+				Clock:           env.Clock,
+				State:           env.CmdState("llm", cfg),
+				Cache:           env.Cache,
+				LangModelConfig: cfg.LLM,
+			}, nil
+		},
+	})
 }
 
 func (m *LangModel) Validate() error {
@@ -64,20 +100,29 @@ func (m *LangModel) Validate() error {
 		return errors.Join(ErrConfigRequired, fmt.Errorf("set Prompt"))
 	}
 
+	if m.StateRefresh != "" && m.StateRefresh != "changed" {
+		return fmt.Errorf("invalid stateRefresh: %v, use changed or leave empty", m.StateRefresh)
+	}
+
+	if err := m.RespAnchor.Validate(); err != nil {
+		return err
+	}
+
 	// init OpenAI client
 	openaiToken := os.Getenv("DOT_OPENAI_KEY")
+	if openaiToken == "" && isReplaying() {
+		openaiToken = redacted
+	}
 	if openaiToken == "" {
 		return fmt.Errorf("missing token in env.DOT_OPENAI_KEY")
 	}
 
-	openaiURL := os.Getenv("DOT_OPENAI_URL")
-	if openaiURL != "" {
-		cfg := openai.DefaultConfig(openaiToken)
+	cfg := openai.DefaultConfig(openaiToken)
+	if openaiURL := os.Getenv("DOT_OPENAI_URL"); openaiURL != "" {
 		cfg.BaseURL = openaiURL
-		m.OpenaiClient = openai.NewClientWithConfig(cfg)
-	} else {
-		m.OpenaiClient = openai.NewClient(openaiToken)
 	}
+	cfg.HTTPClient = &http.Client{Transport: newHTTPTransport()}
+	m.OpenaiClient = openai.NewClientWithConfig(cfg)
 
 	// set default exportspeed
 	if m.TaskSpeed < 1 {
@@ -89,25 +134,27 @@ func (m *LangModel) Validate() error {
 	return nil
 }
 
-func (m *LangModel) Run() error {
+func (m *LangModel) Run(ctx context.Context) error {
 	if m.GroupExec {
-		return m.runLLMGroup()
+		return m.runLLMGroup(ctx)
 	}
 
-	m.queryLimiter = rate.NewLimiter(rate.Limit(m.TaskSpeed), int(m.TaskSpeed))
-
 	// workers to process LLM prompt per page
 	taskWg := new(sync.WaitGroup)
-	m.taskPool = m.StartLLMTasker(taskWg, int(m.TaskSpeed))
+	m.taskPool = m.StartLLMTasker(ctx, taskWg, int(m.TaskSpeed))
 	// workers to query content of notion blocks
 	queryWg := new(sync.WaitGroup)
-	m.queryPool = m.StartQuerier(queryWg, int(m.TaskSpeed))
+	m.queryPool = m.StartQuerier(ctx, queryWg, int(m.TaskSpeed))
 
 	// query database pages, queue each pages for export
-	pagesChan, errChan := m.ScanPages()
+	pagesChan, errChan := m.ScanPages(ctx)
 	pageNum := 0
 	for pages := range pagesChan {
 		for _, page := range pages {
+			if ctx.Err() != nil { // stop queueing when interrupted, drain the scanned pages
+				break
+			}
+
 			pageNum += 1
 			m.taskPool <- page
 
@@ -117,6 +164,7 @@ func (m *LangModel) Run() error {
 		}
 	}
 	log.Printf("Scanned pages: %v", pageNum)
+	m.Report.AddScanned(pageNum)
 
 	close(m.taskPool) // TODO do not support sub-page now, same as export cmd
 	taskWg.Wait()
@@ -128,74 +176,58 @@ func (m *LangModel) Run() error {
 	case err := <-errChan:
 		return err
 	default:
-		return nil
+		return ctx.Err()
 	}
 }
 
-func (m *LangModel) ScanPages() (chan []notion.Page, chan error) {
-	if m.ExecOne != "" { // exec one page ID
-		return m.scanDirectPages([]string{m.ExecOne})
-	}
-
-	if m.ChainFile != "" { // exec IDs found in a file
-		content, err := os.ReadFile(m.ChainFile)
-		if err != nil {
-			log.Printf("Open file errored, file: %v, err: %v", m.ChainFile, err)
-			return m.scanDirectPages([]string{})
-		}
-
-		normalizedContent := strings.Replace(string(content), "\r\n", "\n", -1)
-		pageIDs := strings.Split(normalizedContent, "\n")
-
-		return m.scanDirectPages(pageIDs)
-	}
-
-	return m.scanDatabasePages()
+func (m *LangModel) SetInputPages(pages []notion.Page) {
+	m.inputPages = pages
 }
 
-func (m *LangModel) scanDirectPages(pageIDs []string) (chan []notion.Page, chan error) {
-	pagesChan := make(chan []notion.Page, len(pageIDs))
-	errChan := make(chan error, 1)
+// OutputPages are the pages written with the LLM response
+func (m *LangModel) OutputPages() []notion.Page {
+	m.outputMu.Lock()
+	defer m.outputMu.Unlock()
 
-	for _, pageID := range pageIDs {
-		if pageID == "" {
-			continue
-		}
-		pageID = transformer.SimpleID(pageID)
+	return m.outputPages
+}
 
-		if page, err := m.Client.FindPageByID(context.Background(), pageID); err == nil {
-			pagesChan <- []notion.Page{page}
-		} else {
-			errChan <- err
-		}
+func (m *LangModel) ScanPages(ctx context.Context) (chan []notion.Page, chan error) {
+	if m.inputPages != nil { // pages from an earlier pipeline step
+		pagesChan := make(chan []notion.Page, 1)
+		pagesChan <- m.inputPages
+		close(pagesChan)
+		return pagesChan, make(chan error, 1)
 	}
 
-	close(pagesChan)
-	return pagesChan, errChan
-}
-
-func (m *LangModel) scanDatabasePages() (chan []notion.Page, chan error) {
-	q := NewDatabaseQuery(m.Client, m.DatabaseID)
+	source := m.Source.Or(SourceConfig{DatabaseID: m.DatabaseID, DatabaseQuery: m.DatabaseQuery, Filter: m.Filter, Sort: m.Sort, Search: m.Search})
+	if m.ExecOne != "" { // exec one page ID
+		source = SourceConfig{PageIDs: []string{m.ExecOne}}
+	} else if m.ChainFile != "" { // exec IDs found in a file
+		source = SourceConfig{File: m.ChainFile}
+	}
 
-	today := time.Now().Format(layoutDate)
+	now := m.Clock.Now()
+	today := m.Clock.Date(now)
 	date := "" // default
 	if m.LookbackDays > 0 {
-		date = time.Now().AddDate(0, 0, -m.LookbackDays).Format(layoutDate)
+		date = m.Clock.Date(now.AddDate(0, 0, -m.LookbackDays))
 	}
 
-	if err := q.SetQuery(m.DatabaseQuery, QueryBuilder{Date: date, Today: today}); err != nil {
-		log.Panicf("Invalid query: %v, err: %v", m.DatabaseQuery, err)
+	src, err := NewPageSource(ctx, m.Client, m.Clock, source, QueryBuilder{Date: date, Today: today})
+	if err != nil {
+		return errPages(err)
 	}
 
 	if m.DebugMode {
-		log.Printf("DatabaseQuery Filter: %+v", q.Query.Filter)
-		log.Printf("DatabaseQuery Sorter: %+v", q.Query.Sorts)
+		logSource(src)
 	}
-
-	return q.Go(context.Background(), 1, m.queryLimiter)
+	return GoPages(ctx, src, 1)
 }
 
-func (m *LangModel) StartQuerier(wg *sync.WaitGroup, size int) chan *transformer.BlockFuture {
+// StartQuerier starts workers to query blocks, a task gets an error when ctx is done,
+// so the transformer waiting for it is never blocked
+func (m *LangModel) StartQuerier(ctx context.Context, wg *sync.WaitGroup, size int) chan *transformer.BlockFuture {
 	taskPool := make(chan *transformer.BlockFuture, size)
 
 	for i := 0; i < size; i++ {
@@ -203,7 +235,7 @@ func (m *LangModel) StartQuerier(wg *sync.WaitGroup, size int) chan *transformer
 
 		go func() {
 			for task := range taskPool {
-				blocks, err := m.QueryBlocks(task.BlockID) // TODO add retry?
+				blocks, err := m.Cache.Lookup(task.PageID).Children(ctx, task.BlockID, m.QueryBlocks) // TODO add retry?
 				task.Write(blocks, err)
 			}
 			wg.Done()
@@ -213,14 +245,17 @@ func (m *LangModel) StartQuerier(wg *sync.WaitGroup, size int) chan *transformer
 	return taskPool
 }
 
-func (m *LangModel) QueryBlocks(blockID string) ([]notion.Block, error) {
-	m.queryLimiter.Wait(context.Background())
-
+func (m *LangModel) QueryBlocks(ctx context.Context, blockID string) ([]notion.Block, error) {
 	blocks := []notion.Block{}
 	cursor := ""
 	for {
 		query := &notion.PaginationQuery{StartCursor: cursor}
-		resp, err := m.Client.FindBlockChildrenByID(context.TODO(), blockID, query)
+		var resp notion.BlockChildrenResponse
+		err := retry.Do(ctx, func(ctx context.Context) error {
+			var innerErr error
+			resp, innerErr = m.Client.FindBlockChildrenByID(ctx, blockID, query)
+			return innerErr
+		})
 		if err != nil {
 			return blocks, err
 		}
@@ -237,7 +272,8 @@ func (m *LangModel) QueryBlocks(blockID string) ([]notion.Block, error) {
 	return blocks, nil
 }
 
-func (m *LangModel) StartLLMTasker(wg *sync.WaitGroup, size int) chan notion.Page {
+// StartLLMTasker starts workers to run LLM on pages, queued pages are skipped when ctx is done
+func (m *LangModel) StartLLMTasker(ctx context.Context, wg *sync.WaitGroup, size int) chan notion.Page {
 	taskPool := make(chan notion.Page, size)
 
 	for i := 0; i < size; i++ {
@@ -245,8 +281,13 @@ func (m *LangModel) StartLLMTasker(wg *sync.WaitGroup, size int) chan notion.Pag
 
 		go func() {
 			for page := range taskPool {
-				if err := m.runLLMPage(page); err != nil {
+				if ctx.Err() != nil {
+					continue
+				}
+
+				if err := m.runLLMPage(ctx, page); err != nil {
 					log.Printf("Failed to run LLM: %v", err)
+					m.Report.AddFailed(page.ID, err)
 				}
 			}
 
@@ -257,19 +298,22 @@ func (m *LangModel) StartLLMTasker(wg *sync.WaitGroup, size int) chan notion.Pag
 	return taskPool
 }
 
-func (m *LangModel) runLLMGroup() error {
-	m.queryLimiter = rate.NewLimiter(rate.Limit(m.TaskSpeed), int(m.TaskSpeed))
-
+func (m *LangModel) runLLMGroup(ctx context.Context) error {
 	// workers to query content of notion blocks
 	queryWg := new(sync.WaitGroup)
-	m.queryPool = m.StartQuerier(queryWg, int(m.TaskSpeed))
+	m.queryPool = m.StartQuerier(ctx, queryWg, int(m.TaskSpeed))
+	defer func() {
+		close(m.queryPool)
+		queryWg.Wait()
+	}()
 
-	pagesChan, errChan := m.ScanPages()
+	pagesChan, errChan := m.ScanPages(ctx)
 	pages := []notion.Page{}
 	for ps := range pagesChan {
 		pages = append(pages, ps...)
 	}
 	log.Printf("Scanned pages: %v", len(pages))
+	m.Report.AddScanned(len(pages))
 
 	select {
 	case err := <-errChan:
@@ -281,50 +325,41 @@ func (m *LangModel) runLLMGroup() error {
 
 	var contents []string
 	for _, page := range pages {
-		blocks, err := m.QueryBlocks(page.ID)
+		content, err := m.PageContent(ctx, page)
 		if err != nil {
-			return fmt.Errorf("query block id: %v, err: %v", page.ID, err)
-		}
-
-		markdown := transformer.MarkdownConfig{
-			NoAlias:        true,
-			NoFrontMatters: true,
-			NoMetadata:     true,
-			TitleToH1:      true,
-			PlainText:      true,
+			return err
 		}
 
-		t := transformer.New(markdown, &page, blocks, m.queryPool, nil)
-		content := t.Transform()
-
 		if len(content) < m.PageMinChars {
 			log.Printf("Skip content by MinChars=%v, id: %v, len: %v", m.PageMinChars, page.ID, len(content))
+			m.Report.AddSkipped(1)
 			continue
 		} else if m.PageMaxChars > 0 && len(content) > m.PageMaxChars {
 			log.Printf("Skip content by MaxChars=%v, id: %v, len: %v", m.PageMaxChars, page.ID, len(content))
+			m.Report.AddSkipped(1)
 			continue
 		}
 
 		contents = append(contents, content)
 	}
 
-	close(m.queryPool)
-	queryWg.Wait()
-
+	if err := ctx.Err(); err != nil { // contents are incomplete
+		return err
+	}
 	if len(contents) == 0 {
 		return nil
 	}
 
 	target := notion.Page{}
 	if m.GroupJournalID != "" {
-		p, err := m.getJournalPage()
+		p, err := m.getJournalPage(ctx)
 		if err != nil {
 			return err
 		}
 		target = p
 	}
 	if target.ID == "" && m.ExecOne != "" {
-		p, err := m.Client.FindPageByID(context.Background(), transformer.SimpleID(m.ExecOne))
+		p, err := m.Client.FindPageByID(ctx, transformer.SimpleID(m.ExecOne))
 		if err == nil {
 			target = p
 		}
@@ -334,13 +369,81 @@ func (m *LangModel) runLLMGroup() error {
 	}
 
 	content := strings.Join(contents, "\n")
-	return m.runLLMContent(target, content)
+	hash := contentHash(content)
+	if entry, found := m.State.Get(target.ID); found && entry.Hash == hash && m.ExecOne == "" {
+		log.Printf("Skip group processed at %v with the same pages, id: %v", entry.ProcessedAt.Format(time.RFC3339), target.ID)
+		m.Report.AddSkipped(1)
+		return nil
+	}
+
+	if err := m.runLLMContent(ctx, target, content); err != nil {
+		return err
+	}
+	m.saveState(target.ID, hash)
+	return nil
+}
+
+func (m *LangModel) runLLMPage(ctx context.Context, page notion.Page) error {
+	entry, processed := m.State.Get(page.ID)
+	processed = processed && m.ExecOne == "" // --one reruns the page
+	if processed && m.StateRefresh != "changed" {
+		log.Printf("Skip page processed at %v, id: %v", entry.ProcessedAt.Format(time.RFC3339), page.ID)
+		m.Report.AddSkipped(1)
+		return nil
+	}
+
+	content, err := m.PageContent(ctx, page)
+	if err != nil {
+		return err
+	}
+
+	if processed && entry.Hash == contentHash(content) {
+		log.Printf("Skip page unchanged since processed at %v, id: %v", entry.ProcessedAt.Format(time.RFC3339), page.ID)
+		m.Report.AddSkipped(1)
+		return nil
+	}
+
+	if len(content) < m.PageMinChars {
+		log.Printf("Skip content by MinChars=%v, id: %v, len: %v", m.PageMinChars, page.ID, len(content))
+		m.Report.AddSkipped(1)
+		return nil
+	} else if m.PageMaxChars > 0 && len(content) > m.PageMaxChars {
+		log.Printf("Skip content by MaxChars=%v, id: %v, len: %v", m.PageMaxChars, page.ID, len(content))
+		m.Report.AddSkipped(1)
+		return nil
+	}
+
+	if err := m.runLLMContent(ctx, page, content); err != nil {
+		return err
+	}
+
+	if m.StateRefresh == "changed" { // hash the page with the response, it is unchanged until edited
+		if content, err = m.pageContent(ctx, page, nil); err != nil { // the cache is before the response
+			log.Printf("Failed to read page for state, id: %v, err: %v", page.ID, err)
+		}
+	}
+	m.saveState(page.ID, contentHash(content))
+	return nil
+}
+
+// PageContent reads the page as plain markdown for the LLM
+func (m *LangModel) PageContent(ctx context.Context, page notion.Page) (string, error) {
+	cached := m.Cache.Open(page, m.Report)
+	defer func() {
+		if err := cached.Close(); err != nil {
+			log.Printf("Failed to cache page: %v", err)
+		}
+	}()
+
+	return m.pageContent(ctx, page, cached)
 }
 
-func (m *LangModel) runLLMPage(page notion.Page) error {
-	blocks, err := m.QueryBlocks(page.ID)
+// pageContent reads the page with its blocks from the cached page, a nil cached page
+// queries all blocks
+func (m *LangModel) pageContent(ctx context.Context, page notion.Page, cached *CachedPage) (string, error) {
+	blocks, err := cached.Children(ctx, page.ID, m.QueryBlocks)
 	if err != nil {
-		return fmt.Errorf("query block id: %v, err: %v", page.ID, err)
+		return "", fmt.Errorf("query block id: %v, err: %v", page.ID, err)
 	}
 
 	markdown := transformer.MarkdownConfig{
@@ -352,20 +455,17 @@ func (m *LangModel) runLLMPage(page notion.Page) error {
 	}
 
 	t := transformer.New(markdown, &page, blocks, m.queryPool, nil)
-	content := t.Transform()
+	return t.Transform(), nil
+}
 
-	if len(content) < m.PageMinChars {
-		log.Printf("Skip content by MinChars=%v, id: %v, len: %v", m.PageMinChars, page.ID, len(content))
-		return nil
-	} else if m.PageMaxChars > 0 && len(content) > m.PageMaxChars {
-		log.Printf("Skip content by MaxChars=%v, id: %v, len: %v", m.PageMaxChars, page.ID, len(content))
-		return nil
+// saveState records the page processed, a failure only loses the skip in the next run
+func (m *LangModel) saveState(pageID, hash string) {
+	if err := m.State.Put(pageID, hash); err != nil {
+		log.Printf("Failed to save state, id: %v, err: %v", pageID, err)
 	}
-
-	return m.runLLMContent(page, content)
 }
 
-func (m *LangModel) runLLMContent(page notion.Page, content string) error {
+func (m *LangModel) runLLMContent(ctx context.Context, page notion.Page, content string) error {
 	req := openai.ChatCompletionRequest{
 		Model: openai.GPT3Dot5Turbo,
 		Messages: []openai.ChatCompletionMessage{
@@ -394,16 +494,21 @@ func (m *LangModel) runLLMContent(page notion.Page, content string) error {
 		}
 	}
 
-	resp, err := m.OpenaiClient.CreateChatCompletion(context.Background(), req)
+	var resp openai.ChatCompletionResponse
+	err := retry.LLM.Do(ctx, func(ctx context.Context) error {
+		var innerErr error
+		resp, innerErr = m.OpenaiClient.CreateChatCompletion(ctx, req)
+		return innerErr
+	})
 	if err != nil {
 		return fmt.Errorf("openai chat err: %v", err)
 	}
 
 	block := notion.BlockChildrenResponse{}
 	if m.RespJSON {
-		block, err = m.WriteJSON(page, resp.Choices[0].Message.Content)
+		block, err = m.WriteJSON(ctx, page, resp.Choices[0].Message.Content)
 	} else {
-		block, err = m.WriteBlock(page, resp.Choices[0].Message.Content)
+		block, err = m.WriteBlock(ctx, page, resp.Choices[0].Message.Content)
 	}
 	if err != nil {
 		return err
@@ -411,42 +516,46 @@ func (m *LangModel) runLLMContent(page notion.Page, content string) error {
 	if len(block.Results) > 0 {
 		log.Printf("Append block child %v", block.Results[0].ID())
 	}
+	m.Report.AddWritten(1)
+
+	m.outputMu.Lock()
+	m.outputPages = append(m.outputPages, page)
+	m.outputMu.Unlock()
 	return nil
 }
 
-func (m *LangModel) WriteBlock(page notion.Page, content string) (notion.BlockChildrenResponse, error) {
+func (m *LangModel) WriteBlock(ctx context.Context, page notion.Page, content string) (notion.BlockChildrenResponse, error) {
 	w := NewAppendBlock(m.Client, page.ID)
+	w.Clock = m.Clock
+	w.Anchor = m.RespAnchor
 
-	paragraphs := strings.Split(content, "\n")
+	if m.RespTextBlock == "" { // markdown of the response as blocks
+		w.AddMarkdown(content)
+		return w.Do(ctx)
+	}
 
-	for _, p := range paragraphs {
+	for _, p := range strings.Split(content, "\n") {
 		if p == "" { // skip empty lines
 			continue
 		}
 
 		p = strings.TrimPrefix(p, "- ") // TODO better handle response text
 
-		if m.RespTextBlock != "" {
-			if err := w.AddParagraph("LLM", m.RespTextBlock, BlockBuilder{
-				Date:    time.Now().Format(layoutDate),
-				Content: template.HTMLEscaper(p),
-			}); err != nil {
-				return notion.BlockChildrenResponse{}, err
-			}
-		} else {
-			w.Blocks = append(w.Blocks, &notion.ParagraphBlock{
-				RichText: []notion.RichText{
-					{Text: &notion.Text{Content: p}},
-				},
-			})
+		if err := w.AddParagraph("LLM", m.RespTextBlock, BlockBuilder{
+			Date:    m.Clock.Date(m.Clock.Now()),
+			Content: p,
+		}); err != nil {
+			return notion.BlockChildrenResponse{}, err
 		}
 	}
 
-	return w.Do(context.TODO())
+	return w.Do(ctx)
 }
 
-func (m *LangModel) WriteJSON(page notion.Page, content string) (notion.BlockChildrenResponse, error) {
+func (m *LangModel) WriteJSON(ctx context.Context, page notion.Page, content string) (notion.BlockChildrenResponse, error) {
 	w := NewAppendBlock(m.Client, page.ID)
+	w.Clock = m.Clock
+	w.Anchor = m.RespAnchor
 
 	contentJSON := map[string]interface{}{}
 	if err := json.Unmarshal([]byte(content), &contentJSON); err != nil {
@@ -457,12 +566,11 @@ func (m *LangModel) WriteJSON(page notion.Page, content string) (notion.BlockChi
 		return notion.BlockChildrenResponse{}, err
 	}
 
-	return w.Do(context.TODO())
+	return w.Do(ctx)
 }
 
-func (m *LangModel) getJournalPage() (notion.Page, error) {
-	now := time.Now()
-	title := now.Format(layoutDate)
+func (m *LangModel) getJournalPage(ctx context.Context) (notion.Page, error) {
+	title := m.Clock.Title(m.Clock.Now())
 
 	q := NewDatabaseQuery(m.Client, m.GroupJournalID)
 	q.Query = &notion.DatabaseQuery{
@@ -477,7 +585,7 @@ func (m *LangModel) getJournalPage() (notion.Page, error) {
 		},
 	}
 
-	pages, err := q.Once(context.TODO())
+	pages, err := q.Once(ctx)
 	if err != nil {
 		return notion.Page{}, fmt.Errorf("no journal found: %v, err: %v", title, err)
 	}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/zhuochun/notion-toolset/notiontest"
+)
+
+func TestLangModel(t *testing.T) {
+	prompts := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := struct {
+			Messages []struct{ Content string } `json:"messages"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&req)
+		prompts <- req.Messages[len(req.Messages)-1].Content
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "First **point**\n\n- Second point\n  - Nested point"}}]}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("DOT_OPENAI_KEY", "test-key")
+	t.Setenv("DOT_OPENAI_URL", server.URL)
+
+	fake := notiontest.New()
+	db := fake.AddDatabase("Notes", nil)
+	page := fake.AddPage(notiontest.DatabasePage(db.ID, "Long read"), notiontest.Paragraph("Some content to summarize"))
+	fake.AddPage(notiontest.DatabasePage(db.ID, "Empty")) // skipped by pageMinChars
+
+	cfg := Config{LLM: LangModelConfig{
+		DatabaseID:   db.ID,
+		Prompt:       "Summarize",
+		PageMinChars: 20,
+	}}
+
+	cmd, report := runTestCmd(t, "llm", fake, cfg)
+
+	if report.Scanned != 2 || report.Skipped != 1 || report.Written != 1 {
+		t.Errorf("unexpected report: %v", report)
+	}
+
+	if prompt := <-prompts; !strings.Contains(prompt, "Some content to summarize") {
+		t.Errorf("expect page content in prompt, got %q", prompt)
+	}
+
+	blocks := fake.Children(page.ID)
+	if len(blocks) != 3 {
+		t.Fatalf("expect response appended as a paragraph and a list, got %d blocks", len(blocks))
+	}
+	if p := blocks[1].(*notion.ParagraphBlock); len(p.RichText) != 2 || !p.RichText[1].Annotations.Bold {
+		t.Errorf("expect bold in paragraph: %+v", p.RichText)
+	}
+	if item, ok := blocks[2].(*notion.BulletedListItemBlock); !ok || item.RichText[0].PlainText != "Second point" {
+		t.Errorf("unexpected list item: %+v", blocks[2])
+	} else if nested := fake.Children(item.ID()); len(nested) != 1 {
+		t.Errorf("expect a nested list item, got %d blocks", len(nested))
+	}
+
+	if out := cmd.(PageProducer).OutputPages(); len(out) != 1 || out[0].ID != page.ID {
+		t.Errorf("expect output %v, got %+v", page.ID, out)
+	}
+}
+
+func TestLangModelState(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "Summary"}}]}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("DOT_OPENAI_KEY", "test-key")
+	t.Setenv("DOT_OPENAI_URL", server.URL)
+
+	fake := notiontest.New()
+	db := fake.AddDatabase("Notes", nil)
+	page := fake.AddPage(notiontest.DatabasePage(db.ID, "Long read"), notiontest.Paragraph("Some content to summarize"))
+
+	store, err := OpenFileStateStore(t.TempDir() + "/state.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := CmdEnv{Client: fake, State: store}
+	cfg := Config{LLM: LangModelConfig{DatabaseID: db.ID, Prompt: "Summarize", StateRefresh: "changed"}}
+
+	if _, report := runTestCmdEnv(t, "llm", env, cfg); report.Written != 1 {
+		t.Fatalf("expect page summarized, got report: %v", report)
+	}
+	if _, report := runTestCmdEnv(t, "llm", env, cfg); report.Written != 0 || report.Skipped != 1 {
+		t.Errorf("expect unchanged page skipped, got report: %v", report)
+	}
+
+	fake.AppendBlockChildren(t.Context(), page.ID, []notion.Block{notiontest.Paragraph("Edited")})
+	if _, report := runTestCmdEnv(t, "llm", env, cfg); report.Written != 1 {
+		t.Errorf("expect edited page summarized again, got report: %v", report)
+	}
+
+	if blocks := fake.Children(page.ID); len(blocks) != 4 {
+		t.Errorf("expect 2 summaries appended, got %d blocks", len(blocks))
+	}
+
+	env.ExecOne = page.ID
+	if _, report := runTestCmdEnv(t, "llm", env, cfg); report.Written != 1 {
+		t.Errorf("expect --one to rerun the processed page, got report: %v", report)
+	}
+}
+
+func TestLangModelWriteBlockEscapes(t *testing.T) {
+	fake := notiontest.New()
+	page := fake.AddPage(notiontest.DatabasePage(fake.AddDatabase("Notes", nil).ID, "Target"))
+
+	m := &LangModel{Client: fake, LangModelConfig: LangModelConfig{
+		RespTextBlock: `{"rich_text": [{"type": "text", "text": {"content": "{{.Content}}"}}]}`,
+	}}
+	if _, err := m.WriteBlock(t.Context(), page, "Say \"hi\" to Tom & Jerry\n- <b>bold</b>"); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := fake.Children(page.ID)
+	if len(blocks) != 2 {
+		t.Fatalf("expect 2 paragraphs, got %d blocks", len(blocks))
+	}
+	for i, want := range []string{`Say "hi" to Tom & Jerry`, "<b>bold</b>"} {
+		if p := blocks[i].(*notion.ParagraphBlock); p.RichText[0].PlainText != want {
+			t.Errorf("expect %q, got %q", want, p.RichText[0].PlainText)
+		}
+	}
+}
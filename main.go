@@ -1,14 +1,17 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"regexp"
 	"strings"
-
-	"github.com/dstotijn/go-notion"
-	"github.com/go-yaml/yaml"
+	"syscall"
+	"time"
 )
 
 var (
@@ -19,6 +22,16 @@ var (
 	flagRepeat     = flag.Int("repeat", 1, "Repeat this command")                                 // start with default 1 time
 	flagConfigPath = flag.String("config", "", "Path to config file")
 	flagDebugMode  = flag.Bool("debug", false, "Enable debug mode")
+	flagDryRun     = flag.Bool("dry-run", false, "Read from Notion but record writes into the plan file")
+	flagPlanPath   = flag.String("plan", "plan.json", "Path to plan file, written by --dry-run and read by apply")
+	flagJob        = flag.String("job", "", "Run jobs by names in the multiple config, comma separated")
+	flagTags       = flag.String("tags", "", "Run jobs having any of the tags in the multiple config, comma separated")
+	flagReportPath = flag.String("report-json", "", "Write the run reports as JSON to the path")
+	flagRecord     = flag.String("record", "", "Record Notion and OpenAI requests as fixtures into the dir, tokens redacted")
+	flagReplay     = flag.String("replay", "", "Replay requests from the fixtures in the dir, without network access")
+	flagNotionRate = flag.Float64("notion-rate", 2.8, "Max requests per second to Notion, shared by all cmds")
+	flagStatePath  = flag.String("state", "", "Path to the state file of processed pages, e.g. notion-state.json, empty to disable")
+	flagCacheDir   = flag.String("cache", "", "Dir to cache page blocks by last edited time, empty to disable")
 )
 
 var (
@@ -27,6 +40,16 @@ var (
 )
 
 type Config struct {
+	// job settings in multiple config
+	Name string   `yaml:"name"`
+	Cmd  string   `yaml:"cmd"` // default to --cmd
+	Tags []string `yaml:"tags"`
+
+	Timeout time.Duration `yaml:"timeout"` // optional, cancel the cmd after the duration, e.g. 30m
+
+	Timezone    string `yaml:"timezone"`    // optional, e.g. Asia/Singapore, default to local timezone
+	TitleFormat string `yaml:"titleFormat"` // optional, journal titles, e.g. "2006-01-02 Mon", default to 2006-01-02
+
 	Flashback        FlashbackConfig        `yaml:"flashback"`
 	DailyJournal     DailyJournalConfig     `yaml:"dailyJournal"`
 	WeeklyJournal    WeeklyJournalConfig    `yaml:"weeklyJournal"`
@@ -34,136 +57,237 @@ type Config struct {
 	Collector        CollectorConfig        `yaml:"collector"`
 	Exporter         ExporterConfig         `yaml:"exporter"`
 	LLM              LangModelConfig        `yaml:"llm"`
+	Query            QueryConfig            `yaml:"query"`
+	Pipeline         PipelineConfig         `yaml:"pipeline"`
+	Daemon           DaemonConfig           `yaml:"daemon"`
+
+	// sections of commands registered outside, read with DecodeSection
+	Extra map[string]interface{} `yaml:",inline"`
 }
 
 type Cmd interface {
 	// Validate check the config are correct
 	Validate() error
-	// Run the cmd
-	Run() error
+	// Run the cmd, stop early when ctx is done
+	Run(ctx context.Context) error
 }
 
 func main() {
 	flag.Parse()
 
-	if *flagExecOne != "" && strings.HasPrefix(*flagExecOne, "https:") {
-		matches := hashIDRegex.FindStringSubmatch(*flagExecOne)
-		// use the ID only
-		if len(matches) > 1 {
-			*flagExecOne = matches[1]
+	if *flagCmd == "" && flag.NArg() > 0 { // allow `notion-toolset <cmd> [flags]`
+		*flagCmd = flag.Arg(0)
+		flag.CommandLine.Parse(flag.Args()[1:])
+	}
 
-			log.Printf("Parsed ID: %v", *flagExecOne)
+	if *flagCmd == "help" {
+		if err := printHelp(os.Stdout, flag.Arg(0)); err != nil {
+			log.Fatalf("help: %v", err)
 		}
+		return
+	}
+
+	if *flagExecOne != "" && strings.HasPrefix(*flagExecOne, "https:") {
+		*flagExecOne = pageIDOf(*flagExecOne) // use the ID only
+
+		log.Printf("Parsed ID: %v", *flagExecOne)
+	}
+
+	if *flagNotionRate <= 0 {
+		log.Printf("invalid --notion-rate: %v", *flagNotionRate)
+		os.Exit(ExitConfig)
+	}
+	notionLimiter.SetMax(*flagNotionRate)
+
+	if err := setupFixtures(*flagRecord, *flagReplay); err != nil {
+		log.Printf("fixtures: %v", err)
+		os.Exit(ExitConfig)
+	}
+
+	if err := setupState(*flagStatePath, *flagDryRun); err != nil {
+		log.Printf("state: %v", err)
+		os.Exit(ExitConfig)
+	}
+
+	if err := setupCache(*flagCacheDir); err != nil {
+		log.Printf("cache: %v", err)
+		os.Exit(ExitConfig)
 	}
 
-	notionClient := newNotionClient()
+	ctx := interruptContext()
 
+	if spec, found := LookupCmd(*flagCmd); found && spec.Standalone {
+		report := runCmd(ctx, nil, *flagCmd, "", Config{})
+		exit([]*RunReport{report})
+	}
+
+	var dryRun *DryRunTransport
+	transport := newNotionTransport()
+	if *flagDryRun {
+		dryRun = NewDryRunTransport(transport, *flagCmd)
+		transport = dryRun
+	}
+
+	notionClient := newNotionClient(transport)
+
+	reports := []*RunReport{}
 	if *flagMulti {
 		configs := loadMultiConfig(*flagConfigPath)
 		if *flagDebugMode {
 			log.Printf("MultiConfig len: %v", len(configs))
 		}
 
-		repeat(func() {
-			if *flagMultiIdx >= 0 {
-				runCmd(notionClient, configs[*flagMultiIdx])
-			} else {
-				for _, cfg := range configs {
-					runCmd(notionClient, cfg)
-				}
+		jobs, err := selectJobs(configs, *flagMultiIdx, *flagJob, *flagTags)
+		if err != nil {
+			log.Printf("select jobs: %v", err)
+			os.Exit(ExitConfig)
+		}
+
+		repeat(ctx, func() bool {
+			results := runJobs(ctx, notionClient, jobs)
+			log.Print(summarizeJobs(results))
+
+			for _, r := range results {
+				reports = append(reports, r.Report)
 			}
+			return true // continue other jobs and repeats
 		}, *flagRepeat)
 	} else {
 		config := loadConfig(*flagConfigPath)
 
-		repeat(func() {
-			runCmd(notionClient, config)
+		repeat(ctx, func() bool {
+			report := runCmd(ctx, notionClient, *flagCmd, "", config)
+			reports = append(reports, report)
+			return !report.HasError()
 		}, *flagRepeat)
 	}
+
+	if dryRun != nil {
+		if err := dryRun.Save(*flagPlanPath); err != nil {
+			log.Fatalf("dry-run: %v", err)
+		}
+	}
+
+	exit(reports)
 }
 
-func repeat(do func(), times int) {
-	for i := 0; i < times; i++ {
-		do()
+// repeat the func until it returns false or ctx is done
+func repeat(ctx context.Context, do func() bool, times int) {
+	for i := 0; i < times && ctx.Err() == nil; i++ {
+		if !do() {
+			return
+		}
 	}
 }
 
-func runCmd(notionClient *notion.Client, cfg Config) {
+// interruptContext is cancelled on SIGINT or SIGTERM, cmds stop taking new work and
+// finish what is in-flight. A second signal exits immediately.
+func interruptContext() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-ctx.Done()
+		stop() // restore the default behavior for the second signal
+		log.Printf("Interrupted, finishing in-flight work, interrupt again to exit now")
+	}()
+
+	return ctx
+}
+
+// exit writes the reports to --report-json, and exits with the code of the reports
+func exit(reports []*RunReport) {
+	if *flagReportPath != "" {
+		if err := writeReports(*flagReportPath, reports); err != nil {
+			log.Printf("Failed to write report: %v", err)
+		}
+	}
+
+	os.Exit(exitCode(reports))
+}
+
+// runCmd creates, validates and runs the cmd, a panic in the cmd is reported as error
+func runCmd(ctx context.Context, notionClient NotionAPI, name, job string, cfg Config) (report *RunReport) {
 	if *flagDebugMode {
-		log.Printf("Run cmd: %v, config: %+v", *flagCmd, cfg)
+		log.Printf("Run cmd: %v, config: %+v", name, cfg)
 	} else {
-		log.Printf("Run cmd: %v", *flagCmd)
+		log.Printf("Run cmd: %v", name)
 	}
 
-	var cmd Cmd
-	switch *flagCmd {
-	case "daily-journal": // create daily journal entries with title YYYY-MM-DD
-		cmd = &DailyJournal{
-			DebugMode:          *flagDebugMode,
-			Client:             notionClient,
-			DailyJournalConfig: cfg.DailyJournal,
-		}
-	case "weekly-journal": // create weekly journal entries with title like YYYY-MM-DD/YYYY-MM-DD
-		cmd = &WeeklyJournal{
-			DebugMode:           *flagDebugMode,
-			Client:              notionClient,
-			WeeklyJournalConfig: cfg.WeeklyJournal,
-		}
-	case "flashback": // get a random page from a database and resurface it
-		cmd = &Flashback{
-			DebugMode:       *flagDebugMode,
-			Client:          notionClient,
-			FlashbackConfig: cfg.Flashback,
-		}
-	case "duplicate": // find duplicated pages (same title) in a database
-		cmd = &DuplicateChecker{
-			DebugMode:              *flagDebugMode,
-			Client:                 notionClient,
-			DuplicateCheckerConfig: cfg.DuplicateChecker,
-		}
-	case "collector": // find certain pages from a database and dump the delta pages in a page
-		cmd = &Collector{
-			DebugMode:       *flagDebugMode,
-			Client:          notionClient,
-			CollectorConfig: cfg.Collector,
+	report = NewRunReport(name, job)
+
+	var err error
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
 		}
-	case "export": // export pages from a database into local folders in markdown
-		cmd = &Exporter{
-			DebugMode:      *flagDebugMode,
-			ExecOne:        *flagExecOne,
-			Client:         notionClient,
-			ExporterConfig: cfg.Exporter,
+		if stateStore != nil {
+			if flushErr := stateStore.Flush(); flushErr != nil {
+				log.Printf("Failed to save state, err: %v", flushErr)
+			}
 		}
-	case "llm": // run custom prompt on pages from a database
-		cmd = &LangModel{
-			DebugMode:       *flagDebugMode,
-			ExecOne:         *flagExecOne,
-			Client:          notionClient,
-			LangModelConfig: cfg.LLM,
+
+		report.Finish(err)
+		if err != nil {
+			log.Printf("cmd %v failed, %v", name, report)
+		} else {
+			log.Printf("cmd %v completed, %v", name, report)
 		}
-	default:
-		log.Fatalf("Unknown cmd: `%v`", *flagCmd)
-	}
+	}()
 
-	if err := cmd.Validate(); err != nil {
-		log.Fatalf("cmd %v validate failed: %+v", *flagCmd, err)
+	cmd, err := NewCmd(name, CmdEnv{
+		DebugMode:  *flagDebugMode,
+		ExecOne:    *flagExecOne,
+		ConfigPath: *flagConfigPath,
+		MultiMode:  *flagMulti,
+		PlanPath:   *flagPlanPath,
+		Client:     notionClient,
+		Report:     report,
+		State:      stateStore,
+		Cache:      pageCache,
+		Job:        job,
+		Args:       flag.Args(),
+	}, cfg)
+	if err != nil {
+		err = fmt.Errorf("%w: create: %w", ErrCmdInvalid, err)
+		return
 	}
 
-	if err := cmd.Run(); err != nil {
-		log.Fatalf("cmd %v error: %+v", *flagCmd, err)
+	if err = cmd.Validate(); err != nil {
+		err = fmt.Errorf("%w: validate: %w", ErrCmdInvalid, err)
+		return
 	}
 
-	log.Printf("cmd %v completed", *flagCmd)
+	ctx, cancel := cmdContext(ctx, cfg)
+	defer cancel()
+
+	err = cmd.Run(ctx)
+	return
+}
+
+func notionToken() string {
+	return os.Getenv("NOTION_TOKEN")
 }
 
-func newNotionClient() *notion.Client {
-	notionToken := os.Getenv("NOTION_TOKEN")
-	if notionToken == "" {
+// newNotionTransport is the http transport shared by all requests to Notion,
+// requests are limited by the process-wide notionLimiter
+func newNotionTransport() http.RoundTripper {
+	if isReplaying() { // offline, nothing to limit
+		return newHTTPTransport()
+	}
+	return &RateLimitTransport{Base: newHTTPTransport(), Limiter: notionLimiter}
+}
+
+func newNotionClient(transport http.RoundTripper) *NotionClient {
+	token := notionToken()
+	if token == "" && isReplaying() {
+		token = redacted
+	}
+	if token == "" {
 		log.Println("Empty Token in env.NOTION_TOKEN")
 		os.Exit(1)
 	}
 
-	return notion.NewClient(notionToken)
+	return NewNotionClient(token, &http.Client{Transport: transport})
 }
 
 func loadConfig(configPath string) Config {
@@ -171,35 +295,56 @@ func loadConfig(configPath string) Config {
 		return Config{} // allow empty config for execOne
 	}
 
-	configFile, err := os.ReadFile(configPath)
+	config, err := readConfig(configPath)
 	if err != nil {
 		log.Printf("Error in Config File (%v): %v", configPath, err)
-		os.Exit(2)
+		os.Exit(ExitConfig)
 	}
 
-	config := Config{}
-	err = yaml.Unmarshal(configFile, &config)
+	return config
+}
+
+func readConfig(configPath string) (Config, error) {
+	tree, err := readConfigTree(configPath, map[string]bool{})
 	if err != nil {
-		log.Printf("Error in unmarshal Config: %v", err)
-		os.Exit(2)
+		return Config{}, err
 	}
 
-	return config
+	config := Config{}
+	if err := decodeConfigTree(tree, &config, false); err != nil {
+		return Config{}, fmt.Errorf("unmarshal Config: %w", err)
+	}
+
+	return config, nil
 }
 
 func loadMultiConfig(configPath string) []Config {
-	configFile, err := os.ReadFile(configPath)
+	configs, err := readMultiConfig(configPath)
 	if err != nil {
 		log.Printf("Error in Config File (%v): %v", configPath, err)
-		os.Exit(2)
+		os.Exit(ExitConfig)
+	}
+
+	return configs
+}
+
+func readMultiConfig(configPath string) ([]Config, error) {
+	tree, err := readConfigTree(configPath, map[string]bool{})
+	if err != nil {
+		return nil, err
 	}
 
-	configs := []Config{}
-	err = yaml.Unmarshal(configFile, &configs)
+	entries, err := splitMultiConfigTree(tree)
 	if err != nil {
-		log.Printf("Error in unmarshal Config: %v", err)
-		os.Exit(2)
+		return nil, err
 	}
 
-	return configs
+	configs := make([]Config, len(entries))
+	for i, entry := range entries {
+		if err := decodeConfigTree(entry, &configs[i], false); err != nil {
+			return nil, fmt.Errorf("unmarshal Config [%d]: %w", i, err)
+		}
+	}
+
+	return configs, nil
 }
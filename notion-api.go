@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/dstotijn/go-notion"
+)
+
+// NotionAPI is the part of the Notion API used by the commands. It is implemented
+// by *NotionClient, and by notiontest.Fake in tests.
+type NotionAPI interface {
+	FindDatabaseByID(ctx context.Context, id string) (notion.Database, error)
+	QueryDatabase(ctx context.Context, id string, query *notion.DatabaseQuery) (notion.DatabaseQueryResponse, error)
+	FindPageByID(ctx context.Context, id string) (notion.Page, error)
+	CreatePage(ctx context.Context, params notion.CreatePageParams) (notion.Page, error)
+	UpdatePage(ctx context.Context, pageID string, params notion.UpdatePageParams) (notion.Page, error)
+	FindBlockChildrenByID(ctx context.Context, blockID string, query *notion.PaginationQuery) (notion.BlockChildrenResponse, error)
+	AppendBlockChildren(ctx context.Context, blockID string, children []notion.Block) (notion.BlockChildrenResponse, error)
+	AppendBlockChildrenAfter(ctx context.Context, blockID, after string, children []notion.Block) (notion.BlockChildrenResponse, error)
+	UpdateBlock(ctx context.Context, blockID string, block notion.Block) (notion.Block, error)
+	DeleteBlock(ctx context.Context, blockID string) (notion.Block, error)
+	Search(ctx context.Context, opts *notion.SearchOpts) (notion.SearchResponse, error)
+}
+
+var _ NotionAPI = (*NotionClient)(nil)
+
+// NotionClient is the go-notion client, with the API go-notion does not have yet
+type NotionClient struct {
+	*notion.Client
+
+	token      string
+	httpClient *http.Client
+}
+
+func NewNotionClient(token string, httpClient *http.Client) *NotionClient {
+	return &NotionClient{
+		Client:     notion.NewClient(token, notion.WithHTTPClient(httpClient)),
+		token:      token,
+		httpClient: httpClient,
+	}
+}
+
+// AppendBlockChildrenAfter appends the children after the block `after`, a child of
+// the block, or at the end of the block when after is empty
+// https://developers.notion.com/reference/patch-block-children
+func (c *NotionClient) AppendBlockChildrenAfter(ctx context.Context, blockID, after string, children []notion.Block) (notion.BlockChildrenResponse, error) {
+	if after == "" {
+		return c.Client.AppendBlockChildren(ctx, blockID, children)
+	}
+
+	body, err := json.Marshal(struct {
+		Children []notion.Block `json:"children"`
+		After    string         `json:"after"`
+	}{children, after})
+	if err != nil {
+		return notion.BlockChildrenResponse{}, fmt.Errorf("notion: failed to encode body params to JSON: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, notionAPIURL+"/v1/blocks/"+blockID+"/children", bytes.NewReader(body))
+	if err != nil {
+		return notion.BlockChildrenResponse{}, fmt.Errorf("notion: invalid request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Notion-Version", notionAPIVersion)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return notion.BlockChildrenResponse{}, fmt.Errorf("notion: failed to make HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &notion.APIError{}
+		if err := json.NewDecoder(resp.Body).Decode(apiErr); err != nil || apiErr.Status == 0 {
+			apiErr.Status, apiErr.Message = resp.StatusCode, resp.Status
+		}
+		return notion.BlockChildrenResponse{}, fmt.Errorf("notion: failed to append block children: %w", apiErr)
+	}
+
+	result := notion.BlockChildrenResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return notion.BlockChildrenResponse{}, fmt.Errorf("notion: failed to parse HTTP response: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/zhuochun/notion-toolset/notiontest"
+)
+
+var _ NotionAPI = (*notiontest.Fake)(nil)
+
+// runTestCmd creates, validates and runs the cmd with the client, it fails the test on errors
+func runTestCmd(t *testing.T, name string, client NotionAPI, cfg Config) (Cmd, *RunReport) {
+	t.Helper()
+	return runTestCmdEnv(t, name, CmdEnv{Client: client}, cfg)
+}
+
+// runTestCmdEnv is runTestCmd with the env, e.g. a state store
+func runTestCmdEnv(t *testing.T, name string, env CmdEnv, cfg Config) (Cmd, *RunReport) {
+	t.Helper()
+
+	report := NewRunReport(name, "")
+	env.Report = report
+	cmd, err := NewCmd(name, env, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cmd.Validate(); err != nil {
+		t.Fatalf("validate %v: %v", name, err)
+	}
+	if err := cmd.Run(t.Context()); err != nil {
+		t.Fatalf("run %v: %v", name, err)
+	}
+
+	report.Finish(nil)
+	return cmd, report
+}
+
+// readTestConfig reads a config in example/configs
+func readTestConfig(t *testing.T, name string) Config {
+	t.Helper()
+
+	cfg, err := readConfig("example/configs/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestNotionClientAppendAfter(t *testing.T) {
+	var body map[string]json.RawMessage
+	client := NewNotionClient("token", &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method != http.MethodPatch || req.URL.Path != "/v1/blocks/page1/children" || req.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("unexpected request: %v %v", req.Method, req.URL)
+		}
+		data, _ := io.ReadAll(req.Body)
+		json.Unmarshal(data, &body)
+
+		if strings.Contains(string(data), "missing") {
+			resp := jsonResponse(req, `{"object":"error","status":400,"code":"validation_error","message":"no block"}`)
+			resp.StatusCode = http.StatusBadRequest
+			return resp, nil
+		}
+		return jsonResponse(req, `{"object":"list","results":[{"object":"block","id":"b2","type":"divider","divider":{}}],"has_more":false}`), nil
+	})})
+
+	resp, err := client.AppendBlockChildrenAfter(t.Context(), "page1", "b1", []notion.Block{&notion.DividerBlock{}})
+	if err != nil || len(resp.Results) != 1 || resp.Results[0].ID() != "b2" {
+		t.Fatalf("expect appended block, got %+v, err: %v", resp, err)
+	}
+	if string(body["after"]) != `"b1"` || len(body["children"]) == 0 {
+		t.Errorf("unexpected body: %s", body)
+	}
+
+	_, err = client.AppendBlockChildrenAfter(t.Context(), "page1", "missing", []notion.Block{&notion.DividerBlock{}})
+	var apiErr *notion.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "validation_error" {
+		t.Errorf("expect an API error, got %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zhuochun/notion-toolset/retry"
+	"golang.org/x/time/rate"
+)
+
+const (
+	minNotionRate      = 0.5              // never slow down below, requests per second
+	notionRateRecovery = 10 * time.Second // time without 429 to speed up a step
+)
+
+// notionLimiter is shared by all requests to Notion in the process,
+// commands running together in --multi, pipeline or daemon are limited together
+var notionLimiter = NewAdaptiveLimiter(2.8)
+
+// AdaptiveLimiter limits requests per second. It halves the rate on a rate limited
+// response and pauses for its Retry-After, then recovers the rate step by step.
+type AdaptiveLimiter struct {
+	limiter *rate.Limiter
+	max     rate.Limit
+
+	mu           sync.Mutex
+	pausedUntil  time.Time
+	lastSlowDown time.Time
+	lastChange   time.Time // last slow down or recovery
+	now          func() time.Time
+}
+
+func NewAdaptiveLimiter(perSecond float64) *AdaptiveLimiter {
+	return &AdaptiveLimiter{
+		limiter: rate.NewLimiter(rate.Limit(perSecond), max(1, int(perSecond))),
+		max:     rate.Limit(perSecond),
+		now:     time.Now,
+	}
+}
+
+// SetMax changes the max rate and resets the current rate to it
+func (l *AdaptiveLimiter) SetMax(perSecond float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.max = rate.Limit(perSecond)
+	l.limiter.SetLimit(l.max)
+	l.limiter.SetBurst(max(1, int(perSecond)))
+}
+
+// Limit is the current rate in requests per second
+func (l *AdaptiveLimiter) Limit() float64 {
+	return float64(l.limiter.Limit())
+}
+
+// Wait blocks until a request is allowed or ctx is done
+func (l *AdaptiveLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	l.recover()
+	pause := l.pausedUntil.Sub(l.now())
+	l.mu.Unlock()
+
+	if pause > 0 {
+		timer := time.NewTimer(pause)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	return l.limiter.Wait(ctx)
+}
+
+// SlowDown halves the rate and pauses all requests for retryAfter. Responses of requests
+// sent together arrive together, they slow down once.
+func (l *AdaptiveLimiter) SlowDown(retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if until := now.Add(retryAfter); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+
+	if now.Sub(l.lastSlowDown) < time.Second {
+		return
+	}
+	l.lastSlowDown = now
+	l.lastChange = now
+
+	limit := max(l.limiter.Limit()/2, minNotionRate)
+	l.limiter.SetLimitAt(now, limit)
+	log.Printf("Notion rate limited, slow down to %.2f requests/s, retry after %v", float64(limit), retryAfter)
+}
+
+// recover speeds up a tenth of the max rate per notionRateRecovery without slow down,
+// the lock must be held
+func (l *AdaptiveLimiter) recover() {
+	limit := l.limiter.Limit()
+	if limit >= l.max {
+		return
+	}
+
+	now := l.now()
+	steps := int(now.Sub(l.lastChange) / notionRateRecovery)
+	if steps < 1 {
+		return
+	}
+
+	limit = min(limit+rate.Limit(steps)*l.max/10, l.max)
+	l.limiter.SetLimitAt(now, limit)
+	l.lastChange = now
+}
+
+// RateLimitTransport waits for the limiter before every request,
+// and slows the limiter down on 429 responses
+type RateLimitTransport struct {
+	Base    http.RoundTripper
+	Limiter *AdaptiveLimiter
+}
+
+func (t *RateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.Limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		t.Limiter.SlowDown(retry.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()))
+	}
+	return resp, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewAdaptiveLimiter(3)
+	l.now = func() time.Time { return now }
+
+	l.SlowDown(0)
+	if got := l.Limit(); got != 1.5 {
+		t.Errorf("expect halved to 1.5, got %v", got)
+	}
+
+	l.SlowDown(0) // 429s of requests sent together
+	if got := l.Limit(); got != 1.5 {
+		t.Errorf("expect slow down once within a second, got %v", got)
+	}
+
+	for i := 0; i < 5; i++ {
+		now = now.Add(2 * time.Second)
+		l.SlowDown(0)
+	}
+	if got := l.Limit(); got != minNotionRate {
+		t.Errorf("expect min rate %v, got %v", minNotionRate, got)
+	}
+
+	now = now.Add(2 * notionRateRecovery)
+	l.mu.Lock()
+	l.recover()
+	l.mu.Unlock()
+	if got := l.Limit(); got < 1.09 || got > 1.11 { // 0.5 + 2 steps of 0.3
+		t.Errorf("expect recovered to 1.1, got %v", got)
+	}
+
+	now = now.Add(time.Hour)
+	l.mu.Lock()
+	l.recover()
+	l.mu.Unlock()
+	if got := l.Limit(); got != 3 {
+		t.Errorf("expect recovered to max, got %v", got)
+	}
+}
+
+func TestAdaptiveLimiterPause(t *testing.T) {
+	l := NewAdaptiveLimiter(100)
+	l.SlowDown(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := l.Wait(ctx); err == nil {
+		t.Errorf("expect requests paused for Retry-After")
+	}
+}
+
+func TestRateLimitTransport(t *testing.T) {
+	requests := 0
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests += 1
+		resp := jsonResponse(req, `{"object":"error","status":429,"code":"rate_limited"}`)
+		resp.StatusCode = http.StatusTooManyRequests
+		resp.Header.Set("Retry-After", "0")
+		return resp, nil
+	})
+
+	l := NewAdaptiveLimiter(2)
+	client := &http.Client{Transport: &RateLimitTransport{Base: base, Limiter: l}}
+
+	resp, err := client.Get("https://api.notion.com/v1/users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if requests != 1 || l.Limit() != 1 {
+		t.Errorf("expect 1 request and rate slowed to 1, got %d requests, rate %v", requests, l.Limit())
+	}
+}
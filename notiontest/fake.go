@@ -0,0 +1,1042 @@
+// Package notiontest provides an in-memory fake of the Notion API for offline tests.
+//
+// The Fake has the same methods as *notion.Client that the commands use, with
+// databases, pages, block trees, pagination and evaluation of common filters
+// and sorts. Objects are returned as copies decoded from JSON, the same way the
+// real client decodes API responses.
+package notiontest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+)
+
+// DefaultPageSize is the max page size of the Notion API
+const DefaultPageSize = 100
+
+type Fake struct {
+	// PageSize caps the results per page, lower it to test pagination
+	PageSize int
+	// Now is the clock for created and edited times, default time.Now
+	Now func() time.Time
+	// Fail is called before every method, a non-nil error is returned by the method,
+	// e.g. to simulate rate limits or conflicts on some IDs
+	Fail func(method, id string) error
+
+	mu        sync.Mutex
+	seq       int
+	databases map[string]*notion.Database
+	pages     map[string]*notion.Page
+	pageOrder []string // page keys in created order
+	blocks    map[string]*fakeBlock
+	children  map[string][]string // page or block key -> child block keys
+	calls     []string
+}
+
+type fakeBlock struct {
+	id       string
+	parent   notion.Parent
+	typ      string
+	body     map[string]interface{}
+	archived bool
+	created  time.Time
+	edited   time.Time
+}
+
+func New() *Fake {
+	return &Fake{
+		PageSize:  DefaultPageSize,
+		Now:       time.Now,
+		databases: map[string]*notion.Database{},
+		pages:     map[string]*notion.Page{},
+		blocks:    map[string]*fakeBlock{},
+		children:  map[string][]string{},
+	}
+}
+
+// key normalizes IDs, Notion accepts IDs with or without dashes
+func key(id string) string {
+	return strings.ReplaceAll(id, "-", "")
+}
+
+func (f *Fake) newID() string {
+	f.seq += 1
+	return fmt.Sprintf("00000000-0000-4000-8000-%012d", f.seq)
+}
+
+// call records the call and runs the Fail hook, the lock must be held
+func (f *Fake) call(method, id string) error {
+	f.calls = append(f.calls, method+" "+id)
+
+	if f.Fail != nil {
+		return f.Fail(method, id)
+	}
+	return nil
+}
+
+// Calls returns the methods called so far, each as "Method ID"
+func (f *Fake) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string{}, f.calls...)
+}
+
+func notFound(kind, id string) error {
+	return &notion.APIError{
+		Object:  "error",
+		Status:  http.StatusNotFound,
+		Code:    "object_not_found",
+		Message: fmt.Sprintf("Could not find %v with ID: %v.", kind, id),
+	}
+}
+
+func validationError(format string, args ...interface{}) error {
+	return &notion.APIError{
+		Object:  "error",
+		Status:  http.StatusBadRequest,
+		Code:    "validation_error",
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// AddDatabase adds a database with the property schema, a title property "Name"
+// is added if the schema has none
+func (f *Fake) AddDatabase(title string, props notion.DatabaseProperties) notion.Database {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.Now()
+	db := &notion.Database{
+		ID:             f.newID(),
+		CreatedTime:    now,
+		LastEditedTime: now,
+		Title:          RichText(title),
+		Properties:     notion.DatabaseProperties{},
+		Parent:         notion.Parent{Type: notion.ParentTypeWorkspace, Workspace: true},
+	}
+	db.URL = "https://www.notion.so/" + key(db.ID)
+
+	hasTitle := false
+	for name, prop := range props {
+		prop.Name = name
+		if prop.ID == "" {
+			prop.ID = propID(name, prop.Type)
+		}
+		hasTitle = hasTitle || prop.Type == notion.DBPropTypeTitle
+		db.Properties[name] = prop
+	}
+	if !hasTitle {
+		db.Properties["Name"] = notion.DatabaseProperty{ID: "title", Name: "Name", Type: notion.DBPropTypeTitle}
+	}
+
+	f.databases[key(db.ID)] = db
+	return copyDatabase(*db)
+}
+
+// AddPage adds a page with its content blocks, the ID and times are set if empty.
+// It panics on invalid blocks, it is meant for test setup.
+func (f *Fake) AddPage(page notion.Page, blocks ...notion.Block) notion.Page {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if page.ID == "" {
+		page.ID = f.newID()
+	}
+	if page.CreatedTime.IsZero() {
+		page.CreatedTime = f.Now()
+	}
+	if page.LastEditedTime.IsZero() {
+		page.LastEditedTime = page.CreatedTime
+	}
+
+	if err := f.storePage(&page); err != nil {
+		panic(err)
+	}
+	for _, block := range blocks {
+		if _, err := f.storeBlock(page.ID, block); err != nil {
+			panic(err)
+		}
+	}
+
+	return copyPage(page)
+}
+
+// DatabasePage is a page in the database with the title in property "Name"
+func DatabasePage(databaseID, title string) notion.Page {
+	return notion.Page{
+		Parent: notion.Parent{Type: notion.ParentTypeDatabase, DatabaseID: databaseID},
+		Properties: notion.DatabasePageProperties{
+			"Name": notion.DatabasePageProperty{Type: notion.DBPropTypeTitle, Title: RichText(title)},
+		},
+	}
+}
+
+// RichText is a plain text rich text
+func RichText(s string) []notion.RichText {
+	return []notion.RichText{{
+		Type:        notion.RichTextTypeText,
+		Text:        &notion.Text{Content: s},
+		Annotations: &notion.Annotations{Color: notion.ColorDefault},
+		PlainText:   s,
+	}}
+}
+
+// Paragraph is a paragraph block with plain text
+func Paragraph(s string) *notion.ParagraphBlock {
+	return &notion.ParagraphBlock{RichText: RichText(s)}
+}
+
+// Pages returns the pages in the database in created order, archived pages excluded
+func (f *Fake) Pages(databaseID string) []notion.Page {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pages := []notion.Page{}
+	for _, page := range f.databasePages(databaseID) {
+		pages = append(pages, copyPage(*page))
+	}
+	return pages
+}
+
+// Page returns the page by ID
+func (f *Fake) Page(id string) (notion.Page, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	page, found := f.pages[key(id)]
+	if !found {
+		return notion.Page{}, false
+	}
+	return copyPage(*page), true
+}
+
+// Children returns the child blocks of a page or block, archived blocks excluded
+func (f *Fake) Children(id string) []notion.Block {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	blocks, err := f.decodeBlocks(f.children[key(id)])
+	if err != nil {
+		panic(err)
+	}
+	return blocks
+}
+
+func (f *Fake) FindDatabaseByID(ctx context.Context, id string) (notion.Database, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("FindDatabaseByID", id); err != nil {
+		return notion.Database{}, err
+	}
+
+	db, found := f.databases[key(id)]
+	if !found {
+		return notion.Database{}, fmt.Errorf("notion: failed to find database: %w", notFound("database", id))
+	}
+	return copyDatabase(*db), nil
+}
+
+func (f *Fake) QueryDatabase(ctx context.Context, id string, query *notion.DatabaseQuery) (notion.DatabaseQueryResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("QueryDatabase", id); err != nil {
+		return notion.DatabaseQueryResponse{}, err
+	}
+
+	if _, found := f.databases[key(id)]; !found {
+		return notion.DatabaseQueryResponse{}, fmt.Errorf("notion: failed to query database: %w", notFound("database", id))
+	}
+	if query == nil {
+		query = &notion.DatabaseQuery{}
+	}
+
+	matched := []*notion.Page{}
+	for _, page := range f.databasePages(id) {
+		ok, err := matchFilter(query.Filter, *page, f.Now())
+		if err != nil {
+			return notion.DatabaseQueryResponse{}, fmt.Errorf("notion: failed to query database: %w", err)
+		}
+		if ok {
+			matched = append(matched, page)
+		}
+	}
+
+	if err := sortPages(matched, query.Sorts); err != nil {
+		return notion.DatabaseQueryResponse{}, fmt.Errorf("notion: failed to query database: %w", err)
+	}
+
+	ids := make([]string, len(matched))
+	for i, page := range matched {
+		ids[i] = page.ID
+	}
+	start, end, next, err := f.paginate(ids, query.StartCursor, query.PageSize)
+	if err != nil {
+		return notion.DatabaseQueryResponse{}, fmt.Errorf("notion: failed to query database: %w", err)
+	}
+
+	resp := notion.DatabaseQueryResponse{Results: []notion.Page{}, HasMore: next != nil, NextCursor: next}
+	for _, page := range matched[start:end] {
+		resp.Results = append(resp.Results, copyPage(*page))
+	}
+	return resp, nil
+}
+
+func (f *Fake) FindPageByID(ctx context.Context, id string) (notion.Page, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("FindPageByID", id); err != nil {
+		return notion.Page{}, err
+	}
+
+	page, found := f.pages[key(id)]
+	if !found {
+		return notion.Page{}, fmt.Errorf("notion: failed to find page: %w", notFound("page", id))
+	}
+	return copyPage(*page), nil
+}
+
+func (f *Fake) CreatePage(ctx context.Context, params notion.CreatePageParams) (notion.Page, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("CreatePage", params.ParentID); err != nil {
+		return notion.Page{}, err
+	}
+
+	now := f.Now()
+	page := notion.Page{
+		ID:             f.newID(),
+		CreatedTime:    now,
+		LastEditedTime: now,
+		Icon:           params.Icon,
+		Cover:          params.Cover,
+	}
+
+	switch params.ParentType {
+	case notion.ParentTypeDatabase:
+		if params.DatabasePageProperties == nil {
+			return notion.Page{}, fmt.Errorf("notion: failed to create page: %w", validationError("properties should be defined"))
+		}
+		page.Parent = notion.Parent{Type: notion.ParentTypeDatabase, DatabaseID: params.ParentID}
+		page.Properties = *params.DatabasePageProperties
+	case notion.ParentTypePage:
+		if _, found := f.pages[key(params.ParentID)]; !found {
+			return notion.Page{}, fmt.Errorf("notion: failed to create page: %w", notFound("page", params.ParentID))
+		}
+		page.Parent = notion.Parent{Type: notion.ParentTypePage, PageID: params.ParentID}
+		page.Properties = notion.PageProperties{Title: notion.PageTitle{Title: params.Title}}
+	default:
+		return notion.Page{}, fmt.Errorf("notion: failed to create page: %w", validationError("invalid parent type: %v", params.ParentType))
+	}
+
+	if err := f.storePage(&page); err != nil {
+		return notion.Page{}, fmt.Errorf("notion: failed to create page: %w", err)
+	}
+
+	for _, block := range params.Children {
+		if _, err := f.storeBlock(page.ID, block); err != nil {
+			return notion.Page{}, fmt.Errorf("notion: failed to create page: %w", err)
+		}
+	}
+
+	if page.Parent.Type == notion.ParentTypePage { // a sub-page is also a block in its parent
+		title := page.Properties.(notion.PageProperties).Title.Title
+		f.addBlock(page.ID, page.Parent.PageID, "child_page", map[string]interface{}{"title": plainText(title)})
+	}
+
+	return copyPage(page), nil
+}
+
+func (f *Fake) UpdatePage(ctx context.Context, pageID string, params notion.UpdatePageParams) (notion.Page, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("UpdatePage", pageID); err != nil {
+		return notion.Page{}, err
+	}
+
+	page, found := f.pages[key(pageID)]
+	if !found {
+		return notion.Page{}, fmt.Errorf("notion: failed to update page: %w", notFound("page", pageID))
+	}
+
+	page.LastEditedTime = f.Now()
+
+	if len(params.DatabasePageProperties) > 0 {
+		props, ok := page.Properties.(notion.DatabasePageProperties)
+		if !ok {
+			return notion.Page{}, fmt.Errorf("notion: failed to update page: %w", validationError("page is not in a database"))
+		}
+
+		merged := notion.DatabasePageProperties{}
+		for name, prop := range props {
+			merged[name] = prop
+		}
+		for name, prop := range params.DatabasePageProperties {
+			merged[name] = prop
+		}
+		page.Properties = merged
+	}
+
+	if page.Parent.Type == notion.ParentTypeDatabase {
+		if err := f.normalizeProperties(page); err != nil {
+			return notion.Page{}, fmt.Errorf("notion: failed to update page: %w", err)
+		}
+	}
+
+	if params.Archived != nil {
+		page.Archived = *params.Archived
+	}
+	if params.Icon != nil {
+		page.Icon = params.Icon
+	}
+	if params.Cover != nil {
+		page.Cover = params.Cover
+	}
+
+	return copyPage(*page), nil
+}
+
+func (f *Fake) FindBlockChildrenByID(ctx context.Context, blockID string, query *notion.PaginationQuery) (notion.BlockChildrenResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("FindBlockChildrenByID", blockID); err != nil {
+		return notion.BlockChildrenResponse{}, err
+	}
+
+	if !f.isParent(blockID) {
+		return notion.BlockChildrenResponse{}, fmt.Errorf("notion: failed to find block children: %w", notFound("block", blockID))
+	}
+	if query == nil {
+		query = &notion.PaginationQuery{}
+	}
+
+	ids := f.children[key(blockID)]
+	start, end, next, err := f.paginate(ids, query.StartCursor, query.PageSize)
+	if err != nil {
+		return notion.BlockChildrenResponse{}, fmt.Errorf("notion: failed to find block children: %w", err)
+	}
+
+	blocks, err := f.decodeBlocks(ids[start:end])
+	if err != nil {
+		return notion.BlockChildrenResponse{}, err
+	}
+	return notion.BlockChildrenResponse{Results: blocks, HasMore: next != nil, NextCursor: next}, nil
+}
+
+func (f *Fake) AppendBlockChildren(ctx context.Context, blockID string, children []notion.Block) (notion.BlockChildrenResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("AppendBlockChildren", blockID); err != nil {
+		return notion.BlockChildrenResponse{}, err
+	}
+	return f.appendBlockChildren(blockID, "", children)
+}
+
+// AppendBlockChildrenAfter appends the children after the block `after`, a child of
+// the block, or at the end when after is empty
+func (f *Fake) AppendBlockChildrenAfter(ctx context.Context, blockID, after string, children []notion.Block) (notion.BlockChildrenResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("AppendBlockChildrenAfter", blockID); err != nil {
+		return notion.BlockChildrenResponse{}, err
+	}
+	return f.appendBlockChildren(blockID, after, children)
+}
+
+func (f *Fake) appendBlockChildren(blockID, after string, children []notion.Block) (notion.BlockChildrenResponse, error) {
+	if !f.isParent(blockID) {
+		return notion.BlockChildrenResponse{}, fmt.Errorf("notion: failed to append block children: %w", notFound("block", blockID))
+	}
+	if len(children) > DefaultPageSize {
+		return notion.BlockChildrenResponse{}, fmt.Errorf("notion: failed to append block children: %w",
+			validationError("body.children.length should be ≤ `%d`, instead was `%d`", DefaultPageSize, len(children)))
+	}
+
+	parentKey := key(blockID)
+	siblings := f.children[parentKey]
+	at := len(siblings)
+	if after != "" {
+		at = -1
+		for i, id := range siblings {
+			if id == key(after) {
+				at = i + 1
+			}
+		}
+		if at < 0 {
+			return notion.BlockChildrenResponse{}, fmt.Errorf("notion: failed to append block children: %w",
+				validationError("Block %v is not a child of %v.", after, blockID))
+		}
+	}
+
+	ids := []string{}
+	for _, block := range children {
+		id, err := f.storeBlock(blockID, block)
+		if err != nil {
+			return notion.BlockChildrenResponse{}, fmt.Errorf("notion: failed to append block children: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	ordered := append([]string{}, siblings[:at]...)
+	ordered = append(ordered, ids...)
+	f.children[parentKey] = append(ordered, siblings[at:]...)
+
+	blocks, err := f.decodeBlocks(ids)
+	if err != nil {
+		return notion.BlockChildrenResponse{}, err
+	}
+	return notion.BlockChildrenResponse{Results: blocks}, nil
+}
+
+func (f *Fake) UpdateBlock(ctx context.Context, blockID string, block notion.Block) (notion.Block, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("UpdateBlock", blockID); err != nil {
+		return nil, err
+	}
+
+	b, found := f.blocks[key(blockID)]
+	if !found || b.archived {
+		return nil, fmt.Errorf("notion: failed to update block: %w", notFound("block", blockID))
+	}
+
+	typ, body, err := splitBlock(block)
+	if err != nil {
+		return nil, fmt.Errorf("notion: failed to update block: %w", err)
+	}
+	if typ != b.typ {
+		return nil, fmt.Errorf("notion: failed to update block: %w", validationError("block type %v cannot be updated to %v", b.typ, typ))
+	}
+
+	delete(body, "children")
+	for k, v := range body {
+		b.body[k] = v
+	}
+	b.edited = f.Now()
+
+	blocks, err := f.decodeBlocks([]string{key(b.id)})
+	if err != nil {
+		return nil, err
+	}
+	return blocks[0], nil
+}
+
+func (f *Fake) DeleteBlock(ctx context.Context, blockID string) (notion.Block, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("DeleteBlock", blockID); err != nil {
+		return nil, err
+	}
+
+	b, found := f.blocks[key(blockID)]
+	if !found || b.archived {
+		return nil, fmt.Errorf("notion: failed to delete block: %w", notFound("block", blockID))
+	}
+
+	b.archived = true
+	b.edited = f.Now()
+
+	parentKey := key(parentID(b.parent))
+	siblings := []string{}
+	for _, id := range f.children[parentKey] {
+		if id != key(b.id) {
+			siblings = append(siblings, id)
+		}
+	}
+	f.children[parentKey] = siblings
+
+	raw, err := json.Marshal(map[string]interface{}{"results": []interface{}{f.blockJSON(b)}})
+	if err != nil {
+		return nil, err
+	}
+	resp := notion.BlockChildrenResponse{}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Results[0], nil
+}
+
+// Search matches the query in titles of pages and databases, case insensitive
+func (f *Fake) Search(ctx context.Context, opts *notion.SearchOpts) (notion.SearchResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if opts == nil {
+		opts = &notion.SearchOpts{}
+	}
+	if err := f.call("Search", opts.Query); err != nil {
+		return notion.SearchResponse{}, err
+	}
+
+	type result struct {
+		id     string
+		edited time.Time
+		value  interface{}
+	}
+
+	query := strings.ToLower(opts.Query)
+	objectFilter := ""
+	if opts.Filter != nil {
+		objectFilter = opts.Filter.Value
+	}
+
+	results := []result{}
+	if objectFilter == "" || objectFilter == "page" {
+		for _, k := range f.pageOrder {
+			page := f.pages[k]
+			if !page.Archived && strings.Contains(strings.ToLower(pageTitle(*page)), query) {
+				results = append(results, result{page.ID, page.LastEditedTime, copyPage(*page)})
+			}
+		}
+	}
+	if objectFilter == "" || objectFilter == "database" {
+		for _, db := range f.databases {
+			if strings.Contains(strings.ToLower(plainText(db.Title)), query) {
+				results = append(results, result{db.ID, db.LastEditedTime, copyDatabase(*db)})
+			}
+		}
+	}
+
+	ascending := opts.Sort != nil && opts.Sort.Direction == notion.SortDirAsc
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].edited.Equal(results[j].edited) {
+			return results[i].id < results[j].id
+		}
+		if ascending {
+			return results[i].edited.Before(results[j].edited)
+		}
+		return results[i].edited.After(results[j].edited)
+	})
+
+	ids := make([]string, len(results))
+	for i, r := range results {
+		ids[i] = r.id
+	}
+	start, end, next, err := f.paginate(ids, opts.StartCursor, opts.PageSize)
+	if err != nil {
+		return notion.SearchResponse{}, fmt.Errorf("notion: failed to search: %w", err)
+	}
+
+	resp := notion.SearchResponse{Results: notion.SearchResults{}, HasMore: next != nil, NextCursor: next}
+	for _, r := range results[start:end] {
+		resp.Results = append(resp.Results, r.value)
+	}
+	return resp, nil
+}
+
+// paginate returns the range of ids in the page, the cursor is the ID of the first
+// result of the next page
+func (f *Fake) paginate(ids []string, cursor string, pageSize int) (int, int, *string, error) {
+	start := 0
+	if cursor != "" {
+		start = -1
+		for i, id := range ids {
+			if key(id) == key(cursor) {
+				start = i
+				break
+			}
+		}
+		if start < 0 {
+			return 0, 0, nil, validationError("start_cursor is invalid: %v", cursor)
+		}
+	}
+
+	size := f.PageSize
+	if size < 1 || size > DefaultPageSize {
+		size = DefaultPageSize
+	}
+	if pageSize > 0 && pageSize < size {
+		size = pageSize
+	}
+
+	end := start + size
+	if end >= len(ids) {
+		return start, len(ids), nil, nil
+	}
+
+	next := ids[end]
+	if b, found := f.blocks[next]; found { // block keys are stored without dashes
+		next = b.id
+	}
+	return start, end, &next, nil
+}
+
+func (f *Fake) databasePages(databaseID string) []*notion.Page {
+	pages := []*notion.Page{}
+	for _, k := range f.pageOrder {
+		page := f.pages[k]
+		if !page.Archived && page.Parent.Type == notion.ParentTypeDatabase && key(page.Parent.DatabaseID) == key(databaseID) {
+			pages = append(pages, page)
+		}
+	}
+	return pages
+}
+
+func (f *Fake) isParent(id string) bool {
+	if _, found := f.pages[key(id)]; found {
+		return true
+	}
+	b, found := f.blocks[key(id)]
+	return found && !b.archived
+}
+
+func (f *Fake) storePage(page *notion.Page) error {
+	if page.URL == "" {
+		page.URL = "https://www.notion.so/" + key(page.ID)
+	}
+
+	switch page.Parent.Type {
+	case notion.ParentTypeDatabase:
+		if _, found := f.databases[key(page.Parent.DatabaseID)]; !found {
+			return notFound("database", page.Parent.DatabaseID)
+		}
+		if page.Properties == nil {
+			page.Properties = notion.DatabasePageProperties{}
+		}
+		if err := f.normalizeProperties(page); err != nil {
+			return err
+		}
+	default:
+		props, _ := page.Properties.(notion.PageProperties)
+		fillPlainText(props.Title.Title)
+		page.Properties = props
+	}
+
+	k := key(page.ID)
+	if _, found := f.pages[k]; !found {
+		f.pageOrder = append(f.pageOrder, k)
+	}
+	f.pages[k] = page
+	return nil
+}
+
+// normalizeProperties sets the ID, type and plain text of the properties, as Notion
+// returns them, e.g. the title property has ID "title"
+func (f *Fake) normalizeProperties(page *notion.Page) error {
+	props, ok := page.Properties.(notion.DatabasePageProperties)
+	if !ok {
+		return validationError("database page has invalid properties: %T", page.Properties)
+	}
+
+	schema := f.databases[key(page.Parent.DatabaseID)].Properties
+
+	normalized := notion.DatabasePageProperties{}
+	for name, prop := range props {
+		def, found := schema[name]
+		if !found {
+			return validationError("%v is not a property that exists", name)
+		}
+
+		if prop.Type == "" {
+			prop.Type = inferType(prop)
+		}
+		if prop.Type == "" { // empty value, e.g. a cleared rich text
+			prop.Type = def.Type
+		}
+		if prop.Type != def.Type {
+			return validationError("%v is expected to be %v", name, def.Type)
+		}
+		prop.ID = def.ID
+
+		fillPlainText(prop.Title)
+		fillPlainText(prop.RichText)
+		normalized[name] = prop
+	}
+
+	// all properties in the schema are returned, with times set by Notion
+	for name, def := range schema {
+		prop, found := normalized[name]
+		if !found {
+			prop = notion.DatabasePageProperty{ID: def.ID, Type: def.Type}
+		}
+
+		switch def.Type {
+		case notion.DBPropTypeCreatedTime:
+			t := page.CreatedTime
+			prop.CreatedTime = &t
+		case notion.DBPropTypeLastEditedTime:
+			t := page.LastEditedTime
+			prop.LastEditedTime = &t
+		}
+		normalized[name] = prop
+	}
+
+	page.Properties = normalized
+	return nil
+}
+
+func propID(name string, typ notion.DatabasePropertyType) string {
+	if typ == notion.DBPropTypeTitle {
+		return "title"
+	}
+	return strings.ToLower(strings.ReplaceAll(name, " ", "_"))
+}
+
+func inferType(prop notion.DatabasePageProperty) notion.DatabasePropertyType {
+	switch {
+	case prop.Title != nil:
+		return notion.DBPropTypeTitle
+	case prop.RichText != nil:
+		return notion.DBPropTypeRichText
+	case prop.Number != nil:
+		return notion.DBPropTypeNumber
+	case prop.Select != nil:
+		return notion.DBPropTypeSelect
+	case prop.MultiSelect != nil:
+		return notion.DBPropTypeMultiSelect
+	case prop.Date != nil:
+		return notion.DBPropTypeDate
+	case prop.Checkbox != nil:
+		return notion.DBPropTypeCheckbox
+	case prop.URL != nil:
+		return notion.DBPropTypeURL
+	case prop.Email != nil:
+		return notion.DBPropTypeEmail
+	case prop.PhoneNumber != nil:
+		return notion.DBPropTypePhoneNumber
+	case prop.Status != nil:
+		return notion.DBPropTypeStatus
+	case prop.Relation != nil:
+		return notion.DBPropTypeRelation
+	case prop.People != nil:
+		return notion.DBPropTypePeople
+	case prop.Files != nil:
+		return notion.DBPropTypeFiles
+	case prop.CreatedTime != nil:
+		return notion.DBPropTypeCreatedTime
+	case prop.LastEditedTime != nil:
+		return notion.DBPropTypeLastEditedTime
+	}
+	return ""
+}
+
+// storeBlock stores the block and its nested children under the parent, and returns its key
+func (f *Fake) storeBlock(parent string, block notion.Block) (string, error) {
+	typ, body, err := splitBlock(block)
+	if err != nil {
+		return "", err
+	}
+	return f.storeRawBlock(parent, typ, body)
+}
+
+func (f *Fake) storeRawBlock(parent, typ string, body map[string]interface{}) (string, error) {
+	children, _ := body["children"].([]interface{})
+	delete(body, "children")
+	fillRawPlainText(body)
+
+	id := f.newID()
+	f.addBlock(id, parent, typ, body)
+
+	for _, child := range children {
+		raw, ok := child.(map[string]interface{})
+		if !ok || len(raw) != 1 {
+			return "", validationError("invalid child block: %v", child)
+		}
+		for childType, childBody := range raw {
+			m, ok := childBody.(map[string]interface{})
+			if !ok {
+				return "", validationError("invalid child block: %v", child)
+			}
+			if _, err := f.storeRawBlock(id, childType, m); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return key(id), nil
+}
+
+func (f *Fake) addBlock(id, parent, typ string, body map[string]interface{}) {
+	p := notion.Parent{Type: notion.ParentTypeBlock, BlockID: parent}
+	if pg, found := f.pages[key(parent)]; found {
+		p = notion.Parent{Type: notion.ParentTypePage, PageID: pg.ID}
+	}
+
+	now := f.Now()
+	f.blocks[key(id)] = &fakeBlock{id: id, parent: p, typ: typ, body: body, created: now, edited: now}
+	f.children[key(parent)] = append(f.children[key(parent)], key(id))
+}
+
+// splitBlock returns the type and the content of a block, go-notion marshals
+// blocks as {"<type>": {...}}
+func splitBlock(block notion.Block) (string, map[string]interface{}, error) {
+	data, err := json.Marshal(block)
+	if err != nil {
+		return "", nil, validationError("invalid block: %v", err)
+	}
+
+	raw := map[string]map[string]interface{}{}
+	if err := json.Unmarshal(data, &raw); err != nil || len(raw) != 1 {
+		return "", nil, validationError("invalid block: %s", data)
+	}
+
+	for typ, body := range raw {
+		if body == nil {
+			body = map[string]interface{}{}
+		}
+		return typ, body, nil
+	}
+	return "", nil, nil
+}
+
+func (f *Fake) blockJSON(b *fakeBlock) map[string]interface{} {
+	return map[string]interface{}{
+		"object":           "block",
+		"id":               b.id,
+		"parent":           b.parent,
+		"type":             b.typ,
+		b.typ:              b.body,
+		"has_children":     len(f.children[key(b.id)]) > 0,
+		"archived":         b.archived,
+		"created_time":     b.created,
+		"last_edited_time": b.edited,
+	}
+}
+
+// decodeBlocks decodes the blocks as the client decodes a block children response
+func (f *Fake) decodeBlocks(keys []string) ([]notion.Block, error) {
+	results := []interface{}{}
+	for _, k := range keys {
+		results = append(results, f.blockJSON(f.blocks[k]))
+	}
+
+	raw, err := json.Marshal(map[string]interface{}{"results": results})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := notion.BlockChildrenResponse{}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Results, nil
+}
+
+func parentID(p notion.Parent) string {
+	switch p.Type {
+	case notion.ParentTypePage:
+		return p.PageID
+	case notion.ParentTypeDatabase:
+		return p.DatabaseID
+	default:
+		return p.BlockID
+	}
+}
+
+func copyPage(page notion.Page) notion.Page {
+	raw, err := json.Marshal(page)
+	if err != nil {
+		panic(err)
+	}
+
+	out := notion.Page{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func copyDatabase(db notion.Database) notion.Database {
+	raw, err := json.Marshal(db)
+	if err != nil {
+		panic(err)
+	}
+
+	out := notion.Database{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func pageTitle(page notion.Page) string {
+	switch props := page.Properties.(type) {
+	case notion.PageProperties:
+		return plainText(props.Title.Title)
+	case notion.DatabasePageProperties:
+		for _, prop := range props {
+			if prop.Type == notion.DBPropTypeTitle {
+				return plainText(prop.Title)
+			}
+		}
+	}
+	return ""
+}
+
+func plainText(rts []notion.RichText) string {
+	s := ""
+	for _, rt := range rts {
+		s += rt.PlainText
+	}
+	return s
+}
+
+// fillPlainText sets plain text as Notion does, clients often only set text content
+func fillPlainText(rts []notion.RichText) {
+	for i, rt := range rts {
+		if rt.PlainText == "" && rt.Text != nil {
+			rts[i].PlainText = rt.Text.Content
+		}
+		if rts[i].Type == "" {
+			switch {
+			case rt.Text != nil:
+				rts[i].Type = notion.RichTextTypeText
+			case rt.Mention != nil:
+				rts[i].Type = notion.RichTextTypeMention
+			case rt.Equation != nil:
+				rts[i].Type = notion.RichTextTypeEquation
+			}
+		}
+	}
+}
+
+// fillRawPlainText fills plain text and default annotations of rich texts in block content
+// decoded as generic JSON, the API always returns them
+func fillRawPlainText(node interface{}) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		_, isText := n["text"].(map[string]interface{})
+		_, isMention := n["mention"].(map[string]interface{})
+		if _, found := n["annotations"]; (isText || isMention) && !found {
+			n["annotations"] = map[string]interface{}{"color": "default"}
+		}
+		if text, ok := n["text"].(map[string]interface{}); ok {
+			if _, found := n["plain_text"]; !found {
+				n["plain_text"] = text["content"]
+			}
+			if _, found := n["type"]; !found {
+				n["type"] = "text"
+			}
+		}
+		if _, ok := n["mention"].(map[string]interface{}); ok {
+			if _, found := n["type"]; !found {
+				n["type"] = "mention"
+			}
+		}
+		for _, v := range n {
+			fillRawPlainText(v)
+		}
+	case []interface{}:
+		for _, v := range n {
+			fillRawPlainText(v)
+		}
+	}
+}
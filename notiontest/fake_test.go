@@ -0,0 +1,151 @@
+package notiontest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+)
+
+func TestQueryDatabasePaginationAndFilter(t *testing.T) {
+	f := New()
+	f.PageSize = 2
+
+	db := f.AddDatabase("Notes", notion.DatabaseProperties{
+		"Name":  {Type: notion.DBPropTypeTitle},
+		"Score": {Type: notion.DBPropTypeNumber},
+	})
+
+	for i, title := range []string{"b", "a", "c", "skip"} {
+		page := DatabasePage(db.ID, title)
+		score := float64(i)
+		page.Properties.(notion.DatabasePageProperties)["Score"] = notion.DatabasePageProperty{Number: &score}
+		f.AddPage(page)
+	}
+
+	query := &notion.DatabaseQuery{}
+	if err := json.Unmarshal([]byte(`{
+		"filter": {"and": [
+			{"property": "Name", "title": {"does_not_equal": "skip"}},
+			{"property": "Score", "number": {"less_than": 10}}
+		]},
+		"sorts": [{"property": "Name", "direction": "descending"}]
+	}`), query); err != nil {
+		t.Fatal(err)
+	}
+
+	titles := []string{}
+	for {
+		resp, err := f.QueryDatabase(context.Background(), db.ID, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Results) > 2 {
+			t.Fatalf("expect at most 2 results per page, got %d", len(resp.Results))
+		}
+
+		for _, page := range resp.Results {
+			titles = append(titles, pageTitle(page))
+		}
+		if !resp.HasMore {
+			break
+		}
+		query.StartCursor = *resp.NextCursor
+	}
+
+	if got := len(titles); got != 3 || titles[0] != "c" || titles[1] != "b" || titles[2] != "a" {
+		t.Errorf("expect [c b a], got %v", titles)
+	}
+}
+
+func TestQueryDatabaseDateFilter(t *testing.T) {
+	f := New()
+	db := f.AddDatabase("Journal", notion.DatabaseProperties{"Date": {Type: notion.DBPropTypeDate}})
+
+	for _, date := range []string{"2024-01-01", "2024-01-02", "2024-01-03"} {
+		start, _ := notion.ParseDateTime(date)
+		page := DatabasePage(db.ID, date)
+		page.Properties.(notion.DatabasePageProperties)["Date"] = notion.DatabasePageProperty{Date: &notion.Date{Start: start}}
+		f.AddPage(page)
+	}
+
+	after := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	resp, err := f.QueryDatabase(context.Background(), db.ID, &notion.DatabaseQuery{
+		Filter: &notion.DatabaseQueryFilter{
+			Property: "Date",
+			DatabaseQueryPropertyFilter: notion.DatabaseQueryPropertyFilter{
+				Date: &notion.DatePropertyFilter{After: &after},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Results) != 2 {
+		t.Errorf("expect 2 pages after %v, got %d", after, len(resp.Results))
+	}
+}
+
+func TestBlocksTree(t *testing.T) {
+	f := New()
+	page := f.AddPage(notion.Page{
+		Parent:     notion.Parent{Type: notion.ParentTypePage, PageID: "root"},
+		Properties: notion.PageProperties{Title: notion.PageTitle{Title: RichText("Page")}},
+	})
+
+	toggle := &notion.ToggleBlock{
+		RichText: RichText("toggle"),
+		Children: []notion.Block{Paragraph("inside")},
+	}
+	resp, err := f.AppendBlockChildren(context.Background(), page.ID, []notion.Block{Paragraph("first"), toggle})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 2 || resp.Results[0].ID() == "" {
+		t.Fatalf("expect 2 blocks with IDs, got %+v", resp.Results)
+	}
+
+	toggleID := resp.Results[1].ID()
+	if !resp.Results[1].HasChildren() {
+		t.Errorf("expect toggle to have children")
+	}
+
+	children, err := f.FindBlockChildrenByID(context.Background(), toggleID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, ok := children.Results[0].(*notion.ParagraphBlock)
+	if !ok || p.RichText[0].PlainText != "inside" {
+		t.Errorf("expect paragraph inside toggle, got %+v", children.Results)
+	}
+
+	if _, err := f.DeleteBlock(context.Background(), resp.Results[0].ID()); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Children(page.ID); len(got) != 1 || got[0].ID() != toggleID {
+		t.Errorf("expect only toggle after delete, got %+v", got)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	f := New()
+
+	_, err := f.FindPageByID(context.Background(), "missing")
+	if !errors.Is(err, notion.ErrObjectNotFound) {
+		t.Errorf("expect not found, got %v", err)
+	}
+
+	f.Fail = func(method, id string) error {
+		if method == "Search" {
+			return &notion.APIError{Status: 429, Code: "rate_limited"}
+		}
+		return nil
+	}
+	if _, err := f.Search(context.Background(), nil); !errors.Is(err, notion.ErrRateLimited) {
+		t.Errorf("expect rate limited, got %v", err)
+	}
+}
@@ -0,0 +1,394 @@
+package notiontest
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+)
+
+// matchFilter evaluates a database query filter on a page. Supported are compound
+// `and`/`or`, timestamp filters, and text, date, number, checkbox, select,
+// multi_select, status and relation conditions.
+// Dates are compared as instants, `equals` compares the calendar dates.
+func matchFilter(filter *notion.DatabaseQueryFilter, page notion.Page, now time.Time) (bool, error) {
+	if filter == nil {
+		return true, nil
+	}
+
+	if len(filter.And) > 0 {
+		for i := range filter.And {
+			ok, err := matchFilter(&filter.And[i], page, now)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+
+	if len(filter.Or) > 0 {
+		for i := range filter.Or {
+			ok, err := matchFilter(&filter.Or[i], page, now)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	}
+
+	cond := filter.DatabaseQueryPropertyFilter
+
+	switch filter.Timestamp {
+	case notion.TimestampCreatedTime:
+		return matchDate(cond.CreatedTime, &page.CreatedTime, now)
+	case notion.TimestampLastEditedTime:
+		return matchDate(cond.LastEditedTime, &page.LastEditedTime, now)
+	case "":
+	default:
+		return false, validationError("unsupported timestamp filter: %v", filter.Timestamp)
+	}
+
+	if filter.Property == "" {
+		return false, validationError("filter requires a property, timestamp, and or or")
+	}
+
+	prop, found := findProperty(page, filter.Property)
+	if !found {
+		return false, validationError("Could not find property with name or id: %v", filter.Property)
+	}
+
+	switch {
+	case cond.Title != nil:
+		return matchText(cond.Title, plainText(prop.Title)), nil
+	case cond.RichText != nil:
+		return matchText(cond.RichText, plainText(prop.RichText)), nil
+	case cond.URL != nil:
+		return matchText(cond.URL, stringValue(prop.URL)), nil
+	case cond.Email != nil:
+		return matchText(cond.Email, stringValue(prop.Email)), nil
+	case cond.PhoneNumber != nil:
+		return matchText(cond.PhoneNumber, stringValue(prop.PhoneNumber)), nil
+	case cond.Date != nil:
+		return matchDate(cond.Date, dateValue(prop), now)
+	case cond.CreatedTime != nil:
+		return matchDate(cond.CreatedTime, dateValue(prop), now)
+	case cond.LastEditedTime != nil:
+		return matchDate(cond.LastEditedTime, dateValue(prop), now)
+	case cond.Number != nil:
+		return matchNumber(cond.Number, prop.Number), nil
+	case cond.Checkbox != nil:
+		v := prop.Checkbox != nil && *prop.Checkbox
+		if cond.Checkbox.Equals != nil {
+			return v == *cond.Checkbox.Equals, nil
+		}
+		if cond.Checkbox.DoesNotEqual != nil {
+			return v != *cond.Checkbox.DoesNotEqual, nil
+		}
+		return true, nil
+	case cond.Select != nil:
+		f := cond.Select
+		return matchOption(f.Equals, f.DoesNotEqual, f.IsEmpty, f.IsNotEmpty, prop.Select), nil
+	case cond.Status != nil:
+		f := cond.Status
+		return matchOption(f.Equals, f.DoesNotEqual, f.IsEmpty, f.IsNotEmpty, prop.Status), nil
+	case cond.MultiSelect != nil:
+		names := []string{}
+		for _, opt := range prop.MultiSelect {
+			names = append(names, opt.Name)
+		}
+		f := cond.MultiSelect
+		return matchContains(f.Contains, f.DoesNotContain, f.IsEmpty, f.IsNotEmpty, names), nil
+	case cond.Relation != nil:
+		ids := []string{}
+		for _, rel := range prop.Relation {
+			ids = append(ids, key(rel.ID))
+		}
+		f := cond.Relation
+		return matchContains(key(f.Contains), key(f.DoesNotContain), f.IsEmpty, f.IsNotEmpty, ids), nil
+	}
+
+	return false, validationError("unsupported filter on property: %v", filter.Property)
+}
+
+// findProperty finds a property by name or ID, e.g. "title"
+func findProperty(page notion.Page, nameOrID string) (notion.DatabasePageProperty, bool) {
+	props, _ := page.Properties.(notion.DatabasePageProperties)
+	if prop, found := props[nameOrID]; found {
+		return prop, true
+	}
+
+	for _, prop := range props {
+		if prop.ID == nameOrID {
+			return prop, true
+		}
+	}
+	return notion.DatabasePageProperty{}, false
+}
+
+// dateValue is the start of a date property, or the time of a created or edited time property
+func dateValue(prop notion.DatabasePageProperty) *time.Time {
+	switch {
+	case prop.Date != nil:
+		return &prop.Date.Start.Time
+	case prop.CreatedTime != nil:
+		return prop.CreatedTime
+	case prop.LastEditedTime != nil:
+		return prop.LastEditedTime
+	}
+	return nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func matchText(f *notion.TextPropertyFilter, v string) bool {
+	switch {
+	case f.Equals != "":
+		return v == f.Equals
+	case f.DoesNotEqual != "":
+		return v != f.DoesNotEqual
+	case f.Contains != "":
+		return strings.Contains(strings.ToLower(v), strings.ToLower(f.Contains))
+	case f.DoesNotContain != "":
+		return !strings.Contains(strings.ToLower(v), strings.ToLower(f.DoesNotContain))
+	case f.StartsWith != "":
+		return strings.HasPrefix(v, f.StartsWith)
+	case f.EndsWith != "":
+		return strings.HasSuffix(v, f.EndsWith)
+	case f.IsEmpty:
+		return v == ""
+	case f.IsNotEmpty:
+		return v != ""
+	}
+	return true
+}
+
+func matchDate(f *notion.DatePropertyFilter, v *time.Time, now time.Time) (bool, error) {
+	if f == nil {
+		return false, validationError("timestamp filter requires a condition")
+	}
+
+	if f.IsEmpty {
+		return v == nil || v.IsZero(), nil
+	}
+	if f.IsNotEmpty {
+		return v != nil && !v.IsZero(), nil
+	}
+	if v == nil || v.IsZero() { // empty dates match no other conditions
+		return false, nil
+	}
+
+	switch {
+	case f.Equals != nil:
+		y1, m1, d1 := v.UTC().Date()
+		y2, m2, d2 := f.Equals.UTC().Date()
+		return y1 == y2 && m1 == m2 && d1 == d2, nil
+	case f.Before != nil:
+		return v.Before(*f.Before), nil
+	case f.After != nil:
+		return v.After(*f.After), nil
+	case f.OnOrBefore != nil:
+		return !v.After(*f.OnOrBefore), nil
+	case f.OnOrAfter != nil:
+		return !v.Before(*f.OnOrAfter), nil
+	case f.PastWeek != nil:
+		return inRange(*v, now.AddDate(0, 0, -7), now), nil
+	case f.PastMonth != nil:
+		return inRange(*v, now.AddDate(0, -1, 0), now), nil
+	case f.PastYear != nil:
+		return inRange(*v, now.AddDate(-1, 0, 0), now), nil
+	case f.NextWeek != nil:
+		return inRange(*v, now, now.AddDate(0, 0, 7)), nil
+	case f.NextMonth != nil:
+		return inRange(*v, now, now.AddDate(0, 1, 0)), nil
+	case f.NextYear != nil:
+		return inRange(*v, now, now.AddDate(1, 0, 0)), nil
+	}
+	return true, nil
+}
+
+func inRange(v, from, to time.Time) bool {
+	return !v.Before(from) && !v.After(to)
+}
+
+func matchNumber(f *notion.NumberDatabaseQueryFilter, v *float64) bool {
+	if f.IsEmpty {
+		return v == nil
+	}
+	if f.IsNotEmpty {
+		return v != nil
+	}
+	if v == nil {
+		return false
+	}
+
+	switch {
+	case f.Equals != nil:
+		return *v == float64(*f.Equals)
+	case f.DoesNotEqual != nil:
+		return *v != float64(*f.DoesNotEqual)
+	case f.GreaterThan != nil:
+		return *v > float64(*f.GreaterThan)
+	case f.LessThan != nil:
+		return *v < float64(*f.LessThan)
+	case f.GreaterThanOrEqualTo != nil:
+		return *v >= float64(*f.GreaterThanOrEqualTo)
+	case f.LessThanOrEqualTo != nil:
+		return *v <= float64(*f.LessThanOrEqualTo)
+	}
+	return true
+}
+
+func matchOption(equals, notEquals string, isEmpty, isNotEmpty bool, v *notion.SelectOptions) bool {
+	name := ""
+	if v != nil {
+		name = v.Name
+	}
+
+	switch {
+	case equals != "":
+		return name == equals
+	case notEquals != "":
+		return name != notEquals
+	case isEmpty:
+		return name == ""
+	case isNotEmpty:
+		return name != ""
+	}
+	return true
+}
+
+func matchContains(contains, notContains string, isEmpty, isNotEmpty bool, values []string) bool {
+	has := func(s string) bool {
+		for _, v := range values {
+			if v == s {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case contains != "":
+		return has(contains)
+	case notContains != "":
+		return !has(notContains)
+	case isEmpty:
+		return len(values) == 0
+	case isNotEmpty:
+		return len(values) > 0
+	}
+	return true
+}
+
+// sortPages sorts by the sorts in order, pages without a value go last.
+// Without sorts, pages are in created order.
+func sortPages(pages []*notion.Page, sorts []notion.DatabaseQuerySort) error {
+	for _, s := range sorts {
+		if s.Property == "" && s.Timestamp == "" {
+			return validationError("sort requires a property or timestamp")
+		}
+	}
+
+	var sortErr error
+	sort.SliceStable(pages, func(i, j int) bool {
+		for _, s := range sorts {
+			a, aOK, err := sortValue(*pages[i], s)
+			if err != nil {
+				sortErr = err
+				return false
+			}
+			b, bOK, _ := sortValue(*pages[j], s)
+
+			if aOK != bOK {
+				return aOK // empty values last
+			}
+
+			c := compare(a, b)
+			if c == 0 {
+				continue
+			}
+			if s.Direction == notion.SortDirDesc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+
+	return sortErr
+}
+
+// sortValue returns a comparable value of the page for the sort, a string, float64 or time
+func sortValue(page notion.Page, s notion.DatabaseQuerySort) (interface{}, bool, error) {
+	switch s.Timestamp {
+	case notion.SortTimeStampCreatedTime:
+		return page.CreatedTime, true, nil
+	case notion.SortTimeStampLastEditedTime:
+		return page.LastEditedTime, true, nil
+	}
+
+	prop, found := findProperty(page, s.Property)
+	if !found {
+		return nil, false, validationError("Could not find sort property with name or id: %v", s.Property)
+	}
+
+	switch prop.Type {
+	case notion.DBPropTypeTitle:
+		v := plainText(prop.Title)
+		return v, v != "", nil
+	case notion.DBPropTypeRichText:
+		v := plainText(prop.RichText)
+		return v, v != "", nil
+	case notion.DBPropTypeNumber:
+		if prop.Number == nil {
+			return nil, false, nil
+		}
+		return *prop.Number, true, nil
+	case notion.DBPropTypeDate, notion.DBPropTypeCreatedTime, notion.DBPropTypeLastEditedTime:
+		t := dateValue(prop)
+		if t == nil {
+			return nil, false, nil
+		}
+		return *t, true, nil
+	case notion.DBPropTypeCheckbox:
+		if prop.Checkbox != nil && *prop.Checkbox {
+			return 1.0, true, nil
+		}
+		return 0.0, true, nil
+	case notion.DBPropTypeSelect, notion.DBPropTypeStatus:
+		opt := prop.Select
+		if prop.Type == notion.DBPropTypeStatus {
+			opt = prop.Status
+		}
+		if opt == nil {
+			return nil, false, nil
+		}
+		return opt.Name, true, nil
+	}
+
+	return nil, false, validationError("unsupported sort on property: %v", s.Property)
+}
+
+func compare(a, b interface{}) int {
+	switch av := a.(type) {
+	case string:
+		return strings.Compare(av, b.(string))
+	case float64:
+		bv := b.(float64)
+		switch {
+		case av < bv:
+			return -1
+		case av > bv:
+			return 1
+		}
+	case time.Time:
+		return av.Compare(b.(time.Time))
+	}
+	return 0
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/zhuochun/notion-toolset/retry"
+	"github.com/zhuochun/notion-toolset/transformer"
+)
+
+// PageSource provides the pages a cmd processes, e.g. a database query or a search
+type PageSource interface {
+	// Batches sends pages batch by batch to yield, until all pages are sent or yield
+	// returns false
+	Batches(ctx context.Context, yield func([]notion.Page) bool) error
+}
+
+// SourceConfig selects the pages of a cmd in a `source:` block. Set databaseID and
+// databaseIDs (queried together), or one of search, pageIDs and file, or rootPageID.
+type SourceConfig struct {
+	DatabaseID    string      `yaml:"databaseID"`
+	DatabaseIDs   []string    `yaml:"databaseIDs"`   // pages of all databases, each page once
+	DatabaseQuery string      `yaml:"databaseQuery"` // applied to every database
+	Filter        string      `yaml:"filter"`        // or a filter instead, compiled by the schema of every database
+	Sort          string      `yaml:"sort"`          // optional, sorts of the filter
+	Search        *SearchSpec `yaml:"search"`        // or pages found by the workspace search
+	PageIDs       []string    `yaml:"pageIDs"`       // or page IDs or URLs
+	File          string      `yaml:"file"`          // or page IDs or URLs in a file, one per line, "-" reads stdin
+	RootPageID    string      `yaml:"rootPageID"`    // or sub-pages of the page, recursively
+	MaxResults    int         `yaml:"maxResults"`    // optional, stop after the number of pages
+}
+
+func (s SourceConfig) IsZero() bool {
+	return reflect.DeepEqual(s, SourceConfig{})
+}
+
+// Or returns the source, or the fallback when the source is not set, e.g. databaseID
+// and filter at the top level of a cmd config
+func (s SourceConfig) Or(fallback SourceConfig) SourceConfig {
+	if s.IsZero() {
+		return fallback
+	}
+	return s
+}
+
+// stdin is read by a source of file "-"
+var stdin io.Reader = os.Stdin
+
+// NewPageSource returns the source of the config, templates in queries and search are
+// rendered with the builder
+func NewPageSource(ctx context.Context, client NotionAPI, clock Clock, cfg SourceConfig, builder QueryBuilder) (PageSource, error) {
+	databaseIDs := cfg.DatabaseIDs
+	if cfg.DatabaseID != "" {
+		databaseIDs = append([]string{cfg.DatabaseID}, databaseIDs...)
+	}
+
+	set := []string{}
+	if len(databaseIDs) > 0 {
+		set = append(set, "databaseID")
+	}
+	if cfg.Search != nil {
+		set = append(set, "search")
+	}
+	if len(cfg.PageIDs) > 0 || cfg.File != "" {
+		set = append(set, "pageIDs")
+	}
+	if cfg.RootPageID != "" {
+		set = append(set, "rootPageID")
+	}
+	if len(set) == 0 {
+		return nil, errors.Join(ErrConfigRequired, fmt.Errorf("set databaseID, databaseIDs, search, pageIDs, file or rootPageID"))
+	}
+	if len(set) > 1 {
+		return nil, fmt.Errorf("set one source, got %v", strings.Join(set, ", "))
+	}
+
+	switch {
+	case cfg.Search != nil:
+		q := NewSearchQuery(client)
+		q.Clock = clock
+		q.MaxResults = cfg.MaxResults
+		if err := q.SetSearch(*cfg.Search, builder); err != nil {
+			return nil, err
+		}
+		return q, nil
+	case len(cfg.PageIDs) > 0 || cfg.File != "":
+		ids, err := readPageIDs(cfg.PageIDs, cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		return &PageList{Client: client, PageIDs: ids, MaxResults: cfg.MaxResults}, nil
+	case cfg.RootPageID != "":
+		return &PageTree{Client: client, RootPageID: pageIDOf(cfg.RootPageID), MaxResults: cfg.MaxResults}, nil
+	}
+
+	queries := make([]*DatabaseQuery, len(databaseIDs))
+	for i, databaseID := range databaseIDs {
+		q := NewDatabaseQuery(client, databaseID)
+		q.Clock = clock
+		q.MaxResults = cfg.MaxResults
+		if err := q.SetQuery(ctx, QuerySpec{Template: cfg.DatabaseQuery, Filter: cfg.Filter, Sort: cfg.Sort}, builder); err != nil {
+			return nil, fmt.Errorf("database %v: %w", databaseID, err)
+		}
+		queries[i] = q
+	}
+	if len(queries) == 1 {
+		return queries[0], nil
+	}
+	return &DatabasesSource{Queries: queries, MaxResults: cfg.MaxResults}, nil
+}
+
+// DatabasesSource is the pages of multiple database queries, in the order of queries
+type DatabasesSource struct {
+	Queries    []*DatabaseQuery
+	MaxResults int
+}
+
+func (s *DatabasesSource) Batches(ctx context.Context, yield func([]notion.Page) bool) error {
+	e := newPageEmitter(yield, s.MaxResults)
+	for _, q := range s.Queries {
+		if err := q.Batches(ctx, e.Emit); err != nil || e.Done() {
+			return err
+		}
+	}
+	return nil
+}
+
+// PageList is the pages of IDs, a page not found does not stop the pages after it
+type PageList struct {
+	Client     NotionAPI
+	PageIDs    []string
+	MaxResults int
+}
+
+func (l *PageList) Batches(ctx context.Context, yield func([]notion.Page) bool) error {
+	e := newPageEmitter(yield, l.MaxResults)
+
+	errs := []error{}
+	for _, pageID := range l.PageIDs {
+		var page notion.Page
+		err := retry.Do(ctx, func(ctx context.Context) error {
+			var innerErr error
+			page, innerErr = l.Client.FindPageByID(ctx, pageID)
+			return innerErr
+		})
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return errors.Join(append(errs, ctxErr)...)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("find page %v: %w", pageID, err))
+			continue
+		}
+
+		if !e.Emit([]notion.Page{page}) {
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// readPageIDs reads IDs or URLs of pages from the list and the file, blank lines are skipped
+func readPageIDs(list []string, file string) ([]string, error) {
+	lines := append([]string{}, list...)
+
+	if file != "" {
+		var r io.Reader = stdin
+		if file != "-" {
+			f, err := os.Open(file)
+			if err != nil {
+				return nil, fmt.Errorf("open page IDs: %w", err)
+			}
+			defer f.Close()
+			r = f
+		}
+
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("read page IDs: %w", err)
+		}
+	}
+
+	ids := []string{}
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			ids = append(ids, pageIDOf(line))
+		}
+	}
+	return ids, nil
+}
+
+// pageIDOf returns the ID of a page ID or URL, e.g. https://www.notion.so/Title-<id>
+func pageIDOf(s string) string {
+	if strings.HasPrefix(s, "https:") || strings.HasPrefix(s, "http:") {
+		if matches := hashIDRegex.FindAllString(s, -1); len(matches) > 0 {
+			return matches[len(matches)-1]
+		}
+	}
+	return transformer.SimpleID(s)
+}
+
+// PageTree is the sub-pages of a root page, recursively, a parent before its sub-pages.
+// Sub-pages in toggles, columns etc are included, pages of inline databases are not.
+type PageTree struct {
+	Client     NotionAPI
+	RootPageID string
+	MaxResults int
+}
+
+func (t *PageTree) Batches(ctx context.Context, yield func([]notion.Page) bool) error {
+	return t.walk(ctx, t.RootPageID, newPageEmitter(yield, t.MaxResults))
+}
+
+// walk sends the sub-pages in the children of the block
+func (t *PageTree) walk(ctx context.Context, blockID string, e *pageEmitter) error {
+	cursor := ""
+	for {
+		query := &notion.PaginationQuery{StartCursor: cursor}
+		var resp notion.BlockChildrenResponse
+		err := retry.Do(ctx, func(ctx context.Context) error {
+			var innerErr error
+			resp, innerErr = t.Client.FindBlockChildrenByID(ctx, blockID, query)
+			return innerErr
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, block := range resp.Results {
+			switch block.(type) {
+			case *notion.ChildPageBlock:
+				var page notion.Page
+				err := retry.Do(ctx, func(ctx context.Context) error {
+					var innerErr error
+					page, innerErr = t.Client.FindPageByID(ctx, block.ID())
+					return innerErr
+				})
+				if err != nil {
+					return err
+				}
+				if !e.Emit([]notion.Page{page}) {
+					return nil
+				}
+			case *notion.ChildDatabaseBlock:
+				continue
+			}
+
+			if block.HasChildren() {
+				if err := t.walk(ctx, block.ID(), e); err != nil || e.Done() {
+					return err
+				}
+			}
+		}
+
+		if !resp.HasMore || resp.NextCursor == nil {
+			return nil
+		}
+		cursor = *resp.NextCursor
+	}
+}
+
+// pageEmitter sends batches of pages to yield, each page once, up to max pages in
+// total (0 for no limit)
+type pageEmitter struct {
+	yield func([]notion.Page) bool
+	max   int
+
+	count int
+	seen  map[string]bool
+	done  bool
+}
+
+func newPageEmitter(yield func([]notion.Page) bool, max int) *pageEmitter {
+	return &pageEmitter{yield: yield, max: max, seen: map[string]bool{}}
+}
+
+// Emit sends the pages not sent before, it returns false when no more pages are wanted
+func (e *pageEmitter) Emit(pages []notion.Page) bool {
+	if e.done {
+		return false
+	}
+
+	batch := []notion.Page{}
+	for _, page := range pages {
+		if !e.seen[page.ID] {
+			e.seen[page.ID] = true
+			batch = append(batch, page)
+		}
+	}
+	if e.max > 0 && len(batch) > e.max-e.count {
+		batch = batch[:e.max-e.count]
+	}
+	e.count += len(batch)
+
+	if len(batch) > 0 && !e.yield(batch) {
+		e.done = true
+	}
+	if e.max > 0 && e.count >= e.max {
+		e.done = true
+	}
+	return !e.done
+}
+
+// Done is true after yield returns false or max pages are sent
+func (e *pageEmitter) Done() bool {
+	return e.done
+}
+
+// AllPages iterates the pages of the source, the loop can break early to stop
+// querying. An error is the last item.
+func AllPages(ctx context.Context, src PageSource) iter.Seq2[notion.Page, error] {
+	return func(yield func(notion.Page, error) bool) {
+		err := src.Batches(ctx, func(pages []notion.Page) bool {
+			for _, page := range pages {
+				if !yield(page, nil) {
+					return false
+				}
+			}
+			return true
+		})
+		if err != nil {
+			yield(notion.Page{}, err)
+		}
+	}
+}
+
+// GoPages queries the pages of the source in the background. Batches of pages are
+// sent to the channel, which is closed after an error is sent, if any.
+func GoPages(ctx context.Context, src PageSource, size int) (chan []notion.Page, chan error) {
+	pagesChan := make(chan []notion.Page, size)
+	errChan := make(chan error, 1)
+
+	go func() {
+		var stopped error // ctx is done before the pages are sent
+		err := src.Batches(ctx, func(pages []notion.Page) bool {
+			select {
+			case pagesChan <- pages:
+				return true
+			case <-ctx.Done():
+				stopped = ctx.Err()
+				return false
+			}
+		})
+		if err == nil {
+			err = stopped
+		}
+		if err != nil {
+			errChan <- err
+		}
+
+		close(pagesChan)
+	}()
+
+	return pagesChan, errChan
+}
+
+// OncePages queries all pages of the source
+func OncePages(ctx context.Context, src PageSource) ([]notion.Page, error) {
+	pages := []notion.Page{}
+	err := src.Batches(ctx, func(batch []notion.Page) bool {
+		pages = append(pages, batch...)
+		return true
+	})
+	if err != nil {
+		return []notion.Page{}, err
+	}
+	return pages, nil
+}
+
+// errPages are the channels of a source failed to start
+func errPages(err error) (chan []notion.Page, chan error) {
+	pagesChan, errChan := make(chan []notion.Page), make(chan error, 1)
+	errChan <- fmt.Errorf("source: %w", err)
+	close(pagesChan)
+	return pagesChan, errChan
+}
+
+// logSource logs what the source queries, in debug mode
+func logSource(src PageSource) {
+	switch s := src.(type) {
+	case *DatabaseQuery:
+		log.Printf("DatabaseQuery Filter: %+v", s.Query.Filter)
+		log.Printf("DatabaseQuery Sorter: %+v", s.Query.Sorts)
+	case *DatabasesSource:
+		for _, q := range s.Queries {
+			log.Printf("DatabaseQuery %v Filter: %+v, Sorter: %+v", q.DatabaseID, q.Query.Filter, q.Query.Sorts)
+		}
+	case *SearchQuery:
+		log.Printf("Search: %+v, edited after: %v", s.Opts, s.EditedAfter)
+	case *PageList:
+		log.Printf("Pages: %v", s.PageIDs)
+	case *PageTree:
+		log.Printf("Sub-pages of: %v", s.RootPageID)
+	}
+}
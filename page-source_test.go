@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/zhuochun/notion-toolset/notiontest"
+	"github.com/zhuochun/notion-toolset/transformer"
+)
+
+func sourceTitles(t *testing.T, src PageSource) ([]string, error) {
+	t.Helper()
+
+	titles := []string{}
+	pagesChan, errChan := GoPages(t.Context(), src, 1)
+	for pages := range pagesChan {
+		for _, page := range pages {
+			title, _ := transformer.GetPageTitle(page)
+			titles = append(titles, title)
+		}
+	}
+
+	select {
+	case err := <-errChan:
+		return titles, err
+	default:
+		return titles, nil
+	}
+}
+
+func TestDatabasesSource(t *testing.T) {
+	fake := notiontest.New()
+	notes := fake.AddDatabase("Notes", nil)
+	ideas := fake.AddDatabase("Ideas", nil)
+	for _, title := range []string{"Note a", "Skip b"} {
+		fake.AddPage(notiontest.DatabasePage(notes.ID, title))
+	}
+	fake.AddPage(notiontest.DatabasePage(ideas.ID, "Idea c"))
+
+	cfg := SourceConfig{DatabaseID: notes.ID, DatabaseIDs: []string{ideas.ID, notes.ID}, Filter: `Name != "{{.Title}}"`}
+	src, err := NewPageSource(t.Context(), fake, Clock{}, cfg, QueryBuilder{Title: "Skip b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles, err := sourceTitles(t, src); err != nil || strings.Join(titles, ", ") != "Note a, Idea c" {
+		t.Errorf("expect pages of both databases once, got %v, err %v", titles, err)
+	}
+
+	cfg.MaxResults = 1
+	src, _ = NewPageSource(t.Context(), fake, Clock{}, cfg, QueryBuilder{Title: "Skip b"})
+	if titles, _ := sourceTitles(t, src); len(titles) != 1 {
+		t.Errorf("expect 1 page by maxResults, got %v", titles)
+	}
+}
+
+func TestPageList(t *testing.T) {
+	fake := notiontest.New()
+	db := fake.AddDatabase("Notes", nil)
+	a := fake.AddPage(notiontest.DatabasePage(db.ID, "Page a"))
+	b := fake.AddPage(notiontest.DatabasePage(db.ID, "Page b"))
+
+	defer func(r io.Reader) { stdin = r }(stdin)
+	stdin = strings.NewReader("https://www.notion.so/team/Page-b-" + transformer.SimpleID(b.ID) + "\n\nmissing-1\nmissing-2\n")
+
+	src, err := NewPageSource(t.Context(), fake, Clock{}, SourceConfig{PageIDs: []string{a.ID}, File: "-"}, QueryBuilder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	titles, err := sourceTitles(t, src) // does not block on the second missing page
+	if strings.Join(titles, ", ") != "Page a, Page b" {
+		t.Errorf("expect pages found by ID and URL, got %v", titles)
+	}
+	if err == nil || !strings.Contains(err.Error(), "find page missing1") || !strings.Contains(err.Error(), "find page missing2") {
+		t.Errorf("expect both missing pages in the error, got %v", err)
+	}
+}
+
+func TestPageTree(t *testing.T) {
+	fake := notiontest.New()
+	db := fake.AddDatabase("Notes", nil)
+	root := fake.AddPage(notiontest.DatabasePage(db.ID, "Root"), notiontest.Paragraph("Intro"))
+
+	subPage := func(parentID, title string) notion.Page {
+		page, err := fake.CreatePage(t.Context(), notion.CreatePageParams{
+			ParentType: notion.ParentTypePage,
+			ParentID:   parentID,
+			Title:      notiontest.RichText(title),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return page
+	}
+	child := subPage(root.ID, "Child")
+	subPage(child.ID, "Grandchild")
+	subPage(root.ID, "Sibling")
+
+	src, err := NewPageSource(t.Context(), fake, Clock{}, SourceConfig{RootPageID: root.URL}, QueryBuilder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles, err := sourceTitles(t, src); err != nil || strings.Join(titles, ", ") != "Child, Grandchild, Sibling" {
+		t.Errorf("expect sub-pages recursively, got %v, err %v", titles, err)
+	}
+}
+
+func TestNewPageSourceErrors(t *testing.T) {
+	fake := notiontest.New()
+
+	if _, err := NewPageSource(t.Context(), fake, Clock{}, SourceConfig{}, QueryBuilder{}); err == nil || !strings.Contains(err.Error(), "set databaseID") {
+		t.Errorf("expect missing source error, got %v", err)
+	}
+	cfg := SourceConfig{DatabaseID: "db", RootPageID: "root"}
+	if _, err := NewPageSource(t.Context(), fake, Clock{}, cfg, QueryBuilder{}); err == nil || !strings.Contains(err.Error(), "set one source, got databaseID, rootPageID") {
+		t.Errorf("expect multiple sources error, got %v", err)
+	}
+	if got := (SourceConfig{}).Or(cfg); got.RootPageID != "root" {
+		t.Errorf("expect the fallback of an empty source, got %+v", got)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+)
+
+// PageProducer is a cmd that produces pages for later pipeline steps
+type PageProducer interface {
+	OutputPages() []notion.Page
+}
+
+// PageConsumer is a cmd that takes pages from earlier pipeline steps,
+// instead of scanning its database
+type PageConsumer interface {
+	SetInputPages(pages []notion.Page)
+}
+
+type PipelineStep struct {
+	Name       string   `yaml:"name"`       // unique name, referred by inputs of later steps
+	Cmd        string   `yaml:"cmd"`        // cmd to run
+	ConfigPath string   `yaml:"configPath"` // path to config file of the step, relative to the pipeline config, or
+	Config     *Config  `yaml:"config"`     // inline config of the step
+	Inputs     []string `yaml:"inputs"`     // names of earlier steps, their output pages are the input
+}
+
+type PipelineConfig struct {
+	Steps []PipelineStep `yaml:"steps"` // requests of all steps are limited together by --notion-rate
+}
+
+type Pipeline struct {
+	DebugMode bool
+
+	Env CmdEnv
+	PipelineConfig
+
+	outputs map[string][]notion.Page
+}
+
+func init() {
+	RegisterCmd(CmdSpec{
+		Name:        "pipeline",
+		Description: "Run steps of commands in order, passing pages produced by a step to later steps",
+		Section:     "pipeline",
+		Config:      PipelineConfig{},
+		New: func(env CmdEnv, cfg Config) (Cmd, error) {
+			return &Pipeline{
+				DebugMode:      env.DebugMode,
+				Env:            env,
+				PipelineConfig: cfg.Pipeline,
+			}, nil
+		},
+	})
+}
+
+func (p *Pipeline) Validate() error {
+	if len(p.Steps) == 0 {
+		return errors.Join(ErrConfigRequired, fmt.Errorf("set steps"))
+	}
+
+	names := map[string]bool{}
+	for i, step := range p.Steps {
+		if step.Name == "" {
+			return errors.Join(ErrConfigRequired, fmt.Errorf("set name of step %d", i))
+		}
+		if names[step.Name] {
+			return fmt.Errorf("duplicated step name: %v", step.Name)
+		}
+		if _, found := LookupCmd(step.Cmd); !found {
+			return fmt.Errorf("step %v has unknown cmd: `%v`", step.Name, step.Cmd)
+		}
+		for _, input := range step.Inputs {
+			if !names[input] {
+				return fmt.Errorf("step %v has input %v that is not an earlier step", step.Name, input)
+			}
+		}
+		names[step.Name] = true
+	}
+
+	return nil
+}
+
+func (p *Pipeline) Run(ctx context.Context) error {
+	p.outputs = map[string][]notion.Page{}
+
+	for i, step := range p.Steps {
+		start := time.Now()
+		log.Printf("Run step %d/%d: %v (cmd %v)", i+1, len(p.Steps), step.Name, step.Cmd)
+
+		pages, err := p.RunStep(ctx, p.Env, step)
+		if err != nil {
+			return fmt.Errorf("step %v: %w", step.Name, err)
+		}
+		p.outputs[step.Name] = pages
+
+		log.Printf("Completed step %v in %v, output pages: %v", step.Name, time.Since(start).Round(time.Millisecond), len(pages))
+	}
+
+	return nil
+}
+
+func (p *Pipeline) RunStep(ctx context.Context, env CmdEnv, step PipelineStep) ([]notion.Page, error) {
+	configPath := resolveConfigPath(env.ConfigPath, step.ConfigPath)
+	cfg, err := loadCmdConfig(configPath, step.Config)
+	if err != nil {
+		return nil, err
+	}
+	if configPath != "" { // paths in the step config are relative to its file
+		env.ConfigPath = configPath
+	}
+
+	env.Job = strings.TrimPrefix(env.Job+"/"+step.Name, "/")
+
+	cmd, err := NewCmd(step.Cmd, env, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(step.Inputs) > 0 {
+		consumer, ok := cmd.(PageConsumer)
+		if !ok {
+			return nil, fmt.Errorf("cmd %v does not take input pages", step.Cmd)
+		}
+
+		pages := p.InputPages(step.Inputs)
+		consumer.SetInputPages(pages)
+
+		if p.DebugMode {
+			log.Printf("Step %v input pages: %v", step.Name, len(pages))
+		}
+	}
+
+	if err := cmd.Validate(); err != nil {
+		return nil, fmt.Errorf("validate: %w", err)
+	}
+
+	ctx, cancel := cmdContext(ctx, cfg)
+	defer cancel()
+
+	err = cmd.Run(ctx)
+	if flushErr := env.FlushState(); flushErr != nil { // the steps done are kept when a later step fails
+		err = errors.Join(err, flushErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if producer, ok := cmd.(PageProducer); ok {
+		return producer.OutputPages(), nil
+	}
+	return nil, nil
+}
+
+// InputPages unions the output pages of steps, pages are de-duplicated by ID
+func (p *Pipeline) InputPages(steps []string) []notion.Page {
+	seen := map[string]bool{}
+	pages := []notion.Page{}
+
+	for _, name := range steps {
+		for _, page := range p.outputs[name] {
+			if seen[page.ID] {
+				continue
+			}
+			seen[page.ID] = true
+			pages = append(pages, page)
+		}
+	}
+
+	return pages
+}
+
+// OutputPages of the last step
+func (p *Pipeline) OutputPages() []notion.Page {
+	if len(p.Steps) == 0 {
+		return nil
+	}
+	return p.outputs[p.Steps[len(p.Steps)-1].Name]
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+)
+
+type testPipelineCmd struct {
+	input  []notion.Page
+	output []notion.Page
+}
+
+func (c *testPipelineCmd) Validate() error                   { return nil }
+func (c *testPipelineCmd) Run(ctx context.Context) error     { return nil }
+func (c *testPipelineCmd) SetInputPages(pages []notion.Page) { c.input = pages }
+func (c *testPipelineCmd) OutputPages() []notion.Page {
+	if c.output == nil {
+		return c.input
+	}
+	return c.output
+}
+
+func TestPipelinePassesPages(t *testing.T) {
+	consumer := &testPipelineCmd{}
+	RegisterCmd(CmdSpec{Name: "test-producer", New: func(env CmdEnv, cfg Config) (Cmd, error) {
+		return &testPipelineCmd{output: []notion.Page{{ID: "a"}, {ID: "b"}}}, nil
+	}})
+	RegisterCmd(CmdSpec{Name: "test-consumer", New: func(env CmdEnv, cfg Config) (Cmd, error) {
+		return consumer, nil
+	}})
+	defer delete(cmdRegistry, "test-producer")
+	defer delete(cmdRegistry, "test-consumer")
+
+	p := &Pipeline{PipelineConfig: PipelineConfig{Steps: []PipelineStep{
+		{Name: "one", Cmd: "test-producer"},
+		{Name: "two", Cmd: "test-producer"},
+		{Name: "three", Cmd: "test-consumer", Inputs: []string{"one", "two"}},
+	}}}
+
+	if err := p.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := p.Run(t.Context()); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if len(consumer.input) != 2 {
+		t.Fatalf("expected 2 de-duplicated input pages, got %+v", consumer.input)
+	}
+	if len(p.OutputPages()) != 2 {
+		t.Fatalf("expected output of last step, got %+v", p.OutputPages())
+	}
+}
+
+func TestPipelineValidateInputs(t *testing.T) {
+	p := &Pipeline{PipelineConfig: PipelineConfig{Steps: []PipelineStep{
+		{Name: "one", Cmd: "query", Inputs: []string{"two"}},
+		{Name: "two", Cmd: "query"},
+	}}}
+
+	if err := p.Validate(); err == nil {
+		t.Fatalf("expected error for input of a later step")
+	}
+}
+
+func TestPipelineStepConfigPath(t *testing.T) {
+	var stepCfg Config
+	RegisterCmd(CmdSpec{Name: "test-config", New: func(env CmdEnv, cfg Config) (Cmd, error) {
+		stepCfg = cfg
+		return &testPipelineCmd{}, nil
+	}})
+	defer delete(cmdRegistry, "test-config")
+
+	dir := filepath.Join(t.TempDir(), "configs")
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "step.yaml"), []byte("query:\n  databaseID: db1\n"), 0644)
+	t.Chdir(t.TempDir()) // run from another directory
+
+	p := &Pipeline{
+		Env:            CmdEnv{ConfigPath: filepath.Join(dir, "pipeline.yaml")},
+		PipelineConfig: PipelineConfig{Steps: []PipelineStep{{Name: "one", Cmd: "test-config", ConfigPath: "step.yaml"}}},
+	}
+	if err := p.Run(t.Context()); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if stepCfg.Query.DatabaseID != "db1" {
+		t.Errorf("expect the step config read next to the pipeline config, got %+v", stepCfg.Query)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/zhuochun/notion-toolset/transformer"
+)
+
+type QueryConfig struct {
+	DatabaseID    string       `yaml:"databaseID"`
+	DatabaseQuery string       `yaml:"databaseQuery"`
+	Filter        string       `yaml:"filter"`       // or a filter expression, e.g. `Status != Done and "Edited At" after -7d`
+	Sort          string       `yaml:"sort"`         // sorts of the filter, e.g. `-"Created At", Title`
+	LookbackDays  int          `yaml:"lookbackDays"` // fill {{.Date}} in databaseQuery
+	Source        SourceConfig `yaml:"source"`       // or any source, e.g. databaseIDs, search, rootPageID, overrides the above
+}
+
+type Query struct {
+	DebugMode bool
+
+	Client NotionAPI
+	Report *RunReport
+	Clock  Clock
+	QueryConfig
+
+	outputPages []notion.Page
+}
+
+func init() {
+	RegisterCmd(CmdSpec{
+		Name:        "query",
+		Description: "List pages from a database or a source, mostly as the first step of a pipeline",
+		Section:     "query",
+		Config:      QueryConfig{},
+		New: func(env CmdEnv, cfg Config) (Cmd, error) {
+			return &Query{
+				DebugMode:   env.DebugMode,
+				Client:      env.Client,
+				Report:      env.Report,
+				Clock:       env.Clock,
+				QueryConfig: cfg.Query,
+			}, nil
+		},
+	})
+}
+
+func (q *Query) Validate() error {
+	return nil
+}
+
+func (q *Query) Run(ctx context.Context) error {
+	date := "" // default
+	if q.LookbackDays > 0 {
+		date = q.Clock.Date(time.Now().AddDate(0, 0, -q.LookbackDays))
+	}
+
+	source := q.Source.Or(SourceConfig{DatabaseID: q.DatabaseID, DatabaseQuery: q.DatabaseQuery, Filter: q.Filter, Sort: q.Sort})
+	src, err := NewPageSource(ctx, q.Client, q.Clock, source, QueryBuilder{Date: date, Today: q.Clock.Date(time.Now())})
+	if err != nil {
+		return fmt.Errorf("source: %w", err)
+	}
+
+	if q.DebugMode {
+		logSource(src)
+	}
+
+	pagesChan, errChan := GoPages(ctx, src, 1)
+	for pages := range pagesChan {
+		for _, page := range pages {
+			q.outputPages = append(q.outputPages, page)
+
+			if q.DebugMode {
+				title, _ := transformer.GetPageTitle(page)
+				log.Printf("Page: %v, title: %v", page.ID, title)
+			}
+		}
+	}
+	log.Printf("Scanned pages: %v", len(q.outputPages))
+	q.Report.AddScanned(len(q.outputPages))
+
+	select {
+	case err := <-errChan:
+		return err
+	default:
+		return nil
+	}
+}
+
+func (q *Query) OutputPages() []notion.Page {
+	return q.outputPages
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-yaml/yaml"
+)
+
+// CmdEnv holds the runtime settings shared by all commands
+type CmdEnv struct {
+	DebugMode  bool
+	ExecOne    string
+	ConfigPath string
+	MultiMode  bool
+	PlanPath   string
+
+	Client NotionAPI  // requests are rate limited by its transport
+	Report *RunReport // counts of the run, can be nil
+	State  StateStore // pages processed by earlier runs, can be nil
+	Cache  *PageCache // block trees of pages read by earlier runs, can be nil
+	Job    string     // name of the job or pipeline step, scopes the state
+	Args   []string   // positional args after the cmd, for standalone cmds
+	Clock  Clock      // timezone and journal title format, set from the config by NewCmd
+}
+
+// CmdSpec describes a command, register it in an init() of the command file
+type CmdSpec struct {
+	Name        string      // value used in --cmd
+	Description string      // one line description shown in help
+	Section     string      // yaml key of the config section
+	Config      interface{} // zero value of the config section, used in help
+	Standalone  bool        // runs once without notion client, reads its own inputs
+	New         func(env CmdEnv, cfg Config) (Cmd, error)
+}
+
+var cmdRegistry = map[string]CmdSpec{}
+
+// RegisterCmd adds a command to the registry, it panics on duplicated names
+func RegisterCmd(spec CmdSpec) {
+	if spec.Name == "" || spec.New == nil {
+		log.Panicf("Invalid cmd spec: %+v", spec)
+	}
+
+	if _, found := cmdRegistry[spec.Name]; found {
+		log.Panicf("Duplicated cmd: %v", spec.Name)
+	}
+
+	cmdRegistry[spec.Name] = spec
+}
+
+// LookupCmd finds a registered command by name
+func LookupCmd(name string) (CmdSpec, bool) {
+	spec, found := cmdRegistry[name]
+	return spec, found
+}
+
+// CmdSpecs returns all registered commands sorted by name
+func CmdSpecs() []CmdSpec {
+	specs := make([]CmdSpec, 0, len(cmdRegistry))
+	for _, spec := range cmdRegistry {
+		specs = append(specs, spec)
+	}
+
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+	return specs
+}
+
+// NewCmd creates the command by name using its registered constructor
+func NewCmd(name string, env CmdEnv, cfg Config) (Cmd, error) {
+	spec, found := LookupCmd(name)
+	if !found {
+		return nil, fmt.Errorf("unknown cmd: `%v`, run `help` to list commands", name)
+	}
+
+	clock, err := cfg.Clock(env.Clock)
+	if err != nil {
+		return nil, err
+	}
+	env.Clock = clock
+
+	return spec.New(env, cfg)
+}
+
+// cmdContext applies the timeout of the cmd config to ctx
+func cmdContext(ctx context.Context, cfg Config) (context.Context, context.CancelFunc) {
+	if cfg.Timeout > 0 {
+		return context.WithTimeout(ctx, cfg.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// resolveConfigPath returns configPath relative to the directory of parentPath, the config
+// file that refers to it, same as the paths of `include:`
+func resolveConfigPath(parentPath, configPath string) string {
+	if configPath == "" || filepath.IsAbs(configPath) || parentPath == "" {
+		return configPath
+	}
+	return filepath.Join(filepath.Dir(parentPath), configPath)
+}
+
+// loadCmdConfig returns the config read from configPath, or the inline config
+func loadCmdConfig(configPath string, inline *Config) (Config, error) {
+	if configPath != "" {
+		return readConfig(configPath)
+	}
+
+	if inline != nil {
+		return *inline, nil
+	}
+	return Config{}, nil
+}
+
+// DecodeSection decodes a config section that is not a field of Config,
+// it allows commands outside this file to own their config sections
+func (c Config) DecodeSection(section string, out interface{}) error {
+	raw, found := c.Extra[section]
+	if !found {
+		return nil
+	}
+
+	data, err := yaml.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("marshal section %v: %w", section, err)
+	}
+
+	if err := yaml.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("unmarshal section %v: %w", section, err)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Exit codes of the process, automation can alert on partial failures
+const (
+	ExitOK      = 0 // all pages processed
+	ExitFailed  = 1 // a cmd failed to run
+	ExitConfig  = 2 // config could not be loaded or is invalid
+	ExitPartial = 3 // cmds ran, but some pages failed
+)
+
+// RunReport records what a cmd run did, it is safe for concurrent use and
+// its methods are no-op on a nil report
+type RunReport struct {
+	mu sync.Mutex
+
+	Cmd         string        `json:"cmd"`
+	Job         string        `json:"job,omitempty"`
+	StartedAt   time.Time     `json:"startedAt"`
+	Duration    time.Duration `json:"-"`
+	Scanned     int           `json:"scanned"`
+	Written     int           `json:"written"`
+	Skipped     int           `json:"skipped"`
+	Failed      int           `json:"failed"`
+	CacheHits   int           `json:"cacheHits,omitempty"`   // pages read from the cache
+	CacheMisses int           `json:"cacheMisses,omitempty"` // pages queried, not cached or edited since
+	Failures    []RunFailure  `json:"failures,omitempty"`
+	Error       string        `json:"error,omitempty"` // the cmd failed to run
+
+	invalid bool // the cmd failed to create or validate
+}
+
+type RunFailure struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+func NewRunReport(cmd, job string) *RunReport {
+	return &RunReport{Cmd: cmd, Job: job, StartedAt: time.Now()}
+}
+
+func (r *RunReport) AddScanned(n int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Scanned += n
+}
+
+func (r *RunReport) AddWritten(n int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Written += n
+}
+
+func (r *RunReport) AddSkipped(n int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Skipped += n
+}
+
+func (r *RunReport) AddCacheHit() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.CacheHits += 1
+}
+
+func (r *RunReport) AddCacheMiss() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.CacheMisses += 1
+}
+
+// AddFailed records a page or block that failed, id can be a title when there is no ID yet
+func (r *RunReport) AddFailed(id string, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Failed += 1
+	r.Failures = append(r.Failures, RunFailure{ID: id, Error: err.Error()})
+}
+
+// Finish sets the duration and the error of the run
+func (r *RunReport) Finish(err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Duration = time.Since(r.StartedAt)
+	if err != nil {
+		r.Error = err.Error()
+		r.invalid = errors.Is(err, ErrCmdInvalid) || errors.Is(err, ErrConfigInvalid)
+	}
+}
+
+// HasError reports the cmd failed to run
+func (r *RunReport) HasError() bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.Error != ""
+}
+
+func (r *RunReport) ExitCode() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch {
+	case r.invalid:
+		return ExitConfig
+	case r.Error != "":
+		return ExitFailed
+	case r.Failed > 0:
+		return ExitPartial
+	default:
+		return ExitOK
+	}
+}
+
+func (r *RunReport) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := fmt.Sprintf("scanned: %d, written: %d, skipped: %d, failed: %d, in %v",
+		r.Scanned, r.Written, r.Skipped, r.Failed, r.Duration.Round(time.Millisecond))
+	if r.CacheHits > 0 || r.CacheMisses > 0 {
+		s += fmt.Sprintf(", cache hits: %d, misses: %d", r.CacheHits, r.CacheMisses)
+	}
+	if r.Error != "" {
+		s += ", err: " + r.Error
+	}
+	return s
+}
+
+func (r *RunReport) MarshalJSON() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	type report RunReport // without methods, avoids recursion
+	return json.Marshal(struct {
+		*report
+		DurationMs int64 `json:"durationMs"`
+	}{(*report)(r), r.Duration.Milliseconds()})
+}
+
+// exitCode is the code of the first failed run, or ExitPartial if any run partially failed
+func exitCode(reports []*RunReport) int {
+	code := ExitOK
+	for _, r := range reports {
+		switch c := r.ExitCode(); c {
+		case ExitOK:
+		case ExitPartial:
+			code = ExitPartial
+		default:
+			return c
+		}
+	}
+	return code
+}
+
+// writeReports writes the reports of all runs as JSON to path
+func writeReports(path string, reports []*RunReport) error {
+	data, err := json.MarshalIndent(struct {
+		ExitCode int          `json:"exitCode"`
+		Reports  []*RunReport `json:"reports"`
+	}{exitCode(reports), reports}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomicBytes(path, data)
+}
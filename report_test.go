@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRunReportExitCode(t *testing.T) {
+	ok := NewRunReport("collector", "")
+	ok.AddScanned(3)
+	ok.AddWritten(3)
+	ok.Finish(nil)
+
+	partial := NewRunReport("collector", "")
+	partial.AddWritten(2)
+	partial.AddFailed("page-1", errors.New("conflict"))
+	partial.Finish(nil)
+
+	failed := NewRunReport("collector", "")
+	failed.Finish(errors.New("query failed"))
+
+	invalid := NewRunReport("collector", "")
+	invalid.Finish(fmt.Errorf("%w: validate: %w", ErrCmdInvalid, ErrConfigRequired))
+
+	cases := []struct {
+		reports []*RunReport
+		want    int
+	}{
+		{[]*RunReport{ok}, ExitOK},
+		{[]*RunReport{ok, partial}, ExitPartial},
+		{[]*RunReport{partial, failed}, ExitFailed},
+		{[]*RunReport{invalid, partial}, ExitConfig},
+	}
+
+	for i, c := range cases {
+		if got := exitCode(c.reports); got != c.want {
+			t.Errorf("case %d: got exit code %d, want %d", i, got, c.want)
+		}
+	}
+
+	var nilReport *RunReport
+	nilReport.AddFailed("page-1", errors.New("ignored")) // no-op
+}
+
+func TestRunReportJSON(t *testing.T) {
+	r := NewRunReport("llm", "summary")
+	r.AddScanned(2)
+	r.AddSkipped(1)
+	r.AddFailed("page-1", errors.New("openai chat err"))
+	r.Finish(nil)
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]interface{}{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got["cmd"] != "llm" || got["job"] != "summary" || got["scanned"] != 2.0 || got["failed"] != 1.0 {
+		t.Errorf("unexpected report: %s", data)
+	}
+	if _, found := got["durationMs"]; !found {
+		t.Errorf("expect durationMs in report: %s", data)
+	}
+	if failures, _ := got["failures"].([]interface{}); len(failures) != 1 {
+		t.Errorf("expect 1 failure in report: %s", data)
+	}
+}
+
+func TestRunReportConcurrentRead(t *testing.T) {
+	r := NewRunReport("llm", "")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			r.AddScanned(1)
+			r.AddFailed("page", errors.New("failed"))
+		}
+	}()
+	for i := 0; i < 100; i++ { // read while the cmd is still running
+		_ = r.String()
+		_ = r.ExitCode()
+		if _, err := json.Marshal(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+
+	if r.Scanned != 100 || r.HasError() {
+		t.Errorf("unexpected report: %v", r)
+	}
+}
@@ -0,0 +1,113 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Class of an error, decides whether a call is retried
+type Class int
+
+const (
+	Permanent   Class = iota // the call fails the same way again, e.g. validation, not found
+	Transient                // the call may succeed later, e.g. server and network errors
+	RateLimited              // the call is rejected for now, retry after a while
+)
+
+func (c Class) String() string {
+	switch c {
+	case Transient:
+		return "transient"
+	case RateLimited:
+		return "rate_limited"
+	default:
+		return "permanent"
+	}
+}
+
+// Classify an error of Notion, OpenAI or the network. Unknown errors are Permanent,
+// e.g. decode, TLS and template errors fail the same way again.
+func Classify(err error) Class {
+	switch {
+	case err == nil:
+		return Permanent
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return Permanent
+	}
+
+	var notionErr *notion.APIError
+	if errors.As(err, &notionErr) {
+		switch {
+		case errors.Is(err, notion.ErrRateLimited):
+			return RateLimited
+		case errors.Is(err, notion.ErrConflict),
+			errors.Is(err, notion.ErrInternalServer),
+			errors.Is(err, notion.ErrServiceUnavailable):
+			return Transient
+		}
+		return statusClass(notionErr.Status)
+	}
+
+	var openaiErr *openai.APIError
+	if errors.As(err, &openaiErr) {
+		return statusClass(openaiErr.HTTPStatusCode)
+	}
+	var openaiReqErr *openai.RequestError
+	if errors.As(err, &openaiReqErr) {
+		return statusClass(openaiReqErr.HTTPStatusCode)
+	}
+
+	if isNetworkError(err) {
+		return Transient
+	}
+	return Permanent
+}
+
+// isNetworkError reports timeouts, refused or reset connections and truncated responses
+func isNetworkError(err error) bool {
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+
+	// a url.Error is a net.Error of any error it wraps, e.g. x509, check the wrapped one
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func statusClass(status int) Class {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return RateLimited
+	case status == http.StatusRequestTimeout, status == http.StatusConflict, status >= 500:
+		return Transient
+	default:
+		return Permanent
+	}
+}
+
+// IsRetryable reports errors that are Transient or RateLimited
+func IsRetryable(err error) bool {
+	return Classify(err) != Permanent
+}
+
+// IsRejected reports errors where the request was surely not applied: rate limits,
+// Notion transaction conflicts and unavailable service. Safe to retry writes.
+func IsRejected(err error) bool {
+	if Classify(err) == RateLimited {
+		return true
+	}
+
+	return errors.Is(err, notion.ErrConflict) || errors.Is(err, notion.ErrServiceUnavailable)
+}
@@ -1,17 +1,85 @@
 package retry
 
-import "time"
+import (
+	"context"
+	"math/rand"
+	"time"
+)
 
-const Count = 3
-const Delay = time.Second
+// Policy decides how many times and how long to wait between attempts of a call
+type Policy struct {
+	Attempts  int           // attempts including the first call
+	BaseDelay time.Duration // delay before the first retry, doubled on every retry
+	MaxDelay  time.Duration // upper bound of a delay, also of a Retry-After
+	// Retryable decides if an error is worth another attempt, default to IsRetryable
+	Retryable func(error) bool
+}
+
+var (
+	// Default is for reads, transient errors and rate limits are retried
+	Default = Policy{Attempts: 3, BaseDelay: time.Second, MaxDelay: 30 * time.Second}
+	// Write is for calls that are not idempotent, e.g. append blocks, create pages.
+	// Only errors where the request was surely not applied are retried.
+	Write = Policy{Attempts: 3, BaseDelay: time.Second, MaxDelay: 30 * time.Second, Retryable: IsRejected}
+	// LLM is for slow and rate limited LLM completions
+	LLM = Policy{Attempts: 4, BaseDelay: 2 * time.Second, MaxDelay: time.Minute}
+)
+
+// Do calls fn with the Default policy
+func Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	return Default.Do(ctx, fn)
+}
+
+// Do calls fn until it succeeds, fails with an error that is not retryable, the attempts
+// are used up, or ctx is done. Delays grow exponentially with jitter, a rate limited
+// call waits at least the Retry-After of the response.
+func (p Policy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	attempts := p.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
 
-func Do(fn func() error) error {
 	var err error
-	for i := 0; i < Count; i++ {
-		if err = fn(); err == nil {
+	for i := 0; i < attempts; i++ {
+		hint := &retryAfterHint{}
+		if err = fn(withHint(ctx, hint)); err == nil {
 			return nil
 		}
-		time.Sleep(Delay)
+
+		if i == attempts-1 || ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(p.delay(i, hint.get()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
 	}
 	return err
 }
+
+// delay before the retry after attempt i (from 0)
+func (p Policy) delay(i int, retryAfter time.Duration) time.Duration {
+	d := p.BaseDelay << i
+	if p.MaxDelay > 0 && (d > p.MaxDelay || d <= 0) {
+		d = p.MaxDelay
+	}
+	if d > 0 { // jitter in [d/2, d], spread out workers failing together
+		d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	}
+
+	if retryAfter > d {
+		d = retryAfter
+		if p.MaxDelay > 0 && d > p.MaxDelay {
+			d = p.MaxDelay
+		}
+	}
+	return d
+}
@@ -0,0 +1,173 @@
+package retry
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		err  error
+		want Class
+	}{
+		{&notion.APIError{Status: 429, Code: "rate_limited"}, RateLimited},
+		{fmt.Errorf("notion: failed to query: %w", &notion.APIError{Status: 409, Code: "conflict_error"}), Transient},
+		{&notion.APIError{Status: 503, Code: "service_unavailable"}, Transient},
+		{&notion.APIError{Status: 502, Code: "bad_gateway"}, Transient},
+		{&notion.APIError{Status: 400, Code: "validation_error"}, Permanent},
+		{&notion.APIError{Status: 404, Code: "object_not_found"}, Permanent},
+		{&openai.APIError{HTTPStatusCode: 429}, RateLimited},
+		{&openai.APIError{HTTPStatusCode: 500}, Transient},
+		{&openai.RequestError{HTTPStatusCode: 401}, Permanent},
+		{fmt.Errorf("query: %w", context.Canceled), Permanent},
+		{fmt.Errorf("read: %w", syscall.ECONNRESET), Transient},
+		{&url.Error{Op: "Post", URL: "https://api.notion.com", Err: &net.OpError{Op: "dial", Err: errors.New("i/o timeout")}}, Transient},
+		{fmt.Errorf("notion: failed to parse HTTP response: %w", io.ErrUnexpectedEOF), Transient},
+		{fmt.Errorf("notion: failed to parse HTTP response: %w", &json.SyntaxError{Offset: 1}), Permanent},
+		{&url.Error{Op: "Post", URL: "https://api.notion.com", Err: x509.UnknownAuthorityError{}}, Permanent},
+		{errors.New("template: no function \"x\""), Permanent},
+	}
+
+	for _, c := range cases {
+		if got := Classify(c.err); got != c.want {
+			t.Errorf("Classify(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
+
+func TestDoStopsOnPermanent(t *testing.T) {
+	calls := 0
+	err := Policy{Attempts: 3, BaseDelay: time.Millisecond}.Do(context.Background(), func(ctx context.Context) error {
+		calls += 1
+		return &notion.APIError{Status: 400, Code: "validation_error"}
+	})
+
+	if err == nil || calls != 1 {
+		t.Errorf("expect 1 call with error, got %d calls, err: %v", calls, err)
+	}
+}
+
+func TestDoRetriesTransient(t *testing.T) {
+	calls := 0
+	err := Policy{Attempts: 3, BaseDelay: time.Millisecond}.Do(context.Background(), func(ctx context.Context) error {
+		calls += 1
+		if calls < 3 {
+			return &notion.APIError{Status: 500, Code: "internal_server_error"}
+		}
+		return nil
+	})
+
+	if err != nil || calls != 3 {
+		t.Errorf("expect success on 3rd call, got %d calls, err: %v", calls, err)
+	}
+}
+
+func TestWriteRetriesRejectedOnly(t *testing.T) {
+	calls := 0
+	Policy{Attempts: 3, BaseDelay: time.Millisecond, Retryable: IsRejected}.Do(context.Background(), func(ctx context.Context) error {
+		calls += 1
+		return &notion.APIError{Status: 502, Code: "bad_gateway"} // may have been applied
+	})
+
+	if calls != 1 {
+		t.Errorf("expect no retry of an unsure write, got %d calls", calls)
+	}
+}
+
+func TestDoHonoursRetryAfter(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests += 1
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0.2")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewTransport(http.DefaultTransport)}
+	start := time.Now()
+
+	err := Policy{Attempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Second}.Do(context.Background(), func(ctx context.Context) error {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return &notion.APIError{Status: resp.StatusCode, Code: "rate_limited"}
+		}
+		return nil
+	})
+
+	if err != nil || requests != 2 {
+		t.Fatalf("expect success on 2nd request, got %d requests, err: %v", requests, err)
+	}
+	if waited := time.Since(start); waited < 200*time.Millisecond {
+		t.Errorf("expect to wait Retry-After 200ms, waited %v", waited)
+	}
+}
+
+func TestDoStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := 0
+	err := Policy{Attempts: 3, BaseDelay: time.Hour}.Do(ctx, func(ctx context.Context) error {
+		calls += 1
+		cancel()
+		return syscall.ECONNRESET
+	})
+
+	if err == nil || calls != 1 {
+		t.Errorf("expect to stop after cancel, got %d calls, err: %v", calls, err)
+	}
+}
+
+func TestDelay(t *testing.T) {
+	p := Policy{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		if d := p.delay(i, 0); d < want/2 || d > want {
+			t.Errorf("delay(%d) = %v, want in [%v, %v]", i, d, want/2, want)
+		}
+	}
+
+	if d := p.delay(0, 5*time.Second); d != 5*time.Second {
+		t.Errorf("expect Retry-After 5s, got %v", d)
+	}
+	if d := p.delay(0, time.Hour); d != 10*time.Second {
+		t.Errorf("expect Retry-After capped by MaxDelay, got %v", d)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if d := ParseRetryAfter("3", now); d != 3*time.Second {
+		t.Errorf("expect 3s, got %v", d)
+	}
+	if d := ParseRetryAfter("Mon, 01 Jan 2024 00:00:10 GMT", now); d != 10*time.Second {
+		t.Errorf("expect 10s, got %v", d)
+	}
+	if d := ParseRetryAfter("soon", now); d != 0 {
+		t.Errorf("expect 0 for invalid, got %v", d)
+	}
+}
@@ -0,0 +1,74 @@
+package retry
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type hintKey struct{}
+
+// retryAfterHint carries the Retry-After of a response from the transport to Do,
+// as the errors of the clients do not keep the response headers
+type retryAfterHint struct {
+	mu sync.Mutex
+	d  time.Duration
+}
+
+func withHint(ctx context.Context, hint *retryAfterHint) context.Context {
+	return context.WithValue(ctx, hintKey{}, hint)
+}
+
+func (h *retryAfterHint) set(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.d = d
+}
+
+func (h *retryAfterHint) get() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.d
+}
+
+// Transport records the Retry-After of 429 and 503 responses for Do,
+// requests must be sent with the ctx passed to the fn of Do
+type Transport struct {
+	Base http.RoundTripper
+}
+
+func NewTransport(base http.RoundTripper) *Transport {
+	return &Transport{Base: base}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if hint, ok := req.Context().Value(hintKey{}).(*retryAfterHint); ok {
+			hint.set(ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()))
+		}
+	}
+	return resp, nil
+}
+
+// ParseRetryAfter parses the Retry-After header in seconds or as a HTTP date, 0 if invalid
+func ParseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+
+	if secs, err := strconv.ParseFloat(v, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
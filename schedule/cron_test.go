@@ -0,0 +1,55 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	sgt := time.FixedZone("SGT", 8*3600)
+	base := time.Date(2024, 1, 31, 10, 30, 15, 0, sgt) // Wednesday
+
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 31, 10, 31, 0, 0, sgt)},
+		{"@daily", time.Date(2024, 2, 1, 0, 0, 0, 0, sgt)},
+		{"*/15 * * * *", time.Date(2024, 1, 31, 10, 45, 0, 0, sgt)},
+		{"0 9 * * mon-fri", time.Date(2024, 2, 1, 9, 0, 0, 0, sgt)},
+		{"0 0 * * 0", time.Date(2024, 2, 4, 0, 0, 0, 0, sgt)},
+		{"0 0 * * 7", time.Date(2024, 2, 4, 0, 0, 0, 0, sgt)},
+		{"0 0 29 feb *", time.Date(2024, 2, 29, 0, 0, 0, 0, sgt)},
+		{"30 10 1,15 * 5", time.Date(2024, 2, 1, 10, 30, 0, 0, sgt)}, // either day matches
+	}
+
+	for _, c := range cases {
+		cron, err := Parse(c.expr)
+		if err != nil {
+			t.Fatalf("parse %q: %v", c.expr, err)
+		}
+
+		if got := cron.Next(base); !got.Equal(c.want) {
+			t.Errorf("next %q: got %v, want %v", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("expect error for %q", expr)
+		}
+	}
+}
+
+func TestNextImpossible(t *testing.T) {
+	cron, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := cron.Next(time.Now()); !got.IsZero() {
+		t.Errorf("expect zero time, got %v", got)
+	}
+}
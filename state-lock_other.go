@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+// lockFile is a no-op without flock, one process at a time is assumed to write
+// the state file
+func lockFile(path string) (func(), error) {
+	return func() {}, nil
+}
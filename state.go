@@ -0,0 +1,439 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-yaml/yaml"
+)
+
+// StateEntry records a page processed by a cmd
+type StateEntry struct {
+	ProcessedAt time.Time `json:"processedAt"`
+	Hash        string    `json:"hash,omitempty"` // hash of the content processed, cmd specific
+}
+
+// StateStore keeps the pages processed by cmds, grouped by scopes. A scope is a cmd
+// with one of its configs, e.g. `llm/summary`, so reruns can skip processed pages.
+type StateStore interface {
+	Get(scope, id string) (StateEntry, bool)
+	Put(scope, id string, entry StateEntry) error
+	// Scopes returns all scopes sorted by name
+	Scopes() []string
+	// Entries returns a copy of the entries of a scope by page ID
+	Entries(scope string) map[string]StateEntry
+	// Delete removes the entries of ids in the scope, or the whole scope without ids
+	Delete(scope string, ids ...string) error
+	// Flush saves the changes not saved yet
+	Flush() error
+}
+
+// stateFlushPuts is the number of puts saved together, a large database is not
+// rewritten on every page processed
+const stateFlushPuts = 50
+
+// FileStateStore is a StateStore in a JSON file. Puts are saved every stateFlushPuts
+// and on Flush, deletes are saved at once. A save locks the file, reads it again and
+// applies the changes of this process, so processes sharing the file, e.g. a daemon
+// and a manual run, keep the entries of each other.
+type FileStateStore struct {
+	Path string
+
+	mu      sync.Mutex
+	scopes  map[string]map[string]StateEntry
+	pending []stateChange // changes not saved yet
+}
+
+// stateChange is a put of an entry, or a delete of ids, or of the scope without ids
+type stateChange struct {
+	Scope string
+	ID    string
+	Entry *StateEntry // nil to delete
+	IDs   []string
+}
+
+func (c stateChange) apply(scopes map[string]map[string]StateEntry) {
+	if c.Entry != nil {
+		if scopes[c.Scope] == nil {
+			scopes[c.Scope] = map[string]StateEntry{}
+		}
+		scopes[c.Scope][c.ID] = *c.Entry
+		return
+	}
+
+	if len(c.IDs) == 0 {
+		delete(scopes, c.Scope)
+		return
+	}
+	for _, id := range c.IDs {
+		delete(scopes[c.Scope], id)
+	}
+	if len(scopes[c.Scope]) == 0 {
+		delete(scopes, c.Scope)
+	}
+}
+
+type stateFile struct {
+	Scopes map[string]map[string]StateEntry `json:"scopes"`
+}
+
+// OpenFileStateStore reads the state file at path, a missing file is an empty state
+func OpenFileStateStore(path string) (*FileStateStore, error) {
+	scopes, err := readStateFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStateStore{Path: path, scopes: scopes}, nil
+}
+
+func readStateFile(path string) (map[string]map[string]StateEntry, error) {
+	scopes := map[string]map[string]StateEntry{}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return scopes, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("read state: %w", err)
+	}
+
+	var f stateFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("unmarshal state %v: %w", path, err)
+	}
+	if f.Scopes != nil {
+		scopes = f.Scopes
+	}
+	return scopes, nil
+}
+
+func (s *FileStateStore) Get(scope, id string) (StateEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, found := s.scopes[scope][id]
+	return entry, found
+}
+
+func (s *FileStateStore) Put(scope, id string, entry StateEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	change := stateChange{Scope: scope, ID: id, Entry: &entry}
+	change.apply(s.scopes)
+	s.pending = append(s.pending, change)
+	if len(s.pending) < stateFlushPuts {
+		return nil
+	}
+	return s.save()
+}
+
+func (s *FileStateStore) Scopes() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scopes := make([]string, 0, len(s.scopes))
+	for scope := range s.scopes {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+func (s *FileStateStore) Entries(scope string) map[string]StateEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make(map[string]StateEntry, len(s.scopes[scope]))
+	for id, entry := range s.scopes[scope] {
+		entries[id] = entry
+	}
+	return entries
+}
+
+func (s *FileStateStore) Delete(scope string, ids ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	change := stateChange{Scope: scope, IDs: ids}
+	change.apply(s.scopes)
+	s.pending = append(s.pending, change)
+	return s.save()
+}
+
+func (s *FileStateStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.pending) == 0 {
+		return nil
+	}
+	return s.save()
+}
+
+// save applies the pending changes to the state file read again under the file lock,
+// the lock of the store must be held
+func (s *FileStateStore) save() error {
+	if dir := filepath.Dir(s.Path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("create state dir: %w", err)
+		}
+	}
+
+	unlock, err := lockFile(s.Path + ".lock")
+	if err != nil {
+		return fmt.Errorf("lock state: %w", err)
+	}
+	defer unlock()
+
+	scopes, err := readStateFile(s.Path)
+	if err != nil {
+		return err
+	}
+	for _, change := range s.pending {
+		change.apply(scopes)
+	}
+
+	data, err := json.MarshalIndent(stateFile{Scopes: scopes}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal state: %w", err)
+	}
+	if err := writeFileAtomicBytes(s.Path, data); err != nil {
+		return err
+	}
+
+	s.scopes = scopes
+	s.pending = nil
+	return nil
+}
+
+// stateStore is shared by all cmds in the process, nil when --state is empty
+var stateStore StateStore
+
+// setupState opens the state file, changes are not saved in dry-run
+func setupState(path string, dryRun bool) error {
+	if path == "" {
+		return nil
+	}
+
+	store, err := OpenFileStateStore(path)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		stateStore = readOnlyStateStore{store}
+	} else {
+		stateStore = store
+	}
+	return nil
+}
+
+// readOnlyStateStore ignores changes, used by --dry-run where writes are not applied
+type readOnlyStateStore struct {
+	StateStore
+}
+
+func (readOnlyStateStore) Put(scope, id string, entry StateEntry) error { return nil }
+func (readOnlyStateStore) Delete(scope string, ids ...string) error     { return nil }
+func (readOnlyStateStore) Flush() error                                 { return nil }
+
+// CmdState is the state of a cmd run in its scope, methods are no-op on a nil
+// CmdState, or without a store
+type CmdState struct {
+	Store StateStore
+	Scope string
+}
+
+// Get the entry of a processed page
+func (s *CmdState) Get(id string) (StateEntry, bool) {
+	if s == nil || s.Store == nil {
+		return StateEntry{}, false
+	}
+	return s.Store.Get(s.Scope, id)
+}
+
+// Put records the page processed now, with the hash of its content
+func (s *CmdState) Put(id, hash string) error {
+	if s == nil || s.Store == nil {
+		return nil
+	}
+	return s.Store.Put(s.Scope, id, StateEntry{ProcessedAt: time.Now(), Hash: hash})
+}
+
+// CmdState returns the state of cmd name in the scope of the job, or of the config
+// when the job has no name, so different configs of a cmd do not skip each other
+func (env CmdEnv) CmdState(name string, cfg Config) *CmdState {
+	if env.State == nil {
+		return nil
+	}
+
+	if env.Job != "" {
+		return &CmdState{Store: env.State, Scope: name + "/" + env.Job}
+	}
+	return &CmdState{Store: env.State, Scope: name + "/" + configHash(name, cfg)}
+}
+
+// FlushState saves the pending state of the cmds run, no-op without a store. A daemon
+// saves after every job, it does not wait until exit, so a crash does not lose them.
+func (env CmdEnv) FlushState() error {
+	if env.State == nil {
+		return nil
+	}
+	if err := env.State.Flush(); err != nil {
+		return fmt.Errorf("save state: %w", err)
+	}
+	return nil
+}
+
+// configHash is a short hash of the config section of cmd name
+func configHash(name string, cfg Config) string {
+	var section interface{} = cfg
+	if spec, found := LookupCmd(name); found && spec.Section != "" {
+		data, _ := yaml.Marshal(cfg)
+		sections := map[string]interface{}{}
+		if err := yaml.Unmarshal(data, &sections); err == nil {
+			section = sections[spec.Section]
+		}
+	}
+
+	data, _ := yaml.Marshal(section)
+	return contentHash(string(data))[:8]
+}
+
+// contentHash is a short hash to detect changes of a content
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:8])
+}
+
+// StateInspector lists and resets the entries of the state store
+type StateInspector struct {
+	Store StateStore
+	Args  []string // `list [scope]` or `reset <scope> [id...]`
+	Out   io.Writer
+}
+
+func init() {
+	RegisterCmd(CmdSpec{
+		Name:        "state",
+		Description: "List or reset the pages processed by cmds: state list [scope], state reset <scope> [id...]",
+		Standalone:  true,
+		New: func(env CmdEnv, cfg Config) (Cmd, error) {
+			return &StateInspector{
+				Store: env.State,
+				Args:  env.Args,
+				Out:   os.Stdout,
+			}, nil
+		},
+	})
+}
+
+func (s *StateInspector) Validate() error {
+	if s.Store == nil {
+		return errors.Join(ErrConfigRequired, fmt.Errorf("set --state"))
+	}
+
+	if len(s.Args) == 0 {
+		s.Args = []string{"list"}
+	}
+	switch s.Args[0] {
+	case "list":
+	case "reset":
+		if len(s.Args) < 2 {
+			return errors.Join(ErrConfigRequired, fmt.Errorf("set the scope to reset"))
+		}
+	default:
+		return fmt.Errorf("unknown state action: `%v`, use list or reset", s.Args[0])
+	}
+	return nil
+}
+
+func (s *StateInspector) Run(ctx context.Context) error {
+	if s.Args[0] == "reset" {
+		return s.Reset(s.Args[1], s.Args[2:])
+	}
+
+	if len(s.Args) > 1 {
+		return s.ListEntries(s.Args[1])
+	}
+	return s.ListScopes()
+}
+
+// ListScopes prints scopes with their number of entries and the last processed time
+func (s *StateInspector) ListScopes() error {
+	tw := tabwriter.NewWriter(s.Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SCOPE\tPAGES\tLAST PROCESSED")
+
+	for _, scope := range s.Store.Scopes() {
+		last := time.Time{}
+		entries := s.Store.Entries(scope)
+		for _, entry := range entries {
+			if entry.ProcessedAt.After(last) {
+				last = entry.ProcessedAt
+			}
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\n", scope, len(entries), last.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+// ListEntries prints the entries of a scope, the latest processed first
+func (s *StateInspector) ListEntries(scope string) error {
+	entries := s.Store.Entries(scope)
+	if len(entries) == 0 {
+		return fmt.Errorf("no entries in scope: %v", scope)
+	}
+
+	ids := make([]string, 0, len(entries))
+	for id := range entries {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return entries[ids[i]].ProcessedAt.After(entries[ids[j]].ProcessedAt)
+	})
+
+	tw := tabwriter.NewWriter(s.Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tPROCESSED\tHASH")
+	for _, id := range ids {
+		fmt.Fprintf(tw, "%v\t%v\t%v\n", id, entries[id].ProcessedAt.Format(time.RFC3339), entries[id].Hash)
+	}
+	return tw.Flush()
+}
+
+// Reset removes the pages of a scope, or the whole scope without ids. A cmd name
+// without `/` resets all scopes of the cmd.
+func (s *StateInspector) Reset(scope string, ids []string) error {
+	scopes := []string{}
+	for _, sc := range s.Store.Scopes() {
+		if sc == scope || (!strings.Contains(scope, "/") && strings.HasPrefix(sc, scope+"/")) {
+			scopes = append(scopes, sc)
+		}
+	}
+	if len(scopes) == 0 {
+		return fmt.Errorf("no entries in scope: %v", scope)
+	}
+
+	for _, sc := range scopes {
+		if err := s.Store.Delete(sc, ids...); err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			fmt.Fprintf(s.Out, "Reset scope %v\n", sc)
+		} else {
+			fmt.Fprintf(s.Out, "Reset %d pages in scope %v\n", len(ids), sc)
+		}
+	}
+	return nil
+}
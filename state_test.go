@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileStateStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "state.json")
+
+	store, err := OpenFileStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := &CmdState{Store: store, Scope: "llm/summary"}
+	if err := state.Put("page-1", "hash-1"); err != nil {
+		t.Fatal(err)
+	}
+	state.Put("page-2", "hash-2")
+	if unsaved, err := OpenFileStateStore(path); err != nil || len(unsaved.Scopes()) != 0 {
+		t.Fatalf("expect puts saved by flush, got %v, err: %v", unsaved.Scopes(), err)
+	}
+	if err := store.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenFileStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, found := reopened.Get("llm/summary", "page-1"); !found || entry.Hash != "hash-1" || entry.ProcessedAt.IsZero() {
+		t.Errorf("expect page-1 saved, got %+v, found: %v", entry, found)
+	}
+
+	reopened.Delete("llm/summary", "page-1", "page-2")
+	if scopes := reopened.Scopes(); len(scopes) != 0 {
+		t.Errorf("expect empty scope removed, got %v", scopes)
+	}
+}
+
+func TestFileStateStoreShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	daemon, err := OpenFileStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manual, err := OpenFileStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < stateFlushPuts; i++ { // saved without a flush
+		daemon.Put("llm/daily", fmt.Sprintf("page-%d", i), StateEntry{})
+	}
+	manual.Put("llm/manual", "page-1", StateEntry{})
+	if err := manual.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenFileStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(reopened.Entries("llm/daily")); n != stateFlushPuts {
+		t.Errorf("expect entries of the daemon kept, got %d", n)
+	}
+	if _, found := reopened.Get("llm/manual", "page-1"); !found {
+		t.Errorf("expect entries of the manual run saved")
+	}
+}
+
+func TestCmdStateScope(t *testing.T) {
+	env := CmdEnv{State: &FileStateStore{}}
+
+	summary := Config{LLM: LangModelConfig{Prompt: "Summarize"}}
+	translate := Config{LLM: LangModelConfig{Prompt: "Translate"}}
+
+	if a, b := env.CmdState("llm", summary), env.CmdState("llm", translate); a.Scope == b.Scope {
+		t.Errorf("expect configs in different scopes, got %v", a.Scope)
+	}
+	if a, b := env.CmdState("llm", summary), env.CmdState("llm", Config{Name: "other", LLM: summary.LLM}); a.Scope != b.Scope {
+		t.Errorf("expect other sections ignored, got %v and %v", a.Scope, b.Scope)
+	}
+
+	env.Job = "summary"
+	if s := env.CmdState("llm", translate); s.Scope != "llm/summary" {
+		t.Errorf("expect scope of the job, got %v", s.Scope)
+	}
+
+	var nilState *CmdState
+	if _, found := nilState.Get("page"); found || nilState.Put("page", "") != nil {
+		t.Errorf("expect nil state no-op")
+	}
+}
+
+func TestStateInspector(t *testing.T) {
+	store, err := OpenFileStateStore(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Put("llm/summary", "page-1", StateEntry{Hash: "hash-1"})
+	store.Put("llm/translate", "page-1", StateEntry{})
+	store.Put("flashback/daily", "page-2", StateEntry{})
+
+	run := func(args ...string) string {
+		t.Helper()
+
+		out := &bytes.Buffer{}
+		s := &StateInspector{Store: store, Args: args, Out: out}
+		if err := s.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Run(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+
+	if out := run(); !strings.Contains(out, "llm/summary") || !strings.Contains(out, "flashback/daily") {
+		t.Errorf("expect scopes listed, got %q", out)
+	}
+	if out := run("list", "llm/summary"); !strings.Contains(out, "page-1") || !strings.Contains(out, "hash-1") {
+		t.Errorf("expect entries listed, got %q", out)
+	}
+
+	run("reset", "llm")
+	if scopes := store.Scopes(); len(scopes) != 1 || scopes[0] != "flashback/daily" {
+		t.Errorf("expect scopes of llm reset, got %v", scopes)
+	}
+
+	if err := (&StateInspector{Store: store, Args: []string{"reset"}}).Validate(); err == nil {
+		t.Errorf("expect reset requires a scope")
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// tmplFuncs are the functions of all config templates, e.g. "last Monday" is
+// `{{now | addDays -7 | startOfWeek | formatDate "2006-01-02"}}`. Functions taking a
+// time also take a date string like `{{.Date | addYears -1 | date}}`, times and dates
+// are in the timezone of the clock.
+//
+// Outputs of json, mention and link are JSON, they are not escaped by Tmpl
+func tmplFuncs(clock Clock) map[string]interface{} {
+	return map[string]interface{}{
+		"now":          clock.Now,
+		"addDays":      func(n int, v interface{}) (time.Time, error) { return clock.addDate(v, 0, 0, n) },
+		"addMonths":    func(n int, v interface{}) (time.Time, error) { return clock.addDate(v, 0, n, 0) },
+		"addYears":     func(n int, v interface{}) (time.Time, error) { return clock.addDate(v, n, 0, 0) },
+		"startOfWeek":  clock.startOfWeek,
+		"startOfMonth": clock.startOfMonth,
+		"formatDate":   clock.formatDate,
+		"date":         func(v interface{}) (string, error) { return clock.formatDate(layoutDate, v) },
+		"json":         tmplJSON,
+		"mention":      tmplMention,
+		"link":         tmplLink,
+		"env":          tmplEnv,
+	}
+}
+
+// tmplEnvPrefix is the prefix of environment variables readable by templates, so
+// tokens like NOTION_TOKEN are never written into pages or plans
+const tmplEnvPrefix = "NOTION_TOOLSET_"
+
+// tmplEnv reads an environment variable with tmplEnvPrefix
+func tmplEnv(name string) (string, error) {
+	if !strings.HasPrefix(name, tmplEnvPrefix) {
+		return "", fmt.Errorf("env %v is not readable, use a variable starting with %v", name, tmplEnvPrefix)
+	}
+	return os.Getenv(name), nil
+}
+
+// toTime converts a time, or a string of layoutDate or RFC3339, in the timezone
+func (c Clock) toTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t.In(c.loc()), nil
+	case *time.Time:
+		if t != nil {
+			return t.In(c.loc()), nil
+		}
+	case string:
+		if d, err := time.ParseInLocation(layoutDate, t, c.loc()); err == nil {
+			return d, nil
+		}
+		if d, err := time.Parse(time.RFC3339, t); err == nil {
+			return d.In(c.loc()), nil
+		}
+		return time.Time{}, fmt.Errorf("invalid date %q, use %v or RFC3339", t, layoutDate)
+	}
+	return time.Time{}, fmt.Errorf("invalid date %v of type %T", v, v)
+}
+
+func (c Clock) addDate(v interface{}, years, months, days int) (time.Time, error) {
+	t, err := c.toTime(v)
+	if err != nil {
+		return t, err
+	}
+	return t.AddDate(years, months, days), nil
+}
+
+// startOfWeek is the Monday 00:00 of the week
+func (c Clock) startOfWeek(v interface{}) (time.Time, error) {
+	t, err := c.toTime(v)
+	if err != nil {
+		return t, err
+	}
+
+	offset := (int(t.Weekday()) + 6) % 7 // days since Monday
+	y, m, d := t.AddDate(0, 0, -offset).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location()), nil
+}
+
+// startOfMonth is the 1st 00:00 of the month
+func (c Clock) startOfMonth(v interface{}) (time.Time, error) {
+	t, err := c.toTime(v)
+	if err != nil {
+		return t, err
+	}
+
+	y, m, _ := t.Date()
+	return time.Date(y, m, 1, 0, 0, 0, 0, t.Location()), nil
+}
+
+func (c Clock) formatDate(layout string, v interface{}) (string, error) {
+	t, err := c.toTime(v)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(layout), nil
+}
+
+// jsonText is JSON printed as is by Tmpl
+type jsonText string
+
+// tmplEscapeFunc is added by Tmpl to every value printed
+const tmplEscapeFunc = "escapeJSON"
+
+// tmplJSON encodes the value as JSON, e.g. a string with quotes and escapes
+func tmplJSON(v interface{}) (jsonText, error) {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return jsonText(strings.TrimSuffix(b.String(), "\n")), nil
+}
+
+// tmplEscapeJSON escapes the value to be inside a JSON string, JSON is kept as is
+func tmplEscapeJSON(v interface{}) (jsonText, error) {
+	switch t := v.(type) {
+	case nil:
+		return "", nil
+	case jsonText:
+		return t, nil
+	}
+
+	quoted, err := tmplJSON(fmt.Sprint(v))
+	if err != nil {
+		return "", err
+	}
+	return quoted[1 : len(quoted)-1], nil
+}
+
+// tmplMention is a rich text mentioning the page
+func tmplMention(pageID string) (jsonText, error) {
+	return tmplJSON(map[string]interface{}{
+		"type": "mention",
+		"mention": map[string]interface{}{
+			"type": "page",
+			"page": map[string]string{"id": pageID},
+		},
+	})
+}
+
+// tmplLink is a rich text of the content linked to the url
+func tmplLink(content, url string) (jsonText, error) {
+	return tmplJSON(map[string]interface{}{
+		"type": "text",
+		"text": map[string]interface{}{
+			"content": content,
+			"link":    map[string]string{"url": url},
+		},
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+)
+
+func TestTmplFuncs(t *testing.T) {
+	t.Setenv("NOTION_TOOLSET_TAG", "Work")
+
+	cases := []struct {
+		tmpl string
+		want string
+	}{
+		{`{{.Date | addDays -7 | startOfWeek | date}}`, "2024-02-26"}, // 2024-03-06 is a Wednesday
+		{`{{.Date | addYears -1 | formatDate "Jan 2, 2006 Mon"}}`, "Mar 6, 2023 Mon"},
+		{`{{.Date | startOfMonth | addMonths 1 | date}}`, "2024-04-01"},
+		{`{{"2024-03-10T08:00:00Z" | startOfWeek | formatDate "2006-01-02 15:04"}}`, "2024-03-04 00:00"},
+		{`{"content": {{json .Title}}}`, `{"content": "say \"hi\" <&>"}`},
+		{`{"content": "{{.Title}}"}`, `{"content": "say \"hi\" <&>"}`},
+		{`{"content": "{{.Title | printf "%s!"}}"}`, `{"content": "say \"hi\" <&>!"}`},
+		{`{{if .Title}}"{{.Title}}"{{end}}`, `"say \"hi\" <&>"`},
+		{`{{$t := .Title}}[{{json $t}}]`, `["say \"hi\" <&>"]`},
+		{`{{env "NOTION_TOOLSET_TAG"}}`, "Work"},
+	}
+
+	for _, c := range cases {
+		got, err := Tmpl("test", c.tmpl, QueryBuilder{Date: "2024-03-06", Title: `say "hi" <&>`}, Clock{})
+		if err != nil {
+			t.Errorf("Tmpl(%q): %v", c.tmpl, err)
+		} else if string(got) != c.want {
+			t.Errorf("Tmpl(%q) = %s, want %v", c.tmpl, got, c.want)
+		}
+	}
+
+	if _, err := Tmpl("test", `{{.Title | addDays 1}}`, QueryBuilder{Title: "today"}, Clock{}); err == nil {
+		t.Errorf("expect error on invalid date")
+	}
+
+	t.Setenv("NOTION_TOKEN", "secret")
+	if got, err := Tmpl("test", `{{env "NOTION_TOKEN"}}`, nil, Clock{}); err == nil {
+		t.Errorf("expect env without the prefix not readable, got %s", got)
+	}
+}
+
+func TestTmplFuncsTimezone(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Singapore")
+	if err != nil {
+		t.Skip(err)
+	}
+	clock := Clock{Location: loc}
+
+	for tmpl, want := range map[string]string{
+		`{{now | formatDate "-0700"}}`:                 "+0800",
+		`{{"2024-03-10T20:00:00Z" | date}}`:            "2024-03-11",
+		`{{.Date | startOfWeek | formatDate "-0700"}}`: "+0800",
+	} {
+		got, err := TmplText("test", tmpl, QueryBuilder{Date: "2024-03-06"}, clock)
+		if err != nil || got != want {
+			t.Errorf("TmplText(%q) = %v, want %v, err: %v", tmpl, got, want, err)
+		}
+	}
+}
+
+func TestTmplFuncsBlocks(t *testing.T) {
+	w := NewAppendBlock(nil, "")
+	tmpl := `{"rich_text": [{{mention .PageID}}, {{link .Content "https://example.com/?a=1&b=2"}}]}`
+	if err := w.AddParagraph("test", tmpl, BlockBuilder{PageID: samplePageID, Content: `"Quoted" title`}); err != nil {
+		t.Fatal(err)
+	}
+
+	p := w.Blocks[0].(*notion.ParagraphBlock)
+	if p.RichText[0].Mention == nil || p.RichText[0].Mention.Page.ID != samplePageID {
+		t.Errorf("expect page mention, got %+v", p.RichText[0])
+	}
+	if text := p.RichText[1].Text; text == nil || text.Content != `"Quoted" title` || text.Link.URL != "https://example.com/?a=1&b=2" {
+		data, _ := json.Marshal(p.RichText[1])
+		t.Errorf("expect link, got %s", data)
+	}
+}
+
+func TestTmplRange(t *testing.T) {
+	tmpl := `[{{range $i, $p := .Points}}{{if $i}},{{end}}"{{$p}}"{{end}}]`
+	got, err := Tmpl("test", tmpl, map[string]interface{}{
+		"Points": []string{`Tom & "Jerry"`, "line\nbreak"},
+	}, Clock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var points []string
+	if err := json.Unmarshal(got, &points); err != nil {
+		t.Fatalf("expect valid JSON, got %s: %v", got, err)
+	}
+	if len(points) != 2 || points[0] != `Tom & "Jerry"` || points[1] != "line\nbreak" {
+		t.Errorf("expect points kept, got %q", points)
+	}
+}
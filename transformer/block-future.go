@@ -5,6 +5,7 @@ import "github.com/dstotijn/go-notion"
 // BlockFuture ...
 type BlockFuture struct {
 	BlockID string
+	PageID  string // page of the block, to serve its children from a page cache
 
 	done   chan struct{}
 	err    error
@@ -109,15 +109,21 @@ func (m *Markdown) markdownAnnotation(env *markdownEnv, text notion.RichText, pr
 		return
 	}
 
-	switch {
-	case text.Annotations.Bold:
-		env.b.WriteString("**")
-	case text.Annotations.Italic:
-		env.b.WriteString("_")
-	case text.Annotations.Strikethrough:
-		env.b.WriteString("~")
-	case text.Annotations.Code:
-		env.b.WriteString("`")
+	// annotations wrap links, e.g. **[text](url)**
+	writeMarker := func() {
+		switch {
+		case text.Annotations.Bold:
+			env.b.WriteString("**")
+		case text.Annotations.Italic:
+			env.b.WriteString("_")
+		case text.Annotations.Strikethrough:
+			env.b.WriteString("~")
+		case text.Annotations.Code:
+			env.b.WriteString("`")
+		}
+	}
+	if prefix {
+		writeMarker()
 	}
 
 	if text.Type == notion.RichTextTypeMention && text.Mention.Type == notion.MentionTypePage {
@@ -140,6 +146,10 @@ func (m *Markdown) markdownAnnotation(env *markdownEnv, text notion.RichText, pr
 			env.b.WriteString(")")
 		}
 	}
+
+	if !prefix {
+		writeMarker()
+	}
 }
 
 // refers to children that do not need to special case in markdown (not directly convertable)
@@ -0,0 +1,597 @@
+package transformer
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dstotijn/go-notion"
+)
+
+// maxTextLength is the max length of a rich text content in Notion
+const maxTextLength = 2000
+
+// maxNestedDepth is the levels of children Notion creates in a request
+const maxNestedDepth = 2
+
+var (
+	headingRe   = regexp.MustCompile(`^(#{1,6})\s+(.*?)(\s+#+)?$`)
+	listItemRe  = regexp.MustCompile(`^([-*+]|\d+[.)])(\s+(.*))?$`)
+	toDoRe      = regexp.MustCompile(`^\[([ xX])\](\s+(.*))?$`)
+	dividerRe   = regexp.MustCompile(`^(-{3,}|\*{3,}|_{3,})$`)
+	imageRe     = regexp.MustCompile(`^!\[([^\]]*)\]\((https?://[^)\s]+)\)$`)
+	tableSepRe  = regexp.MustCompile(`^\|?(\s*:?-+:?\s*\|)*\s*:?-+:?\s*\|?$`)
+	pageIDRe    = regexp.MustCompile(`^[0-9a-fA-F]{32}$`)
+	codeAliases = map[string]string{
+		"": "plain text", "text": "plain text", "txt": "plain text", "plaintext": "plain text",
+		"js": "javascript", "ts": "typescript", "py": "python", "rb": "ruby", "rs": "rust",
+		"kt": "kotlin", "golang": "go", "yml": "yaml", "md": "markdown", "tex": "latex",
+		"sh": "shell", "zsh": "shell", "console": "shell", "ps1": "powershell", "make": "makefile",
+		"cpp": "c++", "cs": "c#", "csharp": "c#", "objc": "objective-c", "proto": "protobuf",
+		"dockerfile": "docker",
+	}
+	codeLanguages = strings.Split("abap,arduino,bash,basic,c,clojure,coffeescript,c++,c#,css,dart,diff,"+
+		"docker,elixir,elm,erlang,flow,fortran,f#,gherkin,glsl,go,graphql,groovy,haskell,html,java,"+
+		"javascript,json,julia,kotlin,latex,less,lisp,livescript,lua,makefile,markdown,markup,matlab,"+
+		"mermaid,nix,objective-c,ocaml,pascal,perl,php,plain text,powershell,prolog,protobuf,python,r,"+
+		"reason,ruby,rust,sass,scala,scheme,scss,shell,sql,swift,typescript,vb.net,verilog,vhdl,"+
+		"visual basic,webassembly,xml,yaml,java/c/c++/c#", ",")
+)
+
+// ParseMarkdown converts markdown into blocks to write to Notion, it reverses Markdown:
+// headings, bulleted, numbered and to-do lists, quotes, code, equations, dividers, tables
+// and images. Nested list items are children of their item, up to maxNestedDepth levels,
+// deeper items follow their parent. Texts keep bold, italic, strikethrough, code and
+// links, and wikilinks [[id|title]] are page mentions.
+func ParseMarkdown(markdown string) []notion.Block {
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+	code := false
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " \t")
+		if strings.HasPrefix(trimmed, "```") {
+			code = !code
+		} else if code {
+			continue // code is kept as is
+		}
+
+		indent := strings.ReplaceAll(line[:len(line)-len(trimmed)], "\t", "    ")
+		lines[i] = strings.TrimRight(indent+trimmed, " \t")
+	}
+
+	return flattenNested(parseBlocks(skipFrontMatter(lines)), 0)
+}
+
+// flattenNested moves the children nested deeper than maxNestedDepth after their
+// parent, Notion rejects a request nesting deeper. Rows of a table too deep are
+// paragraphs.
+func flattenNested(blocks []notion.Block, depth int) []notion.Block {
+	flat := make([]notion.Block, 0, len(blocks))
+	for _, block := range blocks {
+		children := parsedChildren(block)
+		if depth < maxNestedDepth || len(children) == 0 {
+			setParsedChildren(block, flattenNested(children, depth+1))
+			flat = append(flat, block)
+			continue
+		}
+
+		if _, ok := block.(*notion.TableBlock); ok {
+			for _, child := range children {
+				row := child.(*notion.TableRowBlock)
+				texts := []notion.RichText{}
+				for i, cell := range row.Cells {
+					if i > 0 {
+						texts = append(texts, textRichTexts(" | ", nil, nil)...)
+					}
+					texts = append(texts, cell...)
+				}
+				flat = append(flat, &notion.ParagraphBlock{RichText: texts})
+			}
+			continue
+		}
+
+		setParsedChildren(block, nil)
+		flat = append(flat, block)
+		flat = append(flat, flattenNested(children, depth)...)
+	}
+	return flat
+}
+
+// parsedChildren returns the children of the blocks parsed with children
+func parsedChildren(block notion.Block) []notion.Block {
+	switch b := block.(type) {
+	case *notion.BulletedListItemBlock:
+		return b.Children
+	case *notion.NumberedListItemBlock:
+		return b.Children
+	case *notion.ToDoBlock:
+		return b.Children
+	case *notion.TableBlock:
+		return b.Children
+	}
+	return nil
+}
+
+func setParsedChildren(block notion.Block, children []notion.Block) {
+	if len(children) == 0 {
+		children = nil
+	}
+	switch b := block.(type) {
+	case *notion.BulletedListItemBlock:
+		b.Children = children
+	case *notion.NumberedListItemBlock:
+		b.Children = children
+	case *notion.ToDoBlock:
+		b.Children = children
+	case *notion.TableBlock:
+		b.Children = children
+	}
+}
+
+// skipFrontMatter skips the front matters written by Markdown
+func skipFrontMatter(lines []string) []string {
+	if len(lines) == 0 || lines[0] != "---" {
+		return lines
+	}
+
+	for i := 1; i < len(lines); i++ {
+		if lines[i] == "---" {
+			return lines[i+1:]
+		} else if lines[i] == "" || strings.HasPrefix(lines[i], " ") || !strings.Contains(lines[i], ":") {
+			break // not front matters, e.g. a divider
+		}
+	}
+	return lines
+}
+
+func parseBlocks(lines []string) []notion.Block {
+	blocks := []notion.Block{}
+
+	for i := 0; i < len(lines); {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			i++
+			continue
+		}
+
+		var block notion.Block
+		n := 1
+
+		switch {
+		case strings.HasPrefix(line, "```"):
+			block, n = parseCode(lines[i:])
+		case strings.HasPrefix(line, "$$"):
+			block, n = parseEquation(lines[i:])
+		case dividerRe.MatchString(line):
+			block = &notion.DividerBlock{}
+		case headingRe.MatchString(line):
+			block = parseHeading(line)
+		case listItemRe.MatchString(line):
+			block, n = parseListItem(lines[i:])
+		case strings.HasPrefix(line, ">"):
+			block, n = parseQuote(lines[i:])
+		case strings.HasPrefix(line, "|"):
+			block, n = parseTable(lines[i:])
+		case imageRe.MatchString(line):
+			m := imageRe.FindStringSubmatch(line)
+			block = &notion.ImageBlock{
+				Type:     notion.FileTypeExternal,
+				External: &notion.FileExternal{URL: m[2]},
+				Caption:  ParseRichText(m[1]),
+			}
+		default:
+			text, size := continuation(lines[i:])
+			block, n = &notion.ParagraphBlock{RichText: ParseRichText(text)}, size
+		}
+
+		blocks = append(blocks, block)
+		i += n
+	}
+
+	return blocks
+}
+
+// startsBlock is true when the line is not a text continued from the previous line
+func startsBlock(line string) bool {
+	line = strings.TrimSpace(line)
+	return line == "" || strings.HasPrefix(line, "```") || strings.HasPrefix(line, "$$") ||
+		strings.HasPrefix(line, ">") || strings.HasPrefix(line, "|") || dividerRe.MatchString(line) ||
+		headingRe.MatchString(line) || listItemRe.MatchString(line) || imageRe.MatchString(line)
+}
+
+// continuation joins the first line and the lines continuing it, e.g. lines of a paragraph,
+// and returns the number of lines
+func continuation(lines []string) (string, int) {
+	texts := []string{strings.TrimSpace(lines[0])}
+	n := 1
+	for n < len(lines) && !startsBlock(lines[n]) {
+		texts = append(texts, strings.TrimSpace(lines[n]))
+		n++
+	}
+	return strings.Join(texts, "\n"), n
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func parseHeading(line string) notion.Block {
+	m := headingRe.FindStringSubmatch(line)
+	text := ParseRichText(m[2])
+
+	// Markdown writes a page title as #, and headings 1 to 3 as ## to ####
+	switch len(m[1]) {
+	case 1, 2:
+		return &notion.Heading1Block{RichText: text}
+	case 3:
+		return &notion.Heading2Block{RichText: text}
+	default:
+		return &notion.Heading3Block{RichText: text}
+	}
+}
+
+// parseListItem parses the item with the lines indented under it as its children
+func parseListItem(lines []string) (notion.Block, int) {
+	indent := indentOf(lines[0])
+	m := listItemRe.FindStringSubmatch(strings.TrimSpace(lines[0]))
+
+	first := append([]string{m[3]}, lines[1:]...)
+	text, n := continuation(first)
+
+	// children are indented more than the item, blank lines in between
+	end := n
+	for i := n; i < len(lines); i++ {
+		if lines[i] == "" {
+			continue
+		}
+		if indentOf(lines[i]) <= indent {
+			break
+		}
+		end = i + 1
+	}
+
+	children := []notion.Block{}
+	if end > n {
+		nested := lines[n:end]
+		dedent := -1
+		for _, line := range nested {
+			if line != "" && (dedent < 0 || indentOf(line) < dedent) {
+				dedent = indentOf(line)
+			}
+		}
+		for i, line := range nested {
+			if line != "" {
+				nested[i] = line[dedent:]
+			}
+		}
+		children = parseBlocks(nested)
+	}
+
+	switch {
+	case m[1] != "-" && m[1] != "*" && m[1] != "+":
+		return &notion.NumberedListItemBlock{RichText: ParseRichText(text), Children: children}, end
+	case toDoRe.MatchString(text):
+		t := toDoRe.FindStringSubmatch(text)
+		checked := t[1] != " "
+		return &notion.ToDoBlock{RichText: ParseRichText(t[3]), Checked: &checked, Children: children}, end
+	default:
+		return &notion.BulletedListItemBlock{RichText: ParseRichText(text), Children: children}, end
+	}
+}
+
+// parseQuote parses the lines of > as a quote, callouts are written as quotes too
+func parseQuote(lines []string) (notion.Block, int) {
+	texts := []string{}
+	n := 0
+	for ; n < len(lines); n++ {
+		line := strings.TrimSpace(lines[n])
+		if strings.HasPrefix(line, ">") {
+			line = strings.TrimSpace(strings.TrimPrefix(line, ">"))
+		} else if n > 0 && startsBlock(line) {
+			break
+		}
+		texts = append(texts, line)
+	}
+
+	return &notion.QuoteBlock{RichText: ParseRichText(strings.Join(texts, "\n"))}, n
+}
+
+func parseCode(lines []string) (notion.Block, int) {
+	indent := indentOf(lines[0])
+	language := codeLanguage(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lines[0]), "```")))
+
+	code := []string{}
+	n := 1
+	for ; n < len(lines); n++ {
+		if strings.HasPrefix(strings.TrimSpace(lines[n]), "```") {
+			n++
+			break
+		}
+		line := lines[n]
+		line = line[min(indent, indentOf(line)):]
+		code = append(code, line)
+	}
+
+	return &notion.CodeBlock{RichText: textRichTexts(strings.Join(code, "\n"), nil, nil), Language: &language}, n
+}
+
+// codeLanguage is the language supported by Notion, or plain text
+func codeLanguage(lang string) string {
+	lang = strings.ToLower(lang)
+	if alias, found := codeAliases[lang]; found {
+		return alias
+	}
+	for _, l := range codeLanguages {
+		if l == lang {
+			return lang
+		}
+	}
+	return "plain text"
+}
+
+func parseEquation(lines []string) (notion.Block, int) {
+	first := strings.TrimSpace(lines[0])
+	if len(first) > 4 && strings.HasSuffix(first, "$$") { // $$ x $$ in a line
+		return &notion.EquationBlock{Expression: strings.TrimSpace(first[2 : len(first)-2])}, 1
+	}
+
+	expr := []string{strings.TrimSpace(strings.TrimPrefix(first, "$$"))}
+	n := 1
+	for ; n < len(lines); n++ {
+		line := strings.TrimSpace(lines[n])
+		if strings.HasSuffix(line, "$$") {
+			expr = append(expr, strings.TrimSuffix(line, "$$"))
+			n++
+			break
+		}
+		expr = append(expr, line)
+	}
+
+	return &notion.EquationBlock{Expression: strings.TrimSpace(strings.Join(expr, "\n"))}, n
+}
+
+// parseTable parses the rows of | as a table, a separator row after the first row
+// makes it the column header
+func parseTable(lines []string) (notion.Block, int) {
+	table := &notion.TableBlock{}
+	rows := [][][]notion.RichText{}
+
+	n := 0
+	for ; n < len(lines); n++ {
+		line := strings.TrimSpace(lines[n])
+		if !strings.HasPrefix(line, "|") {
+			break
+		}
+		if tableSepRe.MatchString(line) {
+			table.HasColumnHeader = table.HasColumnHeader || len(rows) == 1
+			continue
+		}
+
+		cells := [][]notion.RichText{}
+		for _, cell := range splitTableRow(line) {
+			cells = append(cells, ParseRichText(strings.ReplaceAll(cell, "<br>", "\n")))
+		}
+		rows = append(rows, cells)
+		table.TableWidth = max(table.TableWidth, len(cells))
+	}
+
+	for _, cells := range rows {
+		for len(cells) < table.TableWidth { // rows have the same number of cells
+			cells = append(cells, []notion.RichText{})
+		}
+		table.Children = append(table.Children, &notion.TableRowBlock{Cells: cells})
+	}
+	return table, n
+}
+
+// splitTableRow splits "| a | b |" into cells, \| is a pipe in a cell
+func splitTableRow(line string) []string {
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "|"), "|")
+
+	cells := []string{}
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// ParseRichText converts a markdown text into rich texts with annotations and links,
+// wikilinks [[id|title]] are page mentions
+func ParseRichText(s string) []notion.RichText {
+	return appendRichText([]notion.RichText{}, s, notion.Annotations{}, nil)
+}
+
+func appendRichText(texts []notion.RichText, s string, ann notion.Annotations, link *string) []notion.RichText {
+	var plain strings.Builder
+	flush := func() {
+		if plain.Len() > 0 {
+			texts = append(texts, textRichTexts(plain.String(), &ann, link)...)
+			plain.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_~[]()#|!>-", s[i+1]) >= 0:
+			plain.WriteByte(s[i+1])
+			i += 2
+			continue
+		case c == '`':
+			if end := strings.IndexByte(s[i+1:], '`'); end > 0 {
+				flush()
+				code := ann
+				code.Code = true
+				texts = append(texts, textRichTexts(s[i+1:i+1+end], &code, link)...)
+				i += end + 2
+				continue
+			}
+		case strings.HasPrefix(s[i:], "[["):
+			if end := strings.Index(s[i+2:], "]]"); end > 0 {
+				id, title, _ := strings.Cut(s[i+2:i+2+end], "|")
+				if pageIDRe.MatchString(SimpleID(id)) {
+					flush()
+					texts = append(texts, mentionRichText(SimpleID(id), title, ann))
+					i += end + 4
+					continue
+				}
+			}
+		case c == '[' && link == nil:
+			if textEnd, end, url, ok := matchLink(s, i); ok {
+				flush()
+				texts = appendRichText(texts, s[i+1:textEnd], ann, &url)
+				i = end
+				continue
+			}
+		case c == '*' || c == '_' || c == '~':
+			if size, end, emphasis, ok := matchEmphasis(s, i, ann); ok {
+				flush()
+				texts = appendRichText(texts, s[i+size:end], emphasis, link)
+				i = end + size
+				continue
+			}
+		}
+
+		plain.WriteByte(c)
+		i++
+	}
+
+	flush()
+	return texts
+}
+
+// matchLink matches [text](url) at i, and returns the end of the text at "]" and
+// the end after ")"
+func matchLink(s string, i int) (int, int, string, bool) {
+	depth := 0
+	for j := i; j < len(s); j++ {
+		switch s[j] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth > 0 {
+				continue
+			}
+			if j+1 >= len(s) || s[j+1] != '(' {
+				return 0, 0, "", false
+			}
+			end := strings.IndexByte(s[j+2:], ')')
+			if end < 0 {
+				return 0, 0, "", false
+			}
+			url := s[j+2 : j+2+end]
+			return j, j + 2 + end + 1, url, url != "" && !strings.ContainsAny(url, " \n")
+		}
+	}
+	return 0, 0, "", false
+}
+
+// matchEmphasis matches a text in *, **, ***, _, __, ~ or ~~ at i, and returns the
+// size of the marker, the start of the closing marker and the annotations
+func matchEmphasis(s string, i int, ann notion.Annotations) (int, int, notion.Annotations, bool) {
+	c := s[i]
+	size := runLength(s, i)
+	if size > 3 || (c == '~' && size > 2) || i+size >= len(s) || s[i+size] == ' ' {
+		return 0, 0, ann, false
+	}
+	if c == '_' && i > 0 && isWordByte(s[i-1]) { // snake_case
+		return 0, 0, ann, false
+	}
+
+	for j := i + size; j < len(s); {
+		if s[j] == '`' { // markers in code are text
+			if end := strings.IndexByte(s[j+1:], '`'); end >= 0 {
+				j += end + 2
+				continue
+			}
+		}
+		if s[j] != c {
+			j++
+			continue
+		}
+
+		run := runLength(s, j)
+		if run == size && s[j-1] != ' ' && (c != '_' || j+run >= len(s) || !isWordByte(s[j+run])) {
+			switch {
+			case c == '~':
+				ann.Strikethrough = true
+			case size == 1:
+				ann.Italic = true
+			case size == 2:
+				ann.Bold = true
+			default:
+				ann.Bold, ann.Italic = true, true
+			}
+			return size, j, ann, true
+		}
+		j += run
+	}
+	return 0, 0, ann, false
+}
+
+func runLength(s string, i int) int {
+	n := 1
+	for i+n < len(s) && s[i+n] == s[i] {
+		n++
+	}
+	return n
+}
+
+// isWordByte is a letter, digit, or a byte of a non-ASCII char
+func isWordByte(c byte) bool {
+	return c >= utf8.RuneSelf || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// textRichTexts is the text in rich texts of maxTextLength
+func textRichTexts(s string, ann *notion.Annotations, link *string) []notion.RichText {
+	if ann == nil {
+		ann = &notion.Annotations{}
+	}
+
+	texts := []notion.RichText{}
+	for s != "" {
+		size := len(s)
+		if utf8.RuneCountInString(s) > maxTextLength {
+			size = len(string([]rune(s)[:maxTextLength]))
+		}
+
+		a := *ann
+		text := notion.RichText{
+			Type:        notion.RichTextTypeText,
+			Annotations: &a,
+			PlainText:   s[:size],
+			Text:        &notion.Text{Content: s[:size]},
+		}
+		if link != nil {
+			text.HRef = link
+			text.Text.Link = &notion.Link{URL: *link}
+		}
+
+		texts = append(texts, text)
+		s = s[size:]
+	}
+	return texts
+}
+
+func mentionRichText(pageID, title string, ann notion.Annotations) notion.RichText {
+	return notion.RichText{
+		Type:        notion.RichTextTypeMention,
+		Annotations: &ann,
+		PlainText:   title,
+		Mention: &notion.Mention{
+			Type: notion.MentionTypePage,
+			Page: &notion.ID{ID: pageID},
+		},
+	}
+}
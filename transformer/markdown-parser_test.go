@@ -0,0 +1,159 @@
+package transformer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+)
+
+const samplePageID = "0123456789abcdef0123456789abcdef"
+
+func TestParseMarkdownRoundTrip(t *testing.T) {
+	markdown := "## Heading One\n\n" +
+		"### Heading Two\n\n" +
+		"#### Heading Three\n\n" +
+		"Some **bold**, _italic_, ~struck~ and `code` with [a link](https://example.com) and [[" + samplePageID + "|Other Page]]\n" +
+		"in two lines of snake_case\n\n" +
+		"**[Bold link](https://example.com/a_b)**\n\n" +
+		"- Bullet item\n\n" +
+		"0. Numbered item\n\n" +
+		"- [x] Done task\n\n" +
+		"- [ ] Open task\n\n" +
+		"> A quote\n\n" +
+		"``` go\nfunc main() {\n\tprintln(\"*not bold*\")\n}\n```\n\n" +
+		"$$\nE = mc^2\n$$\n\n" +
+		"---\n\n" +
+		"![Caption](https://example.com/image.png)\n\n"
+
+	blocks := ParseMarkdown(markdown)
+	if got := New(MarkdownConfig{}, nil, blocks, nil, nil).Transform(); got != markdown {
+		t.Errorf("expect round trip, got:\n%v\nwant:\n%v", got, markdown)
+	}
+}
+
+func TestParseMarkdownNested(t *testing.T) {
+	blocks := ParseMarkdown(`# Title
+
+- Parent
+  - Child with **bold**
+    1. Grandchild
+
+  Child paragraph
+- Sibling
+	- Tab indented
+
+| Name | Note |
+| --- | --- |
+| A \| B | line<br>break |
+| C |
+`)
+
+	if len(blocks) != 4 {
+		t.Fatalf("expect 4 blocks, got %d: %#v", len(blocks), blocks)
+	}
+	if _, ok := blocks[0].(*notion.Heading1Block); !ok {
+		t.Errorf("expect heading, got %T", blocks[0])
+	}
+
+	parent := blocks[1].(*notion.BulletedListItemBlock)
+	if ConcatRichText(parent.RichText) != "Parent" || len(parent.Children) != 2 {
+		t.Fatalf("expect parent with 2 children, got %#v", parent)
+	}
+	child := parent.Children[0].(*notion.BulletedListItemBlock)
+	if len(child.RichText) != 2 || !child.RichText[1].Annotations.Bold {
+		t.Errorf("expect bold in child, got %#v", child.RichText)
+	}
+	if _, ok := child.Children[0].(*notion.NumberedListItemBlock); !ok || len(child.Children) != 1 {
+		t.Errorf("expect numbered grandchild, got %#v", child.Children)
+	}
+	if p, ok := parent.Children[1].(*notion.ParagraphBlock); !ok || ConcatRichText(p.RichText) != "Child paragraph" {
+		t.Errorf("expect child paragraph, got %#v", parent.Children[1])
+	}
+
+	sibling := blocks[2].(*notion.BulletedListItemBlock)
+	if len(sibling.Children) != 1 {
+		t.Errorf("expect tab indented child, got %#v", sibling.Children)
+	}
+
+	table := blocks[3].(*notion.TableBlock)
+	if table.TableWidth != 2 || !table.HasColumnHeader || len(table.Children) != 3 {
+		t.Fatalf("expect table 2x3 with header, got %#v", table)
+	}
+	row := table.Children[1].(*notion.TableRowBlock)
+	if ConcatRichText(row.Cells[0]) != "A | B" || ConcatRichText(row.Cells[1]) != "line\nbreak" {
+		t.Errorf("unexpected cells: %#v", row.Cells)
+	}
+	if last := table.Children[2].(*notion.TableRowBlock); len(last.Cells) != 2 {
+		t.Errorf("expect rows padded, got %d cells", len(last.Cells))
+	}
+}
+
+func TestParseMarkdownDepth(t *testing.T) {
+	blocks := ParseMarkdown(`- One
+  - Two
+    - Three
+      - Four
+        | A | B |
+    - Three again
+`)
+
+	one := blocks[0].(*notion.BulletedListItemBlock)
+	two := one.Children[0].(*notion.BulletedListItemBlock)
+	if len(blocks) != 1 || len(one.Children) != 1 {
+		t.Fatalf("expect one item with a child, got %#v", blocks)
+	}
+
+	texts := []string{}
+	for _, child := range two.Children {
+		switch b := child.(type) {
+		case *notion.BulletedListItemBlock:
+			if len(b.Children) != 0 {
+				t.Errorf("expect no children at depth %d, got %#v", maxNestedDepth, b.Children)
+			}
+			texts = append(texts, ConcatRichText(b.RichText))
+		case *notion.ParagraphBlock:
+			texts = append(texts, ConcatRichText(b.RichText))
+		}
+	}
+	if got := strings.Join(texts, ","); got != "Three,Four,A | B,Three again" {
+		t.Errorf("expect deeper items after their parent, got %v", got)
+	}
+}
+
+func TestParseRichText(t *testing.T) {
+	texts := ParseRichText(`***both*** \*literal\* 2 * 3 **[[` + samplePageID + `|Page]]** __under__`)
+
+	expected := []struct {
+		text    string
+		bold    bool
+		italic  bool
+		mention bool
+	}{
+		{"both", true, true, false},
+		{" *literal* 2 * 3 ", false, false, false},
+		{"Page", true, false, true},
+		{" ", false, false, false},
+		{"under", true, false, false},
+	}
+	if len(texts) != len(expected) {
+		t.Fatalf("expect %d texts, got %d: %#v", len(expected), len(texts), texts)
+	}
+	for i, e := range expected {
+		got := texts[i]
+		if got.PlainText != e.text || got.Annotations.Bold != e.bold || got.Annotations.Italic != e.italic || (got.Mention != nil) != e.mention {
+			t.Errorf("text %d: expect %+v, got %q %+v", i, e, got.PlainText, got.Annotations)
+		}
+	}
+	if texts[2].Mention.Page.ID != samplePageID {
+		t.Errorf("expect mention of %v, got %v", samplePageID, texts[2].Mention.Page.ID)
+	}
+
+	long := make([]rune, maxTextLength+10)
+	for i := range long {
+		long[i] = '字'
+	}
+	if texts := ParseRichText(string(long)); len(texts) != 2 || len([]rune(texts[1].Text.Content)) != 10 {
+		t.Errorf("expect long text split, got %d texts", len(texts))
+	}
+}
@@ -109,6 +109,9 @@ func (m *Markdown) loadChildren(blockID string) {
 	}
 
 	block := NewBlockFuture(blockID)
+	if m.page != nil {
+		block.PageID = m.page.ID
+	}
 	m.children[blockID] = block
 	m.queryChan <- block
 }
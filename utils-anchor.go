@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/zhuochun/notion-toolset/retry"
+	"github.com/zhuochun/notion-toolset/transformer"
+)
+
+// WriteAnchor is where blocks are written in a page, at the end of the page by default
+type WriteAnchor struct {
+	After string `yaml:"after"` // optional, ID of a block in the page to write after
+	Under string `yaml:"under"` // or text of a toggle or heading to write under, a toggle heading is created at the end if missing
+	// or write at the top of the page. Notion only writes after a block, so the first block
+	// is written again below the blocks and deleted: its ID changes, breaking links and
+	// anchors to it, and its comments are lost
+	Top bool `yaml:"top"`
+}
+
+func (w WriteAnchor) IsZero() bool {
+	return w == WriteAnchor{}
+}
+
+func (w WriteAnchor) Validate() error {
+	set := 0
+	for _, ok := range []bool{w.After != "", strings.TrimSpace(w.Under) != "", w.Top} {
+		if ok {
+			set++
+		}
+	}
+	if set > 1 {
+		return fmt.Errorf("invalid anchor: %+v, set only one of after, under or top", w)
+	}
+	return nil
+}
+
+// anchorPosition is where the blocks of an anchor are written
+type anchorPosition struct {
+	ParentID string       // block to write in
+	After    string       // child to write after, empty to write at the end
+	First    notion.Block // first block of the page to move below, when written at the top
+	Created  bool         // the parent is a heading created to write under
+}
+
+// resolveAnchor returns the position to write. At the top of the page, Notion only
+// writes after a block, so the first block is moved below the blocks written.
+func (a *AppendBlock) resolveAnchor(ctx context.Context) (anchorPosition, error) {
+	switch {
+	case a.Anchor.After != "":
+		return anchorPosition{ParentID: a.AppendToPageID, After: a.Anchor.After}, nil
+	case a.Anchor.Top:
+		var resp notion.BlockChildrenResponse
+		err := retry.Do(ctx, func(ctx context.Context) error {
+			var innerErr error
+			resp, innerErr = a.Client.FindBlockChildrenByID(ctx, a.AppendToPageID, &notion.PaginationQuery{PageSize: 1})
+			return innerErr
+		})
+		if err != nil {
+			return anchorPosition{}, err
+		}
+		if len(resp.Results) == 0 { // an empty page
+			return anchorPosition{ParentID: a.AppendToPageID}, nil
+		}
+
+		first := resp.Results[0]
+		if !movableBlock(first) {
+			return anchorPosition{}, fmt.Errorf("write at top: first block %v (%T) can not be moved, use after or under", first.ID(), first)
+		}
+		return anchorPosition{ParentID: a.AppendToPageID, After: first.ID(), First: first}, nil
+	case strings.TrimSpace(a.Anchor.Under) != "":
+		blocks, err := a.QueryBlocks(ctx, a.AppendToPageID)
+		if err != nil {
+			return anchorPosition{}, err
+		}
+		if parentID, after, found := findUnder(blocks, a.Anchor.Under); found {
+			if parentID == "" {
+				parentID = a.AppendToPageID
+			}
+			return anchorPosition{ParentID: parentID, After: after}, nil
+		}
+
+		heading := &notion.Heading2Block{
+			RichText:     []notion.RichText{{Type: notion.RichTextTypeText, Text: &notion.Text{Content: strings.TrimSpace(a.Anchor.Under)}}},
+			IsToggleable: true,
+		}
+		resp, err := a.appendChildren(ctx, a.AppendToPageID, "", []notion.Block{heading})
+		if err != nil {
+			return anchorPosition{}, err
+		}
+		if len(resp.Results) == 0 {
+			return anchorPosition{}, fmt.Errorf("write under %q: no heading created", a.Anchor.Under)
+		}
+		return anchorPosition{ParentID: resp.Results[0].ID(), Created: true}, nil
+	}
+	return anchorPosition{ParentID: a.AppendToPageID}, nil
+}
+
+func (a *AppendBlock) QueryBlocks(ctx context.Context, blockID string) ([]notion.Block, error) {
+	blocks := []notion.Block{}
+	cursor := ""
+	for {
+		query := &notion.PaginationQuery{StartCursor: cursor}
+		var resp notion.BlockChildrenResponse
+		err := retry.Do(ctx, func(ctx context.Context) error {
+			var innerErr error
+			resp, innerErr = a.Client.FindBlockChildrenByID(ctx, blockID, query)
+			return innerErr
+		})
+		if err != nil {
+			return blocks, err
+		}
+
+		blocks = append(blocks, resp.Results...)
+
+		if resp.HasMore {
+			cursor = *resp.NextCursor
+		} else {
+			break
+		}
+	}
+	return blocks, nil
+}
+
+// findUnder finds the toggle or heading of the text in the blocks of a page. Blocks are
+// written in a toggle or a toggle heading as children, else at the end of the heading
+// section, i.e. after the blocks before the next heading of the same or a higher level.
+// It returns an empty parent ID for the page.
+func findUnder(blocks []notion.Block, text string) (string, string, bool) {
+	text = strings.TrimSpace(text)
+	for i, block := range blocks {
+		blockText, level, toggleable := anchorBlock(block)
+		if (level == 0 && !toggleable) || !strings.EqualFold(strings.TrimSpace(blockText), text) {
+			continue
+		}
+		if toggleable {
+			return block.ID(), "", true
+		}
+
+		after := block.ID()
+		for _, next := range blocks[i+1:] {
+			if _, nextLevel, _ := anchorBlock(next); nextLevel > 0 && nextLevel <= level {
+				break
+			}
+			after = next.ID()
+		}
+		return "", after, true
+	}
+	return "", "", false
+}
+
+// anchorBlock returns the text, the heading level (0 for not a heading) and whether
+// the block is a toggle of the blocks to write under
+func anchorBlock(block notion.Block) (string, int, bool) {
+	switch b := block.(type) {
+	case *notion.Heading1Block:
+		return transformer.ConcatRichText(b.RichText), 1, b.IsToggleable
+	case *notion.Heading2Block:
+		return transformer.ConcatRichText(b.RichText), 2, b.IsToggleable
+	case *notion.Heading3Block:
+		return transformer.ConcatRichText(b.RichText), 3, b.IsToggleable
+	case *notion.ToggleBlock:
+		return transformer.ConcatRichText(b.RichText), 0, true
+	}
+	return "", 0, false
+}
+
+// movableBlock reports a block without children that can be written again as is
+func movableBlock(block notion.Block) bool {
+	if block.HasChildren() {
+		return false
+	}
+
+	switch block.(type) {
+	case *notion.ParagraphBlock, *notion.Heading1Block, *notion.Heading2Block, *notion.Heading3Block,
+		*notion.BulletedListItemBlock, *notion.NumberedListItemBlock, *notion.ToDoBlock, *notion.ToggleBlock,
+		*notion.QuoteBlock, *notion.CalloutBlock, *notion.DividerBlock, *notion.CodeBlock, *notion.EquationBlock:
+		return true
+	}
+	return false
+}
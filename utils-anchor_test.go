@@ -0,0 +1,136 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/zhuochun/notion-toolset/notiontest"
+	"github.com/zhuochun/notion-toolset/transformer"
+)
+
+// blockTexts returns the text of the blocks
+func blockTexts(blocks []notion.Block) []string {
+	texts := []string{}
+	for _, block := range blocks {
+		text, _, _ := anchorBlock(block)
+		if p, ok := block.(*notion.ParagraphBlock); ok {
+			text = transformer.ConcatRichText(p.RichText)
+		}
+		texts = append(texts, text)
+	}
+	return texts
+}
+
+func TestAppendBlockAnchor(t *testing.T) {
+	fake := notiontest.New()
+	db := fake.AddDatabase("Journal", nil)
+
+	newPage := func() notion.Page {
+		return fake.AddPage(notiontest.DatabasePage(db.ID, "Today"),
+			notiontest.Paragraph("Intro"),
+			&notion.Heading2Block{RichText: notiontest.RichText("Notes")},
+			notiontest.Paragraph("Note 1"),
+			&notion.Heading3Block{RichText: notiontest.RichText("Sub")},
+			notiontest.Paragraph("Sub 1"),
+			&notion.Heading2Block{RichText: notiontest.RichText("Later")},
+			&notion.ToggleBlock{RichText: notiontest.RichText("Ideas")},
+		)
+	}
+	write := func(page notion.Page, anchor WriteAnchor, texts ...string) {
+		t.Helper()
+
+		w := NewAppendBlock(fake, page.ID)
+		w.Anchor = anchor
+		for _, text := range texts {
+			w.Blocks = append(w.Blocks, notiontest.Paragraph(text))
+		}
+		if _, err := w.Do(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := func(name string, blocks []notion.Block, expected string) {
+		t.Helper()
+		if got := strings.Join(blockTexts(blocks), ","); got != expected {
+			t.Errorf("%v: expect %v, got %v", name, expected, got)
+		}
+	}
+
+	page := newPage()
+	write(page, WriteAnchor{After: fake.Children(page.ID)[0].ID()}, "A", "B")
+	expect("after", fake.Children(page.ID), "Intro,A,B,Notes,Note 1,Sub,Sub 1,Later,Ideas")
+
+	page = newPage()
+	write(page, WriteAnchor{Under: "notes"}, "A")
+	expect("under heading", fake.Children(page.ID), "Intro,Notes,Note 1,Sub,Sub 1,A,Later,Ideas")
+
+	page = newPage()
+	write(page, WriteAnchor{Under: "Ideas"}, "A")
+	write(page, WriteAnchor{Under: "Ideas"}, "B")
+	children := fake.Children(page.ID)
+	expect("under toggle", fake.Children(children[len(children)-1].ID()), "A,B")
+
+	page = newPage()
+	write(page, WriteAnchor{Under: "Flashback"}, "A")
+	write(page, WriteAnchor{Under: "Flashback"}, "B")
+	children = fake.Children(page.ID)
+	expect("under missing", children, "Intro,Notes,Note 1,Sub,Sub 1,Later,Ideas,Flashback")
+	if heading := children[len(children)-1].(*notion.Heading2Block); !heading.IsToggleable {
+		t.Errorf("expect a toggle heading created, got %#v", heading)
+	}
+	expect("under created", fake.Children(children[len(children)-1].ID()), "A,B")
+
+	page = newPage()
+	fake.Fail = func(method, id string) error {
+		if method == "AppendBlockChildren" && id != page.ID { // the blocks in the heading created
+			return &notion.APIError{Status: 400, Code: "validation_error"}
+		}
+		return nil
+	}
+	w := NewAppendBlock(fake, page.ID)
+	w.Anchor = WriteAnchor{Under: "Flashback"}
+	w.Blocks = []notion.Block{notiontest.Paragraph("A")}
+	if _, err := w.Do(t.Context()); err == nil {
+		t.Errorf("expect an error when the blocks are not written")
+	}
+	fake.Fail = nil
+	expect("under failed", fake.Children(page.ID), "Intro,Notes,Note 1,Sub,Sub 1,Later,Ideas")
+
+	page = newPage()
+	write(page, WriteAnchor{Top: true}, "A", "B")
+	expect("top", fake.Children(page.ID), "A,B,Intro,Notes,Note 1,Sub,Sub 1,Later,Ideas")
+
+	page = fake.AddPage(notiontest.DatabasePage(db.ID, "Empty"))
+	write(page, WriteAnchor{Top: true}, "A")
+	expect("top of empty", fake.Children(page.ID), "A")
+
+	page = newPage()
+	firstID := fake.Children(page.ID)[0].ID()
+	fake.Fail = func(method, id string) error {
+		if method == "DeleteBlock" && id == firstID {
+			return &notion.APIError{Status: 403, Code: "restricted_resource"}
+		}
+		return nil
+	}
+	w = NewAppendBlock(fake, page.ID)
+	w.Anchor = WriteAnchor{Top: true}
+	w.Blocks = []notion.Block{notiontest.Paragraph("A")}
+	if _, err := w.Do(t.Context()); err == nil {
+		t.Errorf("expect an error when the first block is not deleted")
+	}
+	fake.Fail = nil
+	expect("top not moved", fake.Children(page.ID), "Intro,A,Notes,Note 1,Sub,Sub 1,Later,Ideas")
+
+	page = fake.AddPage(notiontest.DatabasePage(db.ID, "Nested"),
+		&notion.ToggleBlock{RichText: notiontest.RichText("Nested"), Children: []notion.Block{notiontest.Paragraph("Child")}})
+	w = NewAppendBlock(fake, page.ID)
+	w.Anchor = WriteAnchor{Top: true}
+	w.Blocks = []notion.Block{notiontest.Paragraph("A")}
+	if _, err := w.Do(t.Context()); err == nil {
+		t.Errorf("expect a first block with children not moved")
+	}
+
+	if err := (WriteAnchor{Under: "Notes", Top: true}).Validate(); err == nil {
+		t.Errorf("expect only one anchor")
+	}
+}
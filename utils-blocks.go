@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/dstotijn/go-notion"
+)
+
+// DecodeBlocks decodes a JSON array of blocks rendered by a template, see DecodeBlock
+func DecodeBlocks(data []byte, strict bool) ([]notion.Block, error) {
+	raws := []json.RawMessage{}
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return nil, err
+	}
+
+	blocks := make([]notion.Block, 0, len(raws))
+	for i, raw := range raws {
+		block, err := DecodeBlock(raw, strict)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", i, err)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// DecodeBlock decodes a block rendered by a template into its go-notion type. A block
+// is typed as the API, e.g. {"type": "heading_2", "heading_2": {"rich_text": [...]}},
+// or {"heading_2": {...}} without the type, the only key of an object besides "children",
+// or a paragraph as {"rich_text": [...]}.
+// Nested blocks are in "children" of the content, or of the block. A strict decode
+// fails on unknown fields of the content.
+func DecodeBlock(data []byte, strict bool) (notion.Block, error) {
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	typ := ""
+	if t, found := raw["type"]; found {
+		if err := json.Unmarshal(t, &typ); err != nil {
+			return nil, fmt.Errorf("invalid block type: %s", t)
+		}
+	} else {
+		for k, v := range raw {
+			if k == "children" || !bytes.HasPrefix(bytes.TrimSpace(v), []byte("{")) {
+				continue
+			}
+			if typ != "" {
+				return nil, fmt.Errorf("block without type has %v and %v, set the type", typ, k)
+			}
+			typ = k
+		}
+	}
+	if typ == "" { // a paragraph, as blocks were before types
+		typ = string(notion.BlockTypeParagraph)
+		raw = map[string]json.RawMessage{typ: data}
+	}
+
+	content := map[string]json.RawMessage{}
+	if c := raw[typ]; len(c) > 0 && string(c) != "null" {
+		if err := json.Unmarshal(c, &content); err != nil {
+			return nil, fmt.Errorf("invalid %v block: %w", typ, err)
+		}
+	}
+	children, found := raw["children"]
+	if !found {
+		children = content["children"]
+	}
+	delete(content, "children")
+
+	contentData, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := notion.BlockChildrenResponse{}
+	respData, err := json.Marshal(map[string]interface{}{
+		"results": []interface{}{map[string]interface{}{"type": typ, typ: json.RawMessage(contentData)}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(respData, &resp); err != nil {
+		return nil, err
+	}
+	block := resp.Results[0]
+
+	if strict { // decode again into the block type, go-notion ignores unknown fields
+		dec := json.NewDecoder(bytes.NewReader(contentData))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(reflect.New(reflect.TypeOf(block).Elem()).Interface()); err != nil {
+			return nil, fmt.Errorf("invalid %v block: %w", typ, err)
+		}
+	}
+
+	if len(children) == 0 || string(children) == "null" {
+		return block, nil
+	}
+	nested, err := DecodeBlocks(children, strict)
+	if err != nil {
+		return nil, fmt.Errorf("children of %v block: %w", typ, err)
+	}
+	if err := setChildren(block, nested); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// setChildren sets nested blocks of the blocks that can have children
+func setChildren(block notion.Block, children []notion.Block) error {
+	switch b := block.(type) {
+	case *notion.ParagraphBlock:
+		b.Children = children
+	case *notion.Heading1Block:
+		b.Children = children
+	case *notion.Heading2Block:
+		b.Children = children
+	case *notion.Heading3Block:
+		b.Children = children
+	case *notion.BulletedListItemBlock:
+		b.Children = children
+	case *notion.NumberedListItemBlock:
+		b.Children = children
+	case *notion.ToDoBlock:
+		b.Children = children
+	case *notion.ToggleBlock:
+		b.Children = children
+	case *notion.CalloutBlock:
+		b.Children = children
+	case *notion.QuoteBlock:
+		b.Children = children
+	case *notion.ColumnBlock:
+		b.Children = children
+	case *notion.TableBlock:
+		b.Children = children
+	case *notion.SyncedBlock:
+		b.Children = children
+	case *notion.TemplateBlock:
+		b.Children = children
+	case *notion.ColumnListBlock:
+		for _, child := range children {
+			column, ok := child.(*notion.ColumnBlock)
+			if !ok {
+				return fmt.Errorf("column_list block has a %T child, use column blocks", child)
+			}
+			b.Children = append(b.Children, *column)
+		}
+	default:
+		return fmt.Errorf("%T can not have children", block)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/zhuochun/notion-toolset/notiontest"
+)
+
+func TestDecodeBlocks(t *testing.T) {
+	blocks, err := DecodeBlocks([]byte(`[
+		{"rich_text": [{"text": {"content": "Legacy paragraph"}}]},
+		{"type": "heading_2", "heading_2": {"rich_text": [{"text": {"content": "Key Points"}}]}},
+		{"bulleted_list_item": {"rich_text": [{"text": {"content": "Untyped item"}}]}},
+		{"type": "to_do", "to_do": {"rich_text": [{"text": {"content": "Task"}}], "checked": true}},
+		{"type": "divider"},
+		{"type": "toggle", "toggle": {
+			"rich_text": [{"text": {"content": "More"}}],
+			"children": [{"type": "quote", "quote": {"rich_text": [{"text": {"content": "Nested"}}]}}]
+		}},
+		{"type": "callout", "callout": {"rich_text": []}, "children": [{"type": "divider", "divider": {}}]},
+		{"heading_3": {"rich_text": [], "is_toggleable": true}, "children": [{"type": "divider", "divider": {}}]}
+	]`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(blocks) != 8 {
+		t.Fatalf("expect 8 blocks, got %d", len(blocks))
+	}
+	if p, ok := blocks[0].(*notion.ParagraphBlock); !ok || p.RichText[0].Text.Content != "Legacy paragraph" {
+		t.Errorf("expect paragraph, got %#v", blocks[0])
+	}
+	if _, ok := blocks[1].(*notion.Heading2Block); !ok {
+		t.Errorf("expect heading_2, got %T", blocks[1])
+	}
+	if _, ok := blocks[2].(*notion.BulletedListItemBlock); !ok {
+		t.Errorf("expect bulleted_list_item, got %T", blocks[2])
+	}
+	if todo, ok := blocks[3].(*notion.ToDoBlock); !ok || todo.Checked == nil || !*todo.Checked {
+		t.Errorf("expect checked to_do, got %#v", blocks[3])
+	}
+	if _, ok := blocks[4].(*notion.DividerBlock); !ok {
+		t.Errorf("expect divider, got %T", blocks[4])
+	}
+	if toggle, ok := blocks[5].(*notion.ToggleBlock); !ok || len(toggle.Children) != 1 {
+		t.Errorf("expect toggle with a child, got %#v", blocks[5])
+	} else if _, ok := toggle.Children[0].(*notion.QuoteBlock); !ok {
+		t.Errorf("expect nested quote, got %T", toggle.Children[0])
+	}
+	if callout, ok := blocks[6].(*notion.CalloutBlock); !ok || len(callout.Children) != 1 {
+		t.Errorf("expect callout with a child, got %#v", blocks[6])
+	}
+	if heading, ok := blocks[7].(*notion.Heading3Block); !ok || len(heading.Children) != 1 {
+		t.Errorf("expect untyped heading_3 with a child, got %#v", blocks[7])
+	}
+
+	for _, invalid := range []string{
+		`[{"type": "unknown_type", "unknown_type": {}}]`,
+		`[{"type": "divider", "divider": {}, "children": [{"type": "divider"}]}]`,
+		`[{"type": "column_list", "column_list": {}, "children": [{"type": "divider"}]}]`,
+		`[{"heading_2": {"rich_text": []}, "quote": {"rich_text": []}}]`,
+	} {
+		if _, err := DecodeBlocks([]byte(invalid), false); err == nil {
+			t.Errorf("expect error for %v", invalid)
+		}
+	}
+
+	typo := `{"type": "heading_2", "heading_2": {"rich_txt": []}}`
+	if _, err := DecodeBlock([]byte(typo), false); err != nil {
+		t.Errorf("expect unknown fields ignored, got %v", err)
+	}
+	if _, err := DecodeBlock([]byte(typo), true); err == nil || !strings.Contains(err.Error(), "rich_txt") {
+		t.Errorf("expect unknown field in strict mode, got %v", err)
+	}
+}
+
+func TestAppendNestedBlocks(t *testing.T) {
+	fake := notiontest.New()
+	page := fake.AddPage(notiontest.DatabasePage(fake.AddDatabase("Notes", nil).ID, "Summary"))
+
+	w := NewAppendBlock(fake, page.ID)
+	tmpl := `[
+		{"type": "heading_2", "heading_2": {"rich_text": [{"text": {"content": "Key Points"}}]}}
+		{{range .KeyPoints}}
+		,{"type": "bulleted_list_item", "bulleted_list_item": {
+			"rich_text": [{"text": {"content": "{{.}}"}}],
+			"children": [{"type": "paragraph", "paragraph": {"rich_text": [{"text": {"content": "Detail"}}]}}]
+		}}
+		{{end}}
+	]`
+	if err := w.AddBlocks("test", tmpl, map[string]interface{}{"KeyPoints": []string{`Say "hi"`, "Tom & Jerry"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Do(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := fake.Children(page.ID)
+	if len(blocks) != 3 {
+		t.Fatalf("expect 3 blocks, got %d", len(blocks))
+	}
+	item, ok := blocks[2].(*notion.BulletedListItemBlock)
+	if !ok || item.RichText[0].PlainText != "Tom & Jerry" || !item.HasChildren() {
+		t.Fatalf("expect list item with children, got %#v", blocks[2])
+	}
+	if nested := fake.Children(item.ID()); len(nested) != 1 {
+		t.Errorf("expect a nested paragraph, got %d blocks", len(nested))
+	}
+}
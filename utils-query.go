@@ -4,10 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"iter"
+	"sync"
+	"time"
 
 	"github.com/dstotijn/go-notion"
+	"github.com/zhuochun/notion-toolset/filter"
 	"github.com/zhuochun/notion-toolset/retry"
-	"golang.org/x/time/rate"
 )
 
 type QueryBuilder struct {
@@ -17,13 +20,15 @@ type QueryBuilder struct {
 }
 
 type DatabaseQuery struct {
-	Client     *notion.Client
+	Client     NotionAPI
 	DatabaseID string
+	Clock      Clock // relative dates of the filter are from its now
+	MaxResults int   // optional, stop after the number of pages, 0 for all pages, page_size of a template
 
-	Query *notion.DatabaseQuery
+	Query *notion.DatabaseQuery // Query.PageSize is the pages per request
 }
 
-func NewDatabaseQuery(c *notion.Client, databaseID string) *DatabaseQuery {
+func NewDatabaseQuery(c NotionAPI, databaseID string) *DatabaseQuery {
 	return &DatabaseQuery{
 		Client:     c,
 		DatabaseID: databaseID,
@@ -31,75 +36,170 @@ func NewDatabaseQuery(c *notion.Client, databaseID string) *DatabaseQuery {
 	}
 }
 
-func (q *DatabaseQuery) SetQuery(queryTmpl string, builder QueryBuilder) error {
-	if queryTmpl == "" {
+// QuerySpec selects pages of a database, by a JSON template or a filter expression
+type QuerySpec struct {
+	Template string // JSON template of notion.DatabaseQuery, e.g. databaseQuery in configs
+	Filter   string // or a filter expression, e.g. `Status != Done and "Edited At" after -7d`
+	Sort     string // sorts of the filter expression, e.g. `-"Created At", Title`
+}
+
+// SetQuery sets the query from the JSON template, or compiles the filter and sort
+// expressions by the database schema. Both are rendered with the builder first.
+func (q *DatabaseQuery) SetQuery(ctx context.Context, spec QuerySpec, builder QueryBuilder) error {
+	if spec.Template != "" && (spec.Filter != "" || spec.Sort != "") {
+		return fmt.Errorf("set either databaseQuery or filter and sort")
+	}
+
+	if spec.Template != "" {
+		queryData, err := Tmpl("DatabaseQuery", spec.Template, builder, q.Clock)
+		if err != nil {
+			return err
+		}
+
+		if err := json.Unmarshal(queryData, q.Query); err != nil {
+			return fmt.Errorf("unmarshal DatabaseQuery: %w", err)
+		}
+		// page_size of a template was the first page only, before queries followed cursors
+		if q.Query.PageSize > 0 && q.Query.StartCursor == "" && q.MaxResults == 0 {
+			q.MaxResults = q.Query.PageSize
+		}
+		return nil
+	}
+
+	if spec.Filter == "" && spec.Sort == "" {
 		return nil
 	}
 
-	queryData, err := Tmpl("DatabaseQuery", queryTmpl, builder)
+	schema, err := databaseSchemas.Get(ctx, q.Client, q.DatabaseID)
 	if err != nil {
-		return err
+		return fmt.Errorf("find database schema: %w", err)
 	}
 
-	if err := json.Unmarshal(queryData, q.Query); err != nil {
-		return fmt.Errorf("unmarshal DatabaseQuery: %w", err)
+	if spec.Filter != "" {
+		expr, err := TmplText("Filter", spec.Filter, builder, q.Clock)
+		if err != nil {
+			return err
+		}
+		if q.Query.Filter, err = filter.Compile(expr, schema, q.Clock.Now()); err != nil {
+			return fmt.Errorf("filter: %w", err)
+		}
 	}
 
+	if spec.Sort != "" {
+		if q.Query.Sorts, err = filter.CompileSorts(spec.Sort, schema); err != nil {
+			return fmt.Errorf("sort: %w", err)
+		}
+	}
 	return nil
 }
 
-func (q *DatabaseQuery) Go(ctx context.Context, size int, rateLimiter ...*rate.Limiter) (chan []notion.Page, chan error) {
-	pagesChan := make(chan []notion.Page, size)
-	errChan := make(chan error, 1)
-
-	go func() {
-		cursor := ""
-
-		for {
-			if len(rateLimiter) == 1 {
-				rateLimiter[0].Wait(context.Background())
-			}
-
-			q.Query.StartCursor = cursor
-			var resp notion.DatabaseQueryResponse
-			err := retry.Do(func() error {
-				var innerErr error
-				resp, innerErr = q.Client.QueryDatabase(ctx, q.DatabaseID, q.Query)
-				return innerErr
-			})
-			if err != nil {
-				errChan <- err
-				break
-			}
-
-			pagesChan <- resp.Results
-
-			if q.Query.PageSize > 0 { // hack detection to exit
-				break
-			}
-
-			if resp.HasMore {
-				cursor = *resp.NextCursor
-			} else {
-				break
-			}
-		}
+// databaseSchemas caches the properties of databases for filters, a schema is
+// fetched once in a run, and again by later runs of a daemon
+var databaseSchemas = &schemaCache{ttl: 10 * time.Minute}
 
-		close(pagesChan)
-	}()
+type schemaCache struct {
+	ttl time.Duration
 
-	return pagesChan, errChan
+	mu      sync.Mutex
+	schemas map[schemaKey]cachedSchema
 }
 
-func (q *DatabaseQuery) Once(ctx context.Context) ([]notion.Page, error) {
-	var resp notion.DatabaseQueryResponse
-	err := retry.Do(func() error {
+type schemaKey struct {
+	client     NotionAPI
+	databaseID string
+}
+
+type cachedSchema struct {
+	props     notion.DatabaseProperties
+	fetchedAt time.Time
+}
+
+func (c *schemaCache) Get(ctx context.Context, client NotionAPI, databaseID string) (notion.DatabaseProperties, error) {
+	key := schemaKey{client, databaseID}
+
+	c.mu.Lock()
+	cached, found := c.schemas[key]
+	c.mu.Unlock()
+	if found && time.Since(cached.fetchedAt) < c.ttl {
+		return cached.props, nil
+	}
+
+	var db notion.Database
+	err := retry.Do(ctx, func(ctx context.Context) error {
 		var innerErr error
-		resp, innerErr = q.Client.QueryDatabase(ctx, q.DatabaseID, q.Query)
+		db, innerErr = client.FindDatabaseByID(ctx, databaseID)
 		return innerErr
 	})
 	if err != nil {
-		return []notion.Page{}, err
+		return nil, err
 	}
-	return resp.Results, nil
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.schemas == nil {
+		c.schemas = map[schemaKey]cachedSchema{}
+	}
+	c.schemas[key] = cachedSchema{props: db.Properties, fetchedAt: time.Now()}
+	return db.Properties, nil
+}
+
+// maxPageSize is the most pages Notion returns in a response
+const maxPageSize = 100
+
+// Batches queries the pages response by response following the cursors, until all
+// pages or MaxResults pages are queried, or yield returns false
+func (q *DatabaseQuery) Batches(ctx context.Context, yield func([]notion.Page) bool) error {
+	query := *q.Query // the cursor and page size change by request
+	pageSize := q.Query.PageSize
+	if pageSize == 0 {
+		pageSize = maxPageSize
+	}
+
+	count := 0
+	for {
+		if q.MaxResults > 0 {
+			query.PageSize = min(pageSize, q.MaxResults-count)
+		}
+
+		var resp notion.DatabaseQueryResponse
+		err := retry.Do(ctx, func(ctx context.Context) error {
+			var innerErr error
+			resp, innerErr = q.Client.QueryDatabase(ctx, q.DatabaseID, &query)
+			return innerErr
+		})
+		if err != nil {
+			return err
+		}
+
+		results := resp.Results
+		if q.MaxResults > 0 && len(results) > q.MaxResults-count {
+			results = results[:q.MaxResults-count]
+		}
+		count += len(results)
+
+		if !yield(results) {
+			return nil
+		}
+		if !resp.HasMore || resp.NextCursor == nil || (q.MaxResults > 0 && count >= q.MaxResults) {
+			return nil
+		}
+		query.StartCursor = *resp.NextCursor
+	}
+}
+
+// All iterates the pages, or up to MaxResults pages, the loop can break early to
+// stop querying. An error is the last item.
+func (q *DatabaseQuery) All(ctx context.Context) iter.Seq2[notion.Page, error] {
+	return AllPages(ctx, q)
+}
+
+// Go queries the pages, or up to MaxResults pages, in the background. Batches of
+// pages are sent to the channel, which is closed after an error is sent, if any.
+func (q *DatabaseQuery) Go(ctx context.Context, size int) (chan []notion.Page, chan error) {
+	return GoPages(ctx, q, size)
+}
+
+// Once queries all pages, or up to MaxResults pages, following the cursors
+func (q *DatabaseQuery) Once(ctx context.Context) ([]notion.Page, error) {
+	return OncePages(ctx, q)
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/zhuochun/notion-toolset/notiontest"
+)
+
+func TestDatabaseQueryFilter(t *testing.T) {
+	fake := notiontest.New()
+	db := fake.AddDatabase("Notes", notion.DatabaseProperties{
+		"Points": {Type: notion.DBPropTypeNumber},
+	})
+
+	for i, title := range []string{"a", "b", "c"} {
+		page := notiontest.DatabasePage(db.ID, title)
+		points := float64(i)
+		page.Properties.(notion.DatabasePageProperties)["Points"] = notion.DatabasePageProperty{Type: notion.DBPropTypeNumber, Number: &points}
+		fake.AddPage(page)
+	}
+
+	q := NewDatabaseQuery(fake, db.ID)
+	spec := QuerySpec{Filter: `Points < 2 and Name != {{.Title}}`, Sort: `-Points`}
+	if err := q.SetQuery(t.Context(), spec, QueryBuilder{Title: "a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	pages, err := q.Once(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 {
+		t.Fatalf("expect page b only, got %d pages", len(pages))
+	}
+
+	q = NewDatabaseQuery(fake, db.ID)
+	if err := q.SetQuery(t.Context(), QuerySpec{Filter: `Tags contains a`}, QueryBuilder{}); err == nil || !strings.Contains(err.Error(), `unknown property "Tags"`) {
+		t.Errorf("expect unknown property error, got %v", err)
+	}
+
+	q = NewDatabaseQuery(fake, db.ID)
+	if err := q.SetQuery(t.Context(), QuerySpec{Template: `{}`, Filter: `Points > 1`}, QueryBuilder{}); err == nil {
+		t.Errorf("expect error setting both databaseQuery and filter")
+	}
+
+	finds := 0
+	for _, call := range fake.Calls() {
+		if strings.HasPrefix(call, "FindDatabaseByID") {
+			finds += 1
+		}
+	}
+	if finds != 1 {
+		t.Errorf("expect schema fetched once, got %d", finds)
+	}
+}
+
+func TestDatabaseQueryPagination(t *testing.T) {
+	fake := notiontest.New()
+	fake.PageSize = 2
+	db := fake.AddDatabase("Notes", nil)
+	for _, title := range []string{"a", "b", "c", "d", "e"} {
+		fake.AddPage(notiontest.DatabasePage(db.ID, title))
+	}
+
+	countQueries := func() int {
+		n := 0
+		for _, call := range fake.Calls() {
+			if strings.HasPrefix(call, "QueryDatabase") {
+				n++
+			}
+		}
+		return n
+	}
+
+	pages, err := NewDatabaseQuery(fake, db.ID).Once(t.Context())
+	if err != nil || len(pages) != 5 {
+		t.Fatalf("expect Once to query all 5 pages, got %d, err %v", len(pages), err)
+	}
+	if n := countQueries(); n != 3 {
+		t.Errorf("expect 3 queries, got %d", n)
+	}
+
+	q := NewDatabaseQuery(fake, db.ID)
+	q.MaxResults = 3
+	pagesChan, errChan := q.Go(t.Context(), 1)
+	got := 0
+	for pages := range pagesChan {
+		got += len(pages)
+	}
+	if got != 3 || len(errChan) != 0 {
+		t.Errorf("expect 3 pages by MaxResults, got %d", got)
+	}
+
+	before := countQueries()
+	got = 0
+	for page, err := range NewDatabaseQuery(fake, db.ID).All(t.Context()) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.ID != "" {
+			got++
+		}
+		break
+	}
+	if n := countQueries() - before; got != 1 || n != 1 {
+		t.Errorf("expect break to stop after 1 query, got %d pages, %d queries", got, n)
+	}
+
+	q = NewDatabaseQuery(fake, db.ID)
+	if err := q.SetQuery(t.Context(), QuerySpec{Template: `{"page_size": 2}`}, QueryBuilder{}); err != nil {
+		t.Fatal(err)
+	}
+	if pages, err := q.Once(t.Context()); err != nil || len(pages) != 2 {
+		t.Errorf("expect page_size of a template to limit the pages, got %d, err %v", len(pages), err)
+	}
+
+	fake.Fail = func(method, id string) error {
+		return &notion.APIError{Status: 400, Code: "validation_error", Message: "invalid filter"}
+	}
+	for _, err := range NewDatabaseQuery(fake, db.ID).All(t.Context()) {
+		if err == nil || !strings.Contains(err.Error(), "invalid filter") {
+			t.Errorf("expect the error as the last item, got %v", err)
+		}
+	}
+}
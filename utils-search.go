@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/zhuochun/notion-toolset/filter"
+	"github.com/zhuochun/notion-toolset/retry"
+)
+
+// SearchSpec selects pages by the workspace search instead of a database, so pages
+// across databases and standalone pages are included
+type SearchSpec struct {
+	Query       string `yaml:"query"`       // optional, matches titles, empty for all pages shared with the integration
+	Object      string `yaml:"object"`      // optional, page (default), or database for pages of the databases found
+	Sort        string `yaml:"sort"`        // optional, by last edited time, descending (default) or ascending
+	EditedAfter string `yaml:"editedAfter"` // optional, e.g. -7d, {{.Date}} or 2024-01-02
+}
+
+type SearchQuery struct {
+	Client     NotionAPI
+	Clock      Clock // relative dates of editedAfter are from its now
+	MaxResults int   // optional, stop after the number of pages, 0 for all pages
+
+	Opts        *notion.SearchOpts
+	EditedAfter time.Time // optional, skip pages edited before
+}
+
+func NewSearchQuery(c NotionAPI) *SearchQuery {
+	return &SearchQuery{
+		Client: c,
+		Opts: &notion.SearchOpts{
+			Filter: &notion.SearchFilter{Property: "object", Value: "page"},
+			Sort:   &notion.SearchSort{Direction: notion.SortDirDesc, Timestamp: notion.SearchSortTimestampLastEditedTime},
+		},
+	}
+}
+
+// SetSearch sets the search options from the spec, the query and editedAfter are
+// rendered with the builder first
+func (q *SearchQuery) SetSearch(spec SearchSpec, builder QueryBuilder) error {
+	query, err := TmplText("Search", spec.Query, builder, q.Clock)
+	if err != nil {
+		return err
+	}
+	q.Opts.Query = query
+
+	switch spec.Object {
+	case "", "page":
+		q.Opts.Filter.Value = "page"
+	case "database":
+		q.Opts.Filter.Value = "database"
+	default:
+		return fmt.Errorf("invalid search object: %v, use page or database", spec.Object)
+	}
+
+	switch spec.Sort {
+	case "", "descending":
+		q.Opts.Sort.Direction = notion.SortDirDesc
+	case "ascending":
+		q.Opts.Sort.Direction = notion.SortDirAsc
+	default:
+		return fmt.Errorf("invalid search sort: %v, use descending or ascending", spec.Sort)
+	}
+
+	editedAfter, err := TmplText("Search EditedAfter", spec.EditedAfter, builder, q.Clock)
+	if err != nil {
+		return err
+	}
+	if editedAfter != "" { // {{.Date}} is empty without lookbackDays
+		if q.EditedAfter, err = filter.ParseDate(editedAfter, q.Clock.Now()); err != nil {
+			return fmt.Errorf("search editedAfter: %w", err)
+		}
+	}
+	return nil
+}
+
+// Batches searches the pages response by response, a database found is expanded
+// to its pages, until all pages or MaxResults pages are found, or yield returns false
+func (q *SearchQuery) Batches(ctx context.Context, yield func([]notion.Page) bool) error {
+	opts := *q.Opts // the cursor changes by request
+	if q.MaxResults > 0 && opts.Filter.Value == "page" {
+		opts.PageSize = min(maxPageSize, q.MaxResults)
+	}
+
+	e := newPageEmitter(yield, q.MaxResults)
+
+	for {
+		var resp notion.SearchResponse
+		err := retry.Do(ctx, func(ctx context.Context) error {
+			var innerErr error
+			resp, innerErr = q.Client.Search(ctx, &opts)
+			return innerErr
+		})
+		if err != nil {
+			return err
+		}
+
+		pages, older := []notion.Page{}, false
+		for _, result := range resp.Results {
+			switch r := result.(type) {
+			case notion.Page:
+				if r.LastEditedTime.Before(q.EditedAfter) {
+					older = opts.Sort.Direction == notion.SortDirDesc // the rest are older
+					continue
+				}
+				pages = append(pages, r)
+			case notion.Database:
+				if err := q.databasePages(ctx, r.ID, e.Emit); err != nil || e.Done() {
+					return err
+				}
+			}
+		}
+
+		if !e.Emit(pages) || older || !resp.HasMore || resp.NextCursor == nil {
+			return nil
+		}
+		opts.StartCursor = *resp.NextCursor
+	}
+}
+
+// databasePages queries pages of a database found, edited after EditedAfter
+func (q *SearchQuery) databasePages(ctx context.Context, databaseID string, emit func([]notion.Page) bool) error {
+	dq := NewDatabaseQuery(q.Client, databaseID)
+	if !q.EditedAfter.IsZero() {
+		dq.Query.Filter = &notion.DatabaseQueryFilter{
+			Timestamp: notion.TimestampLastEditedTime,
+			DatabaseQueryPropertyFilter: notion.DatabaseQueryPropertyFilter{
+				LastEditedTime: &notion.DatePropertyFilter{OnOrAfter: &q.EditedAfter},
+			},
+		}
+	}
+	return dq.Batches(ctx, emit)
+}
+
+// All iterates the pages found, or up to MaxResults pages, the loop can break early
+// to stop searching. An error is the last item.
+func (q *SearchQuery) All(ctx context.Context) iter.Seq2[notion.Page, error] {
+	return AllPages(ctx, q)
+}
+
+// Go searches the pages, or up to MaxResults pages, in the background, like DatabaseQuery.Go
+func (q *SearchQuery) Go(ctx context.Context, size int) (chan []notion.Page, chan error) {
+	return GoPages(ctx, q, size)
+}
+
+// Once searches all pages, or up to MaxResults pages, following the cursors
+func (q *SearchQuery) Once(ctx context.Context) ([]notion.Page, error) {
+	return OncePages(ctx, q)
+}
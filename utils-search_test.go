@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhuochun/notion-toolset/notiontest"
+	"github.com/zhuochun/notion-toolset/transformer"
+)
+
+func addEditedPage(fake *notiontest.Fake, databaseID, title string, edited time.Time) {
+	page := notiontest.DatabasePage(databaseID, title)
+	page.CreatedTime, page.LastEditedTime = edited, edited
+	fake.AddPage(page)
+}
+
+func searchTitles(t *testing.T, q *SearchQuery) []string {
+	t.Helper()
+
+	titles := []string{}
+	for page, err := range q.All(t.Context()) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		title, _ := transformer.GetPageTitle(page)
+		titles = append(titles, title)
+	}
+	return titles
+}
+
+func TestSearchQuery(t *testing.T) {
+	fake := notiontest.New()
+	fake.PageSize = 1
+	notes := fake.AddDatabase("Notes", nil)
+	ideas := fake.AddDatabase("Ideas", nil)
+
+	now := time.Now()
+	addEditedPage(fake, notes.ID, "Weekly plan", now.AddDate(0, 0, -1))
+	addEditedPage(fake, notes.ID, "Old plan", now.AddDate(0, 0, -30))
+	addEditedPage(fake, notes.ID, "Older plan", now.AddDate(0, 0, -60))
+	addEditedPage(fake, ideas.ID, "Plan idea", now.AddDate(0, 0, -2))
+	addEditedPage(fake, ideas.ID, "Other", now)
+
+	q := NewSearchQuery(fake)
+	if err := q.SetSearch(SearchSpec{Query: "{{.Title}}", EditedAfter: "-7d"}, QueryBuilder{Title: "plan"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(searchTitles(t, q), ", "); got != "Weekly plan, Plan idea" {
+		t.Errorf("expect pages edited in 7 days, latest first, got %v", got)
+	}
+	searches := 0
+	for _, call := range fake.Calls() {
+		if strings.HasPrefix(call, "Search") {
+			searches++
+		}
+	}
+	if searches != 3 {
+		t.Errorf("expect the search stops at the first older page, got %d searches", searches)
+	}
+
+	q = NewSearchQuery(fake)
+	q.MaxResults = 1
+	if err := q.SetSearch(SearchSpec{Query: "plan", Sort: "ascending"}, QueryBuilder{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(searchTitles(t, q), ", "); got != "Older plan" {
+		t.Errorf("expect the earliest edited page only, got %v", got)
+	}
+
+	q = NewSearchQuery(fake)
+	if err := q.SetSearch(SearchSpec{Query: "ideas", Object: "database", EditedAfter: "-7d"}, QueryBuilder{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := searchTitles(t, q); len(got) != 2 {
+		t.Errorf("expect pages of the Ideas database, got %v", got)
+	}
+
+	if err := NewSearchQuery(fake).SetSearch(SearchSpec{Object: "block"}, QueryBuilder{}); err == nil || !strings.Contains(err.Error(), "invalid search object") {
+		t.Errorf("expect invalid object error, got %v", err)
+	}
+	if err := NewSearchQuery(fake).SetSearch(SearchSpec{EditedAfter: "last week"}, QueryBuilder{}); err == nil {
+		t.Errorf("expect invalid editedAfter error")
+	}
+}
+
+func TestExporterSearch(t *testing.T) {
+	fake := notiontest.New()
+	notes := fake.AddDatabase("Notes", nil)
+	ideas := fake.AddDatabase("Ideas", nil)
+	addEditedPage(fake, notes.ID, "Project note", time.Now())
+	addEditedPage(fake, ideas.ID, "Project idea", time.Now())
+	addEditedPage(fake, ideas.ID, "Unrelated", time.Now())
+
+	cfg := readTestConfig(t, "export.yaml")
+	cfg.Exporter.DatabaseID = ""
+	cfg.Exporter.Search = &SearchSpec{Query: "project"}
+	cfg.Exporter.Directory = t.TempDir()
+
+	_, report := runTestCmd(t, "export", fake, cfg)
+
+	if report.Scanned != 2 || report.Written != 2 || report.Failed != 0 {
+		t.Errorf("expect pages of both databases exported, got %v", report)
+	}
+}
@@ -3,11 +3,15 @@ package main
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"html/template"
+	"os"
+	"path/filepath"
+	texttemplate "text/template"
+	"text/template/parse"
 
 	"github.com/dstotijn/go-notion"
+	"github.com/zhuochun/notion-toolset/retry"
+	"github.com/zhuochun/notion-toolset/transformer"
 )
 
 type PageBuilder struct {
@@ -17,11 +21,22 @@ type PageBuilder struct {
 	DatabaseID string
 }
 
-func Tmpl(name, s string, builder interface{}) ([]byte, error) {
-	tmpl, err := template.New(name).Parse(s)
+// Tmpl renders a JSON template, every value printed is escaped to be inside a JSON
+// string, e.g. "{{.Title}}" of a title with quotes, except JSON from json, mention and link.
+// Date functions are in the timezone of the clock.
+func Tmpl(name, s string, builder interface{}, clock Clock) ([]byte, error) {
+	funcs := tmplFuncs(clock)
+	funcs[tmplEscapeFunc] = tmplEscapeJSON
+
+	tmpl, err := texttemplate.New(name).Funcs(funcs).Parse(s)
 	if err != nil {
 		return nil, fmt.Errorf("template %s parse: %w", name, err)
 	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			escapeTmplNode(t.Tree, t.Tree.Root)
+		}
+	}
 
 	var raw bytes.Buffer
 	if err = tmpl.Execute(&raw, builder); err != nil {
@@ -31,6 +46,50 @@ func Tmpl(name, s string, builder interface{}) ([]byte, error) {
 	return raw.Bytes(), nil
 }
 
+// escapeTmplNode appends the escape func to the pipelines printing values, like
+// html/template does for HTML
+func escapeTmplNode(tree *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			escapeTmplNode(tree, child)
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) > 0 { // {{$x := ...}} prints nothing
+			return
+		}
+		escape := parse.NewIdentifier(tmplEscapeFunc).SetTree(tree).SetPos(n.Pos)
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{NodeType: parse.NodeCommand, Pos: n.Pos, Args: []parse.Node{escape}})
+	case *parse.IfNode:
+		escapeTmplNode(tree, n.List)
+		escapeTmplNode(tree, n.ElseList)
+	case *parse.RangeNode:
+		escapeTmplNode(tree, n.List)
+		escapeTmplNode(tree, n.ElseList)
+	case *parse.WithNode:
+		escapeTmplNode(tree, n.List)
+		escapeTmplNode(tree, n.ElseList)
+	}
+}
+
+// TmplText renders a template that is not JSON as is, e.g. a filter expression
+func TmplText(name, s string, builder interface{}, clock Clock) (string, error) {
+	tmpl, err := texttemplate.New(name).Funcs(tmplFuncs(clock)).Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("template %s parse: %w", name, err)
+	}
+
+	var raw bytes.Buffer
+	if err = tmpl.Execute(&raw, builder); err != nil {
+		return "", fmt.Errorf("template %s execute: %w", name, err)
+	}
+
+	return raw.String(), nil
+}
+
 type BlockBuilder struct {
 	Date    string
 	Content string
@@ -38,19 +97,23 @@ type BlockBuilder struct {
 }
 
 type AppendBlock struct {
-	Client         *notion.Client
+	Client         NotionAPI
 	AppendToPageID string
+	Clock          Clock       // timezone of the templates
+	Anchor         WriteAnchor // optional, where in the page to write
 
 	Blocks []notion.Block
 }
 
-func NewAppendBlock(c *notion.Client, appendTo string) *AppendBlock {
+func NewAppendBlock(c NotionAPI, appendTo string) *AppendBlock {
 	return &AppendBlock{
 		Client:         c,
 		AppendToPageID: appendTo,
 	}
 }
 
+// AddParagraph adds the block rendered, a paragraph as {"rich_text": [...]} or a typed
+// block, see DecodeBlock
 // https://pkg.go.dev/github.com/dstotijn/go-notion#ParagraphBlock
 // https://pkg.go.dev/github.com/dstotijn/go-notion#RichText
 func (a *AppendBlock) AddParagraph(name, s string, builder interface{}) error {
@@ -58,13 +121,13 @@ func (a *AppendBlock) AddParagraph(name, s string, builder interface{}) error {
 		return fmt.Errorf("empty block text: %s", name)
 	}
 
-	rawBlock, err := Tmpl(name, s, builder)
+	rawBlock, err := Tmpl(name, s, builder, a.Clock)
 	if err != nil {
 		return err
 	}
 
-	block := &notion.ParagraphBlock{}
-	if err := json.Unmarshal(rawBlock, block); err != nil {
+	block, err := DecodeBlock(rawBlock, false)
+	if err != nil {
 		return fmt.Errorf("unmarshal block: %w", err)
 	}
 
@@ -72,44 +135,140 @@ func (a *AppendBlock) AddParagraph(name, s string, builder interface{}) error {
 	return nil
 }
 
+// AddBlocks adds the array of blocks rendered, typed blocks with nested children
+// https://developers.notion.com/reference/block
 func (a *AppendBlock) AddBlocks(name, s string, builder interface{}) error {
 	if s == "" {
 		return fmt.Errorf("empty block text: %s", name)
 	}
 
-	rawBlocks, err := Tmpl(name, s, builder)
+	rawBlocks, err := Tmpl(name, s, builder, a.Clock)
 	if err != nil {
 		return err
 	}
 
-	blocks := []notion.ParagraphBlock{}
-	if err := json.Unmarshal(rawBlocks, &blocks); err != nil {
+	blocks, err := DecodeBlocks(rawBlocks, false)
+	if err != nil {
 		return fmt.Errorf("unmarshal blocks: %w", err)
 	}
 
-	for _, b := range blocks {
-		a.Blocks = append(a.Blocks, b)
-	}
+	a.Blocks = append(a.Blocks, blocks...)
 	return nil
 }
 
+// AddMarkdown adds the blocks of the markdown, e.g. a LLM response, see
+// transformer.ParseMarkdown. Lists nested deeper than the 2 levels Notion creates in
+// a request are flattened.
+func (a *AppendBlock) AddMarkdown(markdown string) {
+	a.Blocks = append(a.Blocks, transformer.ParseMarkdown(markdown)...)
+}
+
+// Do writes the blocks at the anchor of the page, in batches of 100 blocks
 func (a *AppendBlock) Do(ctx context.Context) (notion.BlockChildrenResponse, error) {
 	var finalResp notion.BlockChildrenResponse
-	var batchedBlocks []notion.Block
-
-	for i, block := range a.Blocks {
-		batchedBlocks = append(batchedBlocks, block)
-		if len(batchedBlocks) == 100 || (i == len(a.Blocks)-1 && len(batchedBlocks) > 0) {
-			resp, err := a.Client.AppendBlockChildren(ctx, a.AppendToPageID, batchedBlocks)
-			if err != nil {
-				return notion.BlockChildrenResponse{}, err
+	if len(a.Blocks) == 0 {
+		return finalResp, nil
+	}
+
+	pos, err := a.resolveAnchor(ctx)
+	if err != nil {
+		return finalResp, err
+	}
+	parentID, after, first := pos.ParentID, pos.After, pos.First
+
+	blocks := a.Blocks
+	if first != nil { // move the first block of the page below
+		blocks = append(append([]notion.Block{}, a.Blocks...), first)
+	}
+
+	for start := 0; start < len(blocks); start += 100 {
+		batchedBlocks := blocks[start:min(start+100, len(blocks))]
+		resp, err := a.appendChildren(ctx, parentID, after, batchedBlocks)
+		if err != nil {
+			if pos.Created && start == 0 { // remove the heading created, nothing is written in it
+				if delErr := a.deleteBlock(context.WithoutCancel(ctx), parentID); delErr != nil {
+					return notion.BlockChildrenResponse{}, fmt.Errorf("%w, remove heading %v: %v", err, parentID, delErr)
+				}
+			}
+			return notion.BlockChildrenResponse{}, err
+		}
+		if after != "" && len(resp.Results) > 0 { // next batch after this batch
+			after = resp.Results[len(resp.Results)-1].ID()
+		}
+		finalResp.Results = append(finalResp.Results, resp.Results...)
+		finalResp.HasMore = resp.HasMore
+		finalResp.NextCursor = resp.NextCursor
+	}
+
+	if first != nil {
+		// a cancelled run still completes the move, else the first block is left twice
+		ctx := context.WithoutCancel(ctx)
+		if err := a.deleteBlock(ctx, first.ID()); err != nil {
+			// remove the copy instead, the blocks are left after the first block
+			if n := len(finalResp.Results); n > 0 {
+				if copyErr := a.deleteBlock(ctx, finalResp.Results[n-1].ID()); copyErr != nil {
+					return finalResp, fmt.Errorf("move first block %v: %w, remove its copy: %v", first.ID(), err, copyErr)
+				}
+				finalResp.Results = finalResp.Results[:n-1]
 			}
-			finalResp.Results = append(finalResp.Results, resp.Results...)
-			finalResp.HasMore = resp.HasMore
-			finalResp.NextCursor = resp.NextCursor
-			batchedBlocks = nil
+			return finalResp, fmt.Errorf("move first block %v: %w", first.ID(), err)
 		}
 	}
 
 	return finalResp, nil
 }
+
+func (a *AppendBlock) deleteBlock(ctx context.Context, blockID string) error {
+	return retry.Write.Do(ctx, func(ctx context.Context) error {
+		_, innerErr := a.Client.DeleteBlock(ctx, blockID)
+		return innerErr
+	})
+}
+
+func (a *AppendBlock) appendChildren(ctx context.Context, blockID, after string, blocks []notion.Block) (notion.BlockChildrenResponse, error) {
+	var resp notion.BlockChildrenResponse
+	err := retry.Write.Do(ctx, func(ctx context.Context) error {
+		var innerErr error
+		if after == "" {
+			resp, innerErr = a.Client.AppendBlockChildren(ctx, blockID, blocks)
+		} else {
+			resp, innerErr = a.Client.AppendBlockChildrenAfter(ctx, blockID, after, blocks)
+		}
+		return innerErr
+	})
+	return resp, err
+}
+
+// writeFileAtomic writes to a temp file next to path, then renames it to path,
+// so an interrupted or failed write never leaves a partial file
+func writeFileAtomic(path string, write func(file *os.File) error) (err error) {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+
+	if err = write(file); err != nil {
+		return err
+	}
+	if err = file.Chmod(0644); err != nil {
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// writeFileAtomicBytes writes data to path with writeFileAtomic
+func writeFileAtomicBytes(path string, data []byte) error {
+	return writeFileAtomic(path, func(file *os.File) error {
+		_, err := file.Write(data)
+		return err
+	})
+}
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/go-yaml/yaml"
+	"github.com/zhuochun/notion-toolset/filter"
+)
+
+type ConfigValidator struct {
+	DebugMode  bool
+	ConfigPath string
+	MultiMode  bool
+
+	lines []string
+}
+
+func init() {
+	RegisterCmd(CmdSpec{
+		Name:        "validate-config",
+		Description: "Check every template and query in a config offline, without calling Notion",
+		Standalone:  true,
+		New: func(env CmdEnv, cfg Config) (Cmd, error) {
+			return &ConfigValidator{
+				DebugMode:  env.DebugMode,
+				ConfigPath: env.ConfigPath,
+				MultiMode:  env.MultiMode,
+			}, nil
+		},
+	})
+}
+
+// templateCheck is a template in config to be rendered and unmarshaled
+type templateCheck struct {
+	Section string
+	Key     string
+	Tmpl    string
+	Builder interface{}
+	Target  func() interface{} // the go-notion type the template must produce
+}
+
+// templateBlock is a block template decoded strictly by DecodeBlock
+type templateBlock struct{ notion.Block }
+
+func (b *templateBlock) UnmarshalJSON(data []byte) (err error) {
+	b.Block, err = DecodeBlock(data, true)
+	return err
+}
+
+// templateBlocks is a template of blocks decoded strictly by DecodeBlocks
+type templateBlocks []notion.Block
+
+func (b *templateBlocks) UnmarshalJSON(data []byte) (err error) {
+	*b, err = DecodeBlocks(data, true)
+	return err
+}
+
+// filterCheck is a filter or sort expression in config to be rendered and parsed
+type filterCheck struct {
+	templateCheck
+	Parse func(string) error
+}
+
+// searchCheck is a search in config, its query and editedAfter are rendered and parsed
+type searchCheck struct {
+	Section string
+	Key     string
+	Spec    *SearchSpec
+}
+
+// inlineConfig is a config nested in another section, e.g. a pipeline step
+type inlineConfig struct {
+	section string
+	prefix  string
+	config  *Config
+}
+
+// ConfigProblem is an issue found in the config
+type ConfigProblem struct {
+	Line    int // line in config file, 0 if unknown
+	Entry   int // index in multi config, -1 for single config
+	Section string
+	Key     string
+	Err     error
+}
+
+func (p ConfigProblem) String() string {
+	var b strings.Builder
+	if p.Line > 0 {
+		fmt.Fprintf(&b, ":%d", p.Line)
+	}
+	if p.Entry >= 0 {
+		fmt.Fprintf(&b, " [%d]", p.Entry)
+	}
+	if p.Section != "" {
+		fmt.Fprintf(&b, " %v.%v", p.Section, p.Key)
+	} else if p.Key != "" {
+		fmt.Fprintf(&b, " %v", p.Key)
+	}
+	fmt.Fprintf(&b, ": %v", p.Err)
+	return b.String()
+}
+
+var (
+	ErrConfigInvalid = errors.New("Config Invalid")
+
+	sampleDate   = "2024-01-02"
+	samplePageID = "00000000000000000000000000000000"
+)
+
+func (v *ConfigValidator) Validate() error {
+	if v.ConfigPath == "" {
+		return errors.Join(ErrConfigRequired, fmt.Errorf("set --config"))
+	}
+	return nil
+}
+
+func (v *ConfigValidator) Run(ctx context.Context) error {
+	data, err := os.ReadFile(v.ConfigPath)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+	v.lines = strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+
+	problems := []ConfigProblem{}
+	if tree, err := readConfigTree(v.ConfigPath, map[string]bool{}); err != nil {
+		problems = append(problems, ConfigProblem{Entry: -1, Err: err})
+	} else if v.MultiMode {
+		entries, err := splitMultiConfigTree(tree)
+		if err != nil {
+			problems = append(problems, ConfigProblem{Entry: -1, Err: err})
+		}
+
+		for i, entry := range entries {
+			cfg := Config{}
+			if err := decodeConfigTree(entry, &cfg, true); err != nil {
+				problems = append(problems, v.yamlProblems(i, err)...)
+			}
+
+			problems = append(problems, v.CheckConfig(i, cfg)...)
+		}
+		log.Printf("Checked configs: %v", len(entries))
+	} else {
+		cfg := Config{}
+		if err := decodeConfigTree(tree, &cfg, true); err != nil {
+			problems = append(problems, v.yamlProblems(-1, err)...)
+		}
+
+		problems = append(problems, v.CheckConfig(-1, cfg)...)
+	}
+
+	for _, p := range problems {
+		fmt.Fprintf(os.Stderr, "%v%v\n", v.ConfigPath, p)
+	}
+
+	if len(problems) > 0 {
+		return errors.Join(ErrConfigInvalid, fmt.Errorf("found %d problems", len(problems)))
+	}
+
+	log.Printf("Config is valid: %v", v.ConfigPath)
+	return nil
+}
+
+// CheckConfig renders every template of a config entry with sample values
+func (v *ConfigValidator) CheckConfig(entry int, cfg Config) []ConfigProblem {
+	problems := []ConfigProblem{}
+
+	if cfg.Cmd != "" { // cmd of a job in multi config
+		if _, found := LookupCmd(cfg.Cmd); !found {
+			problems = append(problems, ConfigProblem{
+				Line:  v.findLine(entry, "", "cmd"),
+				Entry: entry,
+				Key:   "cmd",
+				Err:   fmt.Errorf("unknown cmd: `%v`", cfg.Cmd),
+			})
+		}
+	}
+
+	for _, check := range configTemplates(cfg) {
+		if check.Tmpl == "" {
+			continue
+		}
+
+		if err := renderCheck(check); err != nil {
+			problems = append(problems, ConfigProblem{
+				Line:    v.findLine(entry, check.Section, check.Key),
+				Entry:   entry,
+				Section: check.Section,
+				Key:     check.Key,
+				Err:     err,
+			})
+		}
+	}
+
+	for _, check := range configFilters(cfg) {
+		if check.Tmpl == "" {
+			continue
+		}
+
+		if err := renderFilterCheck(check); err != nil {
+			problems = append(problems, ConfigProblem{
+				Line:    v.findLine(entry, check.Section, check.Key),
+				Entry:   entry,
+				Section: check.Section,
+				Key:     check.Key,
+				Err:     err,
+			})
+		}
+	}
+
+	query := QueryBuilder{Date: sampleDate, Today: sampleDate, Title: sampleDate}
+	for _, check := range configSearches(cfg) {
+		if check.Spec == nil {
+			continue
+		}
+
+		if err := NewSearchQuery(nil).SetSearch(*check.Spec, query); err != nil {
+			problems = append(problems, ConfigProblem{
+				Line:    v.findLine(entry, check.Section, check.Key),
+				Entry:   entry,
+				Section: check.Section,
+				Key:     check.Key,
+				Err:     err,
+			})
+		}
+	}
+
+	// inline configs of pipeline steps and daemon jobs
+	inlines := []inlineConfig{}
+	for i, step := range cfg.Pipeline.Steps {
+		inlines = append(inlines, inlineConfig{"pipeline", fmt.Sprintf("pipeline.steps[%d]", i), step.Config})
+	}
+	for i, job := range cfg.Daemon.Jobs {
+		inlines = append(inlines, inlineConfig{"daemon", fmt.Sprintf("daemon.jobs[%d]", i), job.Config})
+	}
+
+	for _, inline := range inlines {
+		if inline.config == nil {
+			continue
+		}
+
+		for _, p := range v.CheckConfig(entry, *inline.config) {
+			p.Line = v.findLine(entry, inline.section, p.Key)
+			p.Section = inline.prefix + "." + p.Section
+			problems = append(problems, p)
+		}
+	}
+
+	return problems
+}
+
+func configTemplates(cfg Config) []templateCheck {
+	query := QueryBuilder{Date: sampleDate, Today: sampleDate, Title: sampleDate}
+	page := PageBuilder{Title: sampleDate, Date: sampleDate, DateEnd: sampleDate, DatabaseID: samplePageID}
+	block := BlockBuilder{Date: sampleDate, Content: "Sample content", PageID: samplePageID}
+
+	newQuery := func() interface{} { return &notion.DatabaseQuery{} }
+	newProps := func() interface{} { return &notion.DatabasePageProperties{} }
+	newBlock := func() interface{} { return &templateBlock{} }
+	newBlocks := func() interface{} { return &templateBlocks{} }
+
+	llmBlock := templateCheck{"llm", "respTextBlock", cfg.LLM.RespTextBlock, block, newBlock}
+	if cfg.LLM.RespJSON { // JSON mode renders the model response, keys are unknown
+		llmBlock = templateCheck{"llm", "respTextBlock", cfg.LLM.RespTextBlock, map[string]interface{}{}, newBlocks}
+	}
+
+	checks := []templateCheck{
+		{"dailyJournal", "pageQuery", cfg.DailyJournal.PageQuery, query, newQuery},
+		{"dailyJournal", "pageProperties", cfg.DailyJournal.PageProperties, page, newProps},
+		{"weeklyJournal", "pageQuery", cfg.WeeklyJournal.PageQuery, query, newQuery},
+		{"weeklyJournal", "pageProperties", cfg.WeeklyJournal.PageProperties, page, newProps},
+		{"flashback", "databaseQuery", cfg.Flashback.DatabaseQuery, query, newQuery},
+		{"flashback", "flashbackTextBlock", cfg.Flashback.FlashbackTextBlock, block, newBlock},
+		{"duplicateChecker", "databaseQuery", cfg.DuplicateChecker.DatabaseQuery, query, newQuery},
+		{"duplicateChecker", "duplicateDumpTextBlock", cfg.DuplicateChecker.DuplicateDumpTextBlock, block, newBlock},
+		{"collector", "databaseQuery", cfg.Collector.DatabaseQuery, query, newQuery},
+		{"collector", "collectDumpTextBlock", cfg.Collector.CollectDumpTextBlock, block, newBlock},
+		{"exporter", "databaseQuery", cfg.Exporter.DatabaseQuery, query, newQuery},
+		{"llm", "databaseQuery", cfg.LLM.DatabaseQuery, query, newQuery},
+		llmBlock,
+		{"query", "databaseQuery", cfg.Query.DatabaseQuery, query, newQuery},
+	}
+	for _, s := range configSources(cfg) {
+		checks = append(checks, templateCheck{s.section, "source.databaseQuery", s.source.DatabaseQuery, query, newQuery})
+	}
+	return checks
+}
+
+type sectionSource struct {
+	section string
+	source  SourceConfig
+}
+
+// configSources are the source blocks of cmds
+func configSources(cfg Config) []sectionSource {
+	return []sectionSource{
+		{"flashback", cfg.Flashback.Source},
+		{"duplicateChecker", cfg.DuplicateChecker.Source},
+		{"collector", cfg.Collector.Source},
+		{"exporter", cfg.Exporter.Source},
+		{"llm", cfg.LLM.Source},
+		{"query", cfg.Query.Source},
+	}
+}
+
+// configFilters are the filter and sort expressions of a config, only the syntax is
+// checked, properties are known with the database schema
+func configFilters(cfg Config) []filterCheck {
+	query := QueryBuilder{Date: sampleDate, Today: sampleDate, Title: sampleDate}
+	parseFilter := func(s string) error { _, err := filter.Parse(s); return err }
+	parseSorts := func(s string) error { _, err := filter.ParseSorts(s); return err }
+
+	checks := []filterCheck{}
+	for _, c := range []struct{ section, filter, sort string }{
+		{"flashback", cfg.Flashback.Filter, cfg.Flashback.Sort},
+		{"duplicateChecker", cfg.DuplicateChecker.Filter, cfg.DuplicateChecker.Sort},
+		{"collector", cfg.Collector.Filter, cfg.Collector.Sort},
+		{"exporter", cfg.Exporter.Filter, cfg.Exporter.Sort},
+		{"llm", cfg.LLM.Filter, cfg.LLM.Sort},
+		{"query", cfg.Query.Filter, cfg.Query.Sort},
+	} {
+		checks = append(checks,
+			filterCheck{templateCheck{Section: c.section, Key: "filter", Tmpl: c.filter, Builder: query}, parseFilter},
+			filterCheck{templateCheck{Section: c.section, Key: "sort", Tmpl: c.sort, Builder: query}, parseSorts},
+		)
+	}
+	for _, s := range configSources(cfg) {
+		checks = append(checks,
+			filterCheck{templateCheck{Section: s.section, Key: "source.filter", Tmpl: s.source.Filter, Builder: query}, parseFilter},
+			filterCheck{templateCheck{Section: s.section, Key: "source.sort", Tmpl: s.source.Sort, Builder: query}, parseSorts},
+		)
+	}
+	return checks
+}
+
+// configSearches are the searches of a config, the same as a database query of SetQuery,
+// they are rendered with the sample builder
+func configSearches(cfg Config) []searchCheck {
+	checks := []searchCheck{
+		{"flashback", "search", cfg.Flashback.Search},
+		{"duplicateChecker", "search", cfg.DuplicateChecker.Search},
+		{"collector", "search", cfg.Collector.Search},
+		{"exporter", "search", cfg.Exporter.Search},
+		{"llm", "search", cfg.LLM.Search},
+	}
+	for _, s := range configSources(cfg) {
+		checks = append(checks, searchCheck{s.section, "source.search", s.source.Search})
+	}
+	return checks
+}
+
+// renderCheck executes the template and decodes it strictly into the target type
+func renderCheck(check templateCheck) error {
+	name := check.Section + "." + check.Key
+
+	raw, err := Tmpl(name, check.Tmpl, check.Builder, Clock{})
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(check.Target()); err != nil {
+		return fmt.Errorf("unmarshal %T: %w%v", check.Target(), err, jsonErrContext(raw, err))
+	}
+
+	return nil
+}
+
+// renderFilterCheck executes the template and parses the expression
+func renderFilterCheck(check filterCheck) error {
+	expr, err := TmplText(check.Section+"."+check.Key, check.Tmpl, check.Builder, Clock{})
+	if err != nil {
+		return err
+	}
+	return check.Parse(expr)
+}
+
+// jsonErrContext points to the line of the rendered JSON where the error occurs
+func jsonErrContext(raw []byte, err error) string {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return ""
+	}
+
+	if offset > int64(len(raw)) {
+		offset = int64(len(raw))
+	}
+
+	before := raw[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	start := bytes.LastIndexByte(before, '\n') + 1
+	end := bytes.IndexByte(raw[offset:], '\n')
+	if end < 0 {
+		end = len(raw)
+	} else {
+		end += int(offset)
+	}
+
+	return fmt.Sprintf(" (rendered line %d: %s)", line, strings.TrimSpace(string(raw[start:end])))
+}
+
+var (
+	yamlLineRegex  = regexp.MustCompile(`^line \d+: `)
+	yamlFieldRegex = regexp.MustCompile(`field (\S+) not found in type main\.(\w+)`)
+)
+
+// yamlProblems splits yaml errors, the unknown fields are reported one by one.
+// Lines in yaml errors refer to the config after includes and defaults are merged,
+// so the unknown fields are located in the config file by key instead.
+func (v *ConfigValidator) yamlProblems(entry int, err error) []ConfigProblem {
+	msgs := []string{err.Error()}
+
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		msgs = typeErr.Errors
+	}
+
+	problems := []ConfigProblem{}
+	for _, msg := range msgs {
+		msg = yamlLineRegex.ReplaceAllString(msg, "")
+
+		line := 0
+		if m := yamlFieldRegex.FindStringSubmatch(msg); len(m) > 1 {
+			line = v.findLine(entry, "", m[1])
+		}
+		problems = append(problems, ConfigProblem{Line: line, Entry: entry, Err: errors.New(msg)})
+	}
+	return problems
+}
+
+// findLine locates the key of a section in the config file, 0 if not found.
+// An empty section matches the first key in the entry.
+func (v *ConfigValidator) findLine(entry int, section, key string) int {
+	start := 0
+	if entry >= 0 {
+		start = v.entryLine(entry)
+	}
+
+	sectionRegex := regexp.MustCompile(`^(\s*- )?\s*` + regexp.QuoteMeta(section) + `:`)
+	keyRegex := regexp.MustCompile(`^(\s*- )?\s*` + regexp.QuoteMeta(key) + `:`)
+
+	inSection := section == ""
+	for i := start; i < len(v.lines); i++ {
+		line := v.lines[i]
+		if !inSection {
+			inSection = sectionRegex.MatchString(line)
+			continue
+		}
+		if keyRegex.MatchString(line) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+var entryRegex = regexp.MustCompile(`^(\s*)- `)
+
+// entryLine finds the line starting an entry of the multi config, entries are
+// the list items at the top level, or under `configs:`
+func (v *ConfigValidator) entryLine(entry int) int {
+	start := 0
+	for i, line := range v.lines {
+		if strings.HasPrefix(line, configsKey+":") {
+			start = i + 1
+			break
+		}
+	}
+
+	indent := ""
+	found := -1
+	for i := start; i < len(v.lines); i++ {
+		m := entryRegex.FindStringSubmatch(v.lines[i])
+		if m == nil || (found >= 0 && m[1] != indent) {
+			continue
+		}
+
+		indent = m[1]
+		found += 1
+		if found == entry {
+			return i
+		}
+	}
+	return 0
+}
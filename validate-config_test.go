@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigValidatorReportsProblems(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	config := `collector:
+  databaseQuery: >
+    {"filter": {"property": "Tags"},}
+  collectDumpTextBlock: >
+    {"rich_text": [{"text": {"content": "{{.PageID}}"}}]}
+`
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	v := &ConfigValidator{ConfigPath: path}
+	if err := v.Run(t.Context()); err == nil || !strings.Contains(err.Error(), "found 1 problems") {
+		t.Fatalf("expected 1 problem, got %v", err)
+	}
+
+	problems := v.CheckConfig(-1, Config{Collector: CollectorConfig{DatabaseQuery: `{"filter": {"property": "Tags"},}`}})
+	if len(problems) != 1 || problems[0].Line != 2 || problems[0].Key != "databaseQuery" {
+		t.Fatalf("expected databaseQuery problem at line 2, got %+v", problems)
+	}
+}
+
+func TestConfigValidatorExamples(t *testing.T) {
+	paths, _ := filepath.Glob("example/configs/*")
+	for _, path := range paths {
+		v := &ConfigValidator{ConfigPath: path}
+		if err := v.Run(t.Context()); err != nil {
+			t.Errorf("expected %v to be valid, got %v", path, err)
+		}
+	}
+
+	paths, _ = filepath.Glob("example/multi/*")
+	for _, path := range paths {
+		v := &ConfigValidator{ConfigPath: path, MultiMode: true}
+		if err := v.Run(t.Context()); err != nil {
+			t.Errorf("expected %v to be valid, got %v", path, err)
+		}
+	}
+}
+
+func TestConfigValidatorFilters(t *testing.T) {
+	v := &ConfigValidator{}
+	problems := v.CheckConfig(-1, Config{LLM: LangModelConfig{Filter: `Tags contains`, Sort: `-"Created At"`}})
+
+	if len(problems) != 1 || problems[0].Key != "filter" || !strings.Contains(problems[0].Err.Error(), "expect a value") {
+		t.Fatalf("expected filter problem, got %+v", problems)
+	}
+}
+
+func TestConfigValidatorSearches(t *testing.T) {
+	v := &ConfigValidator{}
+	problems := v.CheckConfig(-1, Config{
+		LLM:       LangModelConfig{Search: &SearchSpec{EditedAfter: "-7x"}},
+		Collector: CollectorConfig{Source: SourceConfig{Search: &SearchSpec{Query: "{{.Date"}}},
+		Exporter:  ExporterConfig{Search: &SearchSpec{Query: "{{.Title}}", EditedAfter: "{{.Date}}"}},
+	})
+
+	if len(problems) != 2 {
+		t.Fatalf("expected 2 search problems, got %+v", problems)
+	}
+	if problems[0].Section != "llm" || !strings.Contains(problems[0].Err.Error(), "-7x") {
+		t.Errorf("expected editedAfter problem of llm, got %+v", problems[0])
+	}
+	if problems[1].Section != "collector" || problems[1].Key != "source.search" {
+		t.Errorf("expected template problem of the collector source, got %+v", problems[1])
+	}
+}